@@ -1,26 +1,226 @@
 package app
 
 import (
+    "os"
     "fmt"
+    "strings"
+    "io/ioutil"
 )
 
 const (
     errLoadingConfig     = "Error loading config"
     errExecutingConfig   = "Error executing config"
+    errImporting         = "Error importing"
+    errSavingConfig      = "Error saving config"
+    errUnknownFormat     = "unknown import format %s"
+    errLoadingPotentials = "Error loading potentials"
+    errExporting         = "Error exporting"
+    errNoPotentials      = "No potentials match the filter"
+    errSkippedExport     = "Skipping: %v\n"
+    errEmptyRun          = "Run %s has no potentials\n"
+    errSameRun           = "The latest run with potentials is the baseline %s, pass -run\n"
+    errThresholds        = "Error reading thresholds"
+    errDiffFailed        = "Regression thresholds exceeded:"
+    infReplaySummary     = "Replayed %d potentials: %d reproduce, %d changed, %d fixed, %d failed\n"
+    infDiffSummary       = "Run %s against %s: %d new, %d disappeared, %d changed\n"
     infExecutionSucceded = "Execution succeded"
+    infImportSucceded    = "Import succeded"
+
+    FormatOpenAPI = "openapi"
+    FormatPostman = "postman"
+    FormatHAR     = "har"
+    FormatCurl    = "curl"
+    FormatHTTP    = "http"
 )
 
-func Start(argConfig string) {
+// Start executes the config, saving potentials to the database and
+// writing a report for every format given an output file.
+func Start(argConfig string, argReports map[string]string) {
     config, err := LoadConfig(argConfig)
     if err != nil {
         fmt.Println(errLoadingConfig, err)
         return
     }
 
-    if err := config.Execute(); err != nil {
+    sinks := []Sink{&DatabaseSink{}}
+    for format, output := range argReports {
+        if output != "" {
+            sinks = append(sinks, NewReportSink(format, output))
+        }
+    }
+
+    if err := config.Execute(sinks); err != nil {
         fmt.Println(errExecutingConfig, err)
         return
     }
 
     fmt.Println(infExecutionSucceded)
 }
+
+func Import(argFormat string, argInput string, argOutput string) {
+    config, err := ImportConfig(argFormat, argInput)
+    if err != nil {
+        fmt.Println(errImporting, err)
+        return
+    }
+
+    if err := SaveConfig(config, argOutput); err != nil {
+        fmt.Println(errSavingConfig, err)
+        return
+    }
+
+    fmt.Println(infImportSucceded, len(config.Operations), "operations")
+}
+
+func ImportConfig(format string, filename string) (*Config, error) {
+    switch format {
+    case FormatOpenAPI:
+        spec, err := LoadOpenAPI(filename)
+        if err != nil {
+            return nil, err
+        }
+        return spec.Config(), nil
+    case FormatPostman:
+        collection, err := LoadPostman(filename)
+        if err != nil {
+            return nil, err
+        }
+        return collection.Config()
+    case FormatHAR:
+        har, err := LoadHAR(filename)
+        if err != nil {
+            return nil, err
+        }
+        return har.Config(), nil
+    case FormatCurl:
+        return LoadCurl(filename)
+    case FormatHTTP:
+        return LoadHTTPFile(filename)
+    }
+    return nil, fmt.Errorf(errUnknownFormat, format)
+}
+
+func ExportPotentials(filter PotentialFilter, argFormat string, argOutput string) {
+    potentials, err := LoadPotentials(filter)
+    if err != nil {
+        fmt.Println(errLoadingPotentials, err)
+        return
+    }
+    if len(potentials) == 0 {
+        fmt.Println(errNoPotentials)
+        return
+    }
+
+    // the request formats rebuild HTTP requests, which the raw, WebSocket
+    // and gRPC potentials never were; noted apart from the export, which
+    // may be going to stdout
+    if argFormat == ExportCurl || argFormat == ExportHTTP || argFormat == ExportGoTest {
+        rebuildable := make([]Potential, 0, len(potentials))
+        for _, potential := range potentials {
+            if err := potential.Rebuildable(); err != nil {
+                fmt.Fprintf(os.Stderr, errSkippedExport, err)
+                continue
+            }
+            rebuildable = append(rebuildable, potential)
+        }
+        if potentials = rebuildable; len(potentials) == 0 {
+            fmt.Println(errNoPotentials)
+            return
+        }
+    }
+
+    exported, err := Export(potentials, argFormat)
+    if err != nil {
+        fmt.Println(errExporting, err)
+        return
+    }
+
+    if argOutput == "" {
+        fmt.Print(exported)
+        return
+    }
+    if err := ioutil.WriteFile(argOutput, []byte(exported), 0644); err != nil {
+        fmt.Println(errExporting, err)
+    }
+}
+
+// Replay sends the potentials again with the credentials of the config,
+// the recorded ones being redacted, and its filters telling the fixed.
+func Replay(filter PotentialFilter, argTarget string, argConfig string) {
+    config, err := LoadConfig(argConfig)
+    if err != nil {
+        fmt.Println(errLoadingConfig, err)
+        return
+    }
+
+    potentials, err := LoadPotentials(filter)
+    if err != nil {
+        fmt.Println(errLoadingPotentials, err)
+        return
+    }
+    if len(potentials) == 0 {
+        fmt.Println(errNoPotentials)
+        return
+    }
+
+    outcomes := make(map[string]int)
+    for _, potential := range potentials {
+        result := potential.Replay(argTarget, config)
+        outcomes[result.Outcome]++
+        fmt.Println(result)
+    }
+
+    fmt.Printf(infReplaySummary, len(potentials), outcomes[ReplayReproduces], outcomes[ReplayChanged], outcomes[ReplayFixed], outcomes[ReplayFailed])
+}
+
+// CompareRuns compares two stored runs and reports whether the current one
+// stays within the thresholds, the latest run being the default current.
+func CompareRuns(argBaseline string, argCurrent string, argThresholds string) bool {
+    thresholds, err := ParseThresholds(argThresholds)
+    if err != nil {
+        fmt.Println(errThresholds, err)
+        return false
+    }
+
+    if argCurrent == "" {
+        if argCurrent, err = LatestRunID(); err != nil {
+            fmt.Println(errLoadingPotentials, err)
+            return false
+        }
+        // a clean latest run saves nothing, leaving an older one latest
+        if argCurrent == argBaseline {
+            fmt.Printf(errSameRun, argBaseline)
+            return false
+        }
+    }
+    baseline, err := LoadPotentials(PotentialFilter{RunID: argBaseline})
+    if err != nil {
+        fmt.Println(errLoadingPotentials, err)
+        return false
+    }
+    current, err := LoadPotentials(PotentialFilter{RunID: argCurrent})
+    if err != nil {
+        fmt.Println(errLoadingPotentials, err)
+        return false
+    }
+    // an unknown or mistyped run would pass everything as new or gone
+    for run, potentials := range map[string][]Potential{argBaseline: baseline, argCurrent: current} {
+        if len(potentials) == 0 {
+            fmt.Printf(errEmptyRun, run)
+            return false
+        }
+    }
+
+    diff := Diff(argBaseline, baseline, argCurrent, current)
+    for _, entry := range diff.Entries {
+        fmt.Println(entry)
+    }
+    fmt.Printf(infDiffSummary, diff.Current, diff.Baseline, diff.Count(DiffNew), diff.Count(DiffDisappeared), diff.Count(DiffChanged))
+
+    violations := diff.Violations(thresholds)
+    if len(violations) > 0 {
+        fmt.Println(errDiffFailed, strings.Join(violations, ", "))
+        return false
+    }
+    return true
+}
@@ -0,0 +1,117 @@
+package app
+
+import (
+    "fmt"
+    "time"
+    "sort"
+    "reflect"
+    "encoding/json"
+)
+
+const (
+    // TagContract marks potentials that broke a declared expectation.
+    TagContract = "contract"
+)
+
+// Expectation declares how a response must look. Method and Payload, the
+// index in the payload list, narrow the requests it applies to.
+type Expectation struct {
+    Method     string                 `json:"method,omitempty"`
+    Payload    *int                   `json:"payload,omitempty"`
+    Status     []int                  `json:"status,omitempty"`
+    JSON       map[string]interface{} `json:"json,omitempty"`
+    Headers    map[string]string      `json:"headers,omitempty"`
+    Schema     *Schema                `json:"schema,omitempty"`
+    MaxLatency int                    `json:"max_latency_ms,omitempty"`
+}
+
+func (expectation *Expectation) Applies(method string, payload int) bool {
+    if expectation.Method != "" && expectation.Method != method {
+        return false
+    }
+    return expectation.Payload == nil || *expectation.Payload == payload
+}
+
+// Assert checks the response against every expectation that applies to
+// the request, returning why it failed or nothing when it passed.
+func (potential *Potential) Assert(expectations []Expectation, payload int) []string {
+    failures := make([]string, 0)
+    for _, expectation := range expectations {
+        if expectation.Applies(potential.RequestMethod, payload) {
+            failures = append(failures, expectation.Check(potential)...)
+        }
+    }
+    return failures
+}
+
+func (expectation *Expectation) Check(potential *Potential) []string {
+    const (
+        errStatus  = "status is %d, expected one of %v"
+        errHeader  = "header %s is %q, expected %q"
+        errLatency = "took %v, expected at most %v"
+        errBody    = "body is not JSON: %v"
+        errPath    = "json %s is %s"
+        errValue   = "json %s is %s, expected %s"
+    )
+    failures := make([]string, 0)
+    if len(expectation.Status) > 0 && !containsInt(expectation.Status, potential.ResponseStatus) {
+        failures = append(failures, fmt.Sprintf(errStatus, potential.ResponseStatus, expectation.Status))
+    }
+    for name, expected := range expectation.Headers {
+        if actual := potential.ResponseHeaders.Get(name); actual != expected {
+            failures = append(failures, fmt.Sprintf(errHeader, name, actual, expected))
+        }
+    }
+    maxLatency := time.Duration(expectation.MaxLatency) * time.Millisecond
+    if maxLatency > 0 && potential.Latency > maxLatency {
+        failures = append(failures, fmt.Sprintf(errLatency, potential.Latency, maxLatency))
+    }
+    if len(expectation.JSON) == 0 && expectation.Schema == nil {
+        return failures
+    }
+
+    var document interface{}
+    if err := json.Unmarshal(potential.ResponsePayload, &document); err != nil {
+        return append(failures, fmt.Sprintf(errBody, err))
+    }
+    for _, path := range sortedKeys(expectation.JSON) {
+        actual, err := LookupJSON(document, path)
+        if err != nil {
+            failures = append(failures, fmt.Sprintf(errPath, path, err))
+            continue
+        }
+        if !reflect.DeepEqual(actual, expectation.JSON[path]) {
+            failures = append(failures, fmt.Sprintf(errValue, path, jsonText(actual), jsonText(expectation.JSON[path])))
+        }
+    }
+    for _, violation := range expectation.Schema.Validate(document, "$") {
+        failures = append(failures, "schema "+violation)
+    }
+    return failures
+}
+
+func containsInt(values []int, value int) bool {
+    for _, candidate := range values {
+        if candidate == value {
+            return true
+        }
+    }
+    return false
+}
+
+func sortedKeys(values map[string]interface{}) []string {
+    keys := make([]string, 0, len(values))
+    for key := range values {
+        keys = append(keys, key)
+    }
+    sort.Strings(keys)
+    return keys
+}
+
+func jsonText(value interface{}) string {
+    bytes, err := json.Marshal(value)
+    if err != nil {
+        return fmt.Sprint(value)
+    }
+    return string(bytes)
+}
@@ -0,0 +1,259 @@
+package app
+
+import (
+    "fmt"
+    "sort"
+    "regexp"
+    "strings"
+    "strconv"
+    "net/url"
+    "net/http"
+)
+
+const (
+    TagMissingHeader     = "missing-security-header"
+    TagWeakHeader        = "weak-security-header"
+    TagInsecureCookie    = "insecure-cookie"
+    TagVersionDisclosure = "version-disclosure"
+
+    // six months, the least HSTS preload lists accept
+    minimumHSTSMaxAge = 15552000
+)
+
+var (
+    productVersion    = regexp.MustCompile(`(?i)(^|[a-z][\w.+-]*[/ ])v?\d+(\.\d+)+|[a-z][\w.+-]*/v?\d+`)
+    disclosureHeaders = []string{"Server", "X-Powered-By", "X-AspNet-Version", "X-AspNetMvc-Version", "X-Generator"}
+)
+
+// HeaderAudit inspects the headers of every response of the run for
+// missing or weak security headers, cookies lacking attributes and
+// version disclosure. Ignore lists headers not to check, such as
+// X-Frame-Options on APIs never framed.
+type HeaderAudit struct {
+    Ignore []string `json:"ignore,omitempty"`
+}
+
+// headerFinding is a misconfiguration of a host, reported once with the
+// first response that showed it and how many more did.
+type headerFinding struct {
+    potential Potential
+    count     int
+}
+
+// Audit aggregates the header findings of a run per host. It is fed
+// from the single goroutine receiving the results.
+type Audit struct {
+    ignore   map[string]bool
+    keys     []string
+    findings map[string]*headerFinding
+}
+
+// NewAudit starts the audit of a run, nil when the config skips it.
+func (config *Config) NewAudit() *Audit {
+    if config.HeaderAudit == nil {
+        return nil
+    }
+    audit := &Audit{
+        ignore:   make(map[string]bool),
+        keys:     make([]string, 0),
+        findings: make(map[string]*headerFinding),
+    }
+    for _, header := range config.HeaderAudit.Ignore {
+        audit.ignore[http.CanonicalHeaderKey(header)] = true
+    }
+    return audit
+}
+
+// Inspect checks every response of the result.
+func (audit *Audit) Inspect(result ExploitResult) {
+    for _, potentials := range []ExploitPotentials{result.Potentials, result.Passed} {
+        for _, potential := range potentials {
+            audit.inspect(potential)
+        }
+    }
+}
+
+func (audit *Audit) inspect(potential Potential) {
+    const (
+        missingFormat      = "%s missing"
+        hstsMaxAgeFormat   = "Strict-Transport-Security max-age %d below %d"
+        weakValueFormat    = "%s %q"
+        cookieFormat       = "cookie %s lacks %s"
+        sameSiteNoneFormat = "cookie %s is SameSite=None without Secure"
+        disclosureFormat   = "%s discloses %q"
+    )
+    if potential.ResponseHeaders == nil {
+        return
+    }
+    parsed, err := url.Parse(potential.RequestURL)
+    if err != nil {
+        return
+    }
+    headers := potential.ResponseHeaders
+    add := func(header string, tag string, severity string, format string, args ...interface{}) {
+        if audit.ignore[header] {
+            return
+        }
+        audit.add(parsed.Host, tag, severity, fmt.Sprintf(format, args...), potential)
+    }
+
+    if parsed.Scheme == "https" {
+        hsts := headers.Get("Strict-Transport-Security")
+        if hsts == "" {
+            add("Strict-Transport-Security", TagMissingHeader, SeverityMedium, missingFormat, "Strict-Transport-Security")
+        } else if maxAge := hstsMaxAge(hsts); maxAge < minimumHSTSMaxAge {
+            add("Strict-Transport-Security", TagWeakHeader, SeverityLow, hstsMaxAgeFormat, maxAge, minimumHSTSMaxAge)
+        }
+    }
+
+    csp := headers.Get("Content-Security-Policy")
+    if csp == "" {
+        add("Content-Security-Policy", TagMissingHeader, SeverityLow, missingFormat, "Content-Security-Policy")
+    } else if weakCSP(csp) {
+        add("Content-Security-Policy", TagWeakHeader, SeverityLow, weakValueFormat, "Content-Security-Policy", csp)
+    }
+
+    if value := headers.Get("X-Content-Type-Options"); value == "" {
+        add("X-Content-Type-Options", TagMissingHeader, SeverityLow, missingFormat, "X-Content-Type-Options")
+    } else if !strings.EqualFold(strings.TrimSpace(value), "nosniff") {
+        add("X-Content-Type-Options", TagWeakHeader, SeverityLow, weakValueFormat, "X-Content-Type-Options", value)
+    }
+
+    // frame-ancestors supersedes X-Frame-Options
+    if !strings.Contains(strings.ToLower(csp), "frame-ancestors") {
+        switch value := headers.Get("X-Frame-Options"); strings.ToUpper(strings.TrimSpace(value)) {
+        case "DENY", "SAMEORIGIN":
+        case "":
+            add("X-Frame-Options", TagMissingHeader, SeverityLow, missingFormat, "X-Frame-Options")
+        default:
+            add("X-Frame-Options", TagWeakHeader, SeverityLow, weakValueFormat, "X-Frame-Options", value)
+        }
+    }
+
+    switch value := headers.Get("Referrer-Policy"); strings.ToLower(strings.TrimSpace(value)) {
+    case "":
+        add("Referrer-Policy", TagMissingHeader, SeverityLow, missingFormat, "Referrer-Policy")
+    case "unsafe-url", "no-referrer-when-downgrade":
+        add("Referrer-Policy", TagWeakHeader, SeverityLow, weakValueFormat, "Referrer-Policy", value)
+    }
+
+    response := http.Response{Header: headers}
+    for _, cookie := range response.Cookies() {
+        if !cookie.Secure {
+            add("Set-Cookie", TagInsecureCookie, SeverityMedium, cookieFormat, cookie.Name, "Secure")
+        }
+        if !cookie.HttpOnly {
+            add("Set-Cookie", TagInsecureCookie, SeverityMedium, cookieFormat, cookie.Name, "HttpOnly")
+        }
+        switch {
+        case cookie.SameSite == 0 || cookie.SameSite == http.SameSiteDefaultMode:
+            add("Set-Cookie", TagInsecureCookie, SeverityLow, cookieFormat, cookie.Name, "SameSite")
+        case cookie.SameSite == http.SameSiteNoneMode && !cookie.Secure:
+            add("Set-Cookie", TagInsecureCookie, SeverityMedium, sameSiteNoneFormat, cookie.Name)
+        }
+    }
+
+    for _, header := range disclosureHeaders {
+        if value := headers.Get(header); discloses(value) {
+            add(header, TagVersionDisclosure, SeverityLow, disclosureFormat, header, value)
+        }
+    }
+}
+
+func (audit *Audit) add(host string, tag string, severity string, message string, potential Potential) {
+    key := host + " " + message
+    if finding, ok := audit.findings[key]; ok {
+        finding.count++
+        return
+    }
+    potential.Tag, potential.Severity = tag, severity
+    potential.Failures = []string{message}
+    potential.Check = &Check{Kind: CheckAudit, Args: map[string]string{"message": message}}
+    audit.keys = append(audit.keys, key)
+    audit.findings[key] = &headerFinding{potential: potential, count: 1}
+}
+
+// Result holds one potential per host and finding, noting how many
+// responses showed it.
+func (audit *Audit) Result() ExploitResult {
+    const (
+        countFormat = "seen in %d responses"
+    )
+    result := ExploitResult{
+        Potentials: make(ExploitPotentials, 0, len(audit.keys)),
+        Passed:     make(ExploitPotentials, 0),
+        Failed:     make([]FailedRequest, 0),
+    }
+    for _, key := range audit.keys {
+        finding := audit.findings[key]
+        potential := finding.potential
+        potential.Failures = append(potential.Failures, fmt.Sprintf(countFormat, finding.count))
+        result.Potentials = append(result.Potentials, potential)
+    }
+    return result
+}
+
+// Print lists the findings by host.
+func (audit *Audit) Print() {
+    const (
+        summaryFormat = "Header audit: %d findings\n"
+        hostFormat    = "  %s\n"
+        findingFormat = "    [%s] %s (%d responses)\n"
+    )
+    fmt.Printf(summaryFormat, len(audit.keys))
+    hosts := make(map[string][]*headerFinding)
+    names := make([]string, 0)
+    for _, key := range audit.keys {
+        host := strings.SplitN(key, " ", 2)[0]
+        if _, ok := hosts[host]; !ok {
+            names = append(names, host)
+        }
+        hosts[host] = append(hosts[host], audit.findings[key])
+    }
+    sort.Strings(names)
+    for _, host := range names {
+        fmt.Printf(hostFormat, host)
+        for _, finding := range hosts[host] {
+            fmt.Printf(findingFormat, finding.potential.Severity, finding.potential.Failures[0], finding.count)
+        }
+    }
+}
+
+func hstsMaxAge(value string) int {
+    for _, directive := range strings.Split(value, ";") {
+        pair := strings.SplitN(strings.TrimSpace(directive), "=", 2)
+        if len(pair) == 2 && strings.EqualFold(pair[0], "max-age") {
+            maxAge, err := strconv.Atoi(strings.Trim(pair[1], `"`))
+            if err != nil {
+                return 0
+            }
+            return maxAge
+        }
+    }
+    return 0
+}
+
+// weakCSP tells whether the policy still lets scripts in from anywhere
+// or inline.
+func weakCSP(value string) bool {
+    for _, directive := range strings.Split(strings.ToLower(value), ";") {
+        fields := strings.Fields(directive)
+        if len(fields) == 0 || (fields[0] != "script-src" && fields[0] != "default-src") {
+            continue
+        }
+        for _, source := range fields[1:] {
+            switch source {
+            case "*", "'unsafe-inline'", "'unsafe-eval'", "http:", "https:", "data:":
+                return true
+            }
+        }
+    }
+    return false
+}
+
+// discloses tells whether a header value carries a product version, such
+// as nginx/1.18.0, PHP/7.4, WordPress 6.2 or the bare 4.0.30319 of the
+// version headers.
+func discloses(value string) bool {
+    return productVersion.MatchString(value)
+}
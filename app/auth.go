@@ -0,0 +1,370 @@
+package app
+
+import (
+    "fmt"
+    "sync"
+    "time"
+    "errors"
+    "strings"
+    "net/url"
+    "net/http"
+    "io/ioutil"
+    "encoding/json"
+    "encoding/base64"
+)
+
+const (
+    AuthBasic  = "basic"
+    AuthBearer = "bearer"
+    AuthAPIKey = "apikey"
+    AuthOAuth2 = "oauth2"
+
+    APIKeyInHeader = "header"
+    APIKeyInQuery  = "query"
+
+    GrantClientCredentials = "client_credentials"
+    GrantPassword          = "password"
+
+    defaultAPIKeyName = "X-API-Key"
+
+    // redactedValue stands in for the credentials of recorded requests
+    redactedValue = "REDACTED"
+
+    // tokenExpirySkew renews tokens a little before they expire, so the
+    // requests in flight don't carry a stale one.
+    tokenExpirySkew = 30 * time.Second
+    tokenTimeout    = 10 * time.Second
+)
+
+var (
+    providers = map[string]func(auth *Auth) Provider{
+        AuthBasic: func(auth *Auth) Provider {
+            credentials := auth.Username + ":" + auth.Password
+            return &headerProvider{name: "Authorization", value: "Basic " + base64.StdEncoding.EncodeToString([]byte(credentials))}
+        },
+        AuthBearer: func(auth *Auth) Provider {
+            return &headerProvider{name: "Authorization", value: "Bearer " + auth.Token}
+        },
+        AuthAPIKey: func(auth *Auth) Provider {
+            return &apiKeyProvider{auth: auth}
+        },
+        AuthOAuth2: func(auth *Auth) Provider {
+            return &oauth2Provider{auth: auth}
+        },
+    }
+)
+
+// Auth configures the credentials sent with a scan or an endpoint. The
+// fields used depend on the type.
+type Auth struct {
+    Type         string   `json:"type"`
+    Username     string   `json:"username,omitempty"`
+    Password     string   `json:"password,omitempty"`
+    Token        string   `json:"token,omitempty"`
+    Name         string   `json:"name,omitempty"`
+    In           string   `json:"in,omitempty"`
+    Key          string   `json:"key,omitempty"`
+    Grant        string   `json:"grant,omitempty"`
+    TokenURL     string   `json:"token_url,omitempty"`
+    ClientID     string   `json:"client_id,omitempty"`
+    ClientSecret string   `json:"client_secret,omitempty"`
+    Scopes       []string `json:"scopes,omitempty"`
+
+    // Forged credentials are made up by a test, they are part of the
+    // finding and recorded as sent.
+    Forged bool `json:"-"`
+
+    once     sync.Once
+    provider Provider
+}
+
+// Provider adds credentials to outgoing requests. Invalidate is given the
+// headers of a refused request, drops what it cached if they carried it,
+// and tells whether authenticating again may help.
+type Provider interface {
+    Authenticate(headers http.Header, query url.Values) error
+    Invalidate(sent http.Header) bool
+}
+
+type headerProvider struct {
+    name  string
+    value string
+}
+
+type apiKeyProvider struct {
+    auth *Auth
+}
+
+type oauth2Provider struct {
+    auth    *Auth
+    mutex   sync.Mutex
+    token   string
+    refresh string
+    expiry  time.Time
+}
+
+type oauth2Token struct {
+    AccessToken  string `json:"access_token"`
+    RefreshToken string `json:"refresh_token"`
+    ExpiresIn    int    `json:"expires_in"`
+}
+
+// Provider is built on first use and shared by every request using the
+// auth, so tokens are fetched once per scan.
+func (auth *Auth) Provider() Provider {
+    auth.once.Do(func() {
+        if build, ok := providers[auth.Type]; ok {
+            auth.provider = build(auth)
+        }
+    })
+    return auth.provider
+}
+
+// Apply sets the credentials as plain headers, rather than through the
+// builder BasicAuth, so they are recorded along with the request. It
+// returns the URL, which API keys may extend.
+func (auth *Auth) Apply(headers http.Header, target string) (string, error) {
+    const (
+        errUnknownAuth = "unknown auth type %s"
+    )
+    if auth == nil {
+        return target, nil
+    }
+    provider := auth.Provider()
+    if provider == nil {
+        return "", fmt.Errorf(errUnknownAuth, auth.Type)
+    }
+    query := make(url.Values)
+    if err := provider.Authenticate(headers, query); err != nil {
+        return "", err
+    }
+    if len(query) == 0 {
+        return target, nil
+    }
+    separator := "?"
+    if strings.Contains(target, "?") {
+        separator = "&"
+    }
+    return target + separator + query.Encode(), nil
+}
+
+// Secrets names the headers and the query parameters the auth sends its
+// credentials in.
+func (auth *Auth) Secrets() ([]string, []string) {
+    if auth == nil {
+        return nil, nil
+    }
+    if auth.Type != AuthAPIKey {
+        return []string{"Authorization"}, nil
+    }
+    name := orDefault(auth.Name, defaultAPIKeyName)
+    if auth.In == APIKeyInQuery {
+        return nil, []string{name}
+    }
+    return []string{name}, nil
+}
+
+// Redact masks the credentials of a request about to be recorded: any
+// Authorization header, and whatever the auth and the signing added.
+// Replays authenticate again from the config instead. Forged credentials
+// are kept, replays send them again.
+func Redact(headers http.Header, target string, auth *Auth, signing *Signing) (http.Header, string) {
+    names, parameters := auth.Secrets()
+    forged := make(map[string]bool)
+    if auth != nil && auth.Forged {
+        for _, name := range names {
+            forged[http.CanonicalHeaderKey(name)] = true
+        }
+        names, parameters = nil, nil
+    }
+    names = append(append(names, "Authorization", "Proxy-Authorization"), signing.Headers()...)
+    redacted := CloneHeaders(headers)
+    for _, name := range names {
+        if redacted.Get(name) != "" && !forged[http.CanonicalHeaderKey(name)] {
+            redacted.Set(name, redactedValue)
+        }
+    }
+    parsed, err := url.Parse(target)
+    if err != nil || len(parameters) == 0 {
+        return redacted, target
+    }
+    query := parsed.Query()
+    for _, name := range parameters {
+        // Apply appended the key encoded this way
+        if value := query.Get(name); value != "" {
+            secret := url.Values{name: {value}}.Encode()
+            target = strings.Replace(target, secret, url.Values{name: {redactedValue}}.Encode(), -1)
+        }
+    }
+    return redacted, target
+}
+
+// Unredact drops the masked credentials from a recorded request, for the
+// auth to set them again.
+func Unredact(headers http.Header, target string) (http.Header, string) {
+    clean := CloneHeaders(headers)
+    for name, values := range clean {
+        if len(values) == 1 && values[0] == redactedValue {
+            clean.Del(name)
+        }
+    }
+    parsed, err := url.Parse(target)
+    if err != nil || !strings.Contains(parsed.RawQuery, redactedValue) {
+        return clean, target
+    }
+    query := parsed.Query()
+    for name, values := range query {
+        if len(values) == 1 && values[0] == redactedValue {
+            query.Del(name)
+        }
+    }
+    parsed.RawQuery = query.Encode()
+    return clean, parsed.String()
+}
+
+// Refresh tells whether a request refused with 401 is worth retrying,
+// given the headers it was sent with.
+func (auth *Auth) Refresh(sent http.Header) bool {
+    if auth == nil || auth.Provider() == nil {
+        return false
+    }
+    return auth.Provider().Invalidate(sent)
+}
+
+func (provider *headerProvider) Authenticate(headers http.Header, query url.Values) error {
+    headers.Set(provider.name, provider.value)
+    return nil
+}
+
+func (provider *headerProvider) Invalidate(sent http.Header) bool {
+    return false
+}
+
+func (provider *apiKeyProvider) Authenticate(headers http.Header, query url.Values) error {
+    name := provider.auth.Name
+    if name == "" {
+        name = defaultAPIKeyName
+    }
+    if provider.auth.In == APIKeyInQuery {
+        query.Set(name, provider.auth.Key)
+        return nil
+    }
+    headers.Set(name, provider.auth.Key)
+    return nil
+}
+
+func (provider *apiKeyProvider) Invalidate(sent http.Header) bool {
+    return false
+}
+
+func (provider *oauth2Provider) Authenticate(headers http.Header, query url.Values) error {
+    token, err := provider.Token()
+    if err != nil {
+        return err
+    }
+    headers.Set("Authorization", "Bearer "+token)
+    return nil
+}
+
+// Invalidate drops the token only when the refused request carried it,
+// so the requests refused together fetch a single new one. Those that
+// carried an older token are retried with the current one.
+func (provider *oauth2Provider) Invalidate(sent http.Header) bool {
+    provider.mutex.Lock()
+    defer provider.mutex.Unlock()
+    if provider.token != "" && sent.Get("Authorization") == "Bearer "+provider.token {
+        provider.token = ""
+    }
+    return true
+}
+
+// Token returns the cached access token while it is valid, renewing it
+// with the refresh token when there is one and the grant otherwise.
+func (provider *oauth2Provider) Token() (string, error) {
+    provider.mutex.Lock()
+    defer provider.mutex.Unlock()
+    if provider.token != "" && (provider.expiry.IsZero() || time.Now().Add(tokenExpirySkew).Before(provider.expiry)) {
+        return provider.token, nil
+    }
+    if provider.refresh != "" {
+        form := url.Values{
+            "grant_type":    {"refresh_token"},
+            "refresh_token": {provider.refresh},
+        }
+        if err := provider.fetch(form); err == nil {
+            return provider.token, nil
+        }
+    }
+    if err := provider.fetch(provider.auth.GrantForm()); err != nil {
+        return "", err
+    }
+    return provider.token, nil
+}
+
+func (auth *Auth) GrantForm() url.Values {
+    form := url.Values{
+        "grant_type": {GrantClientCredentials},
+    }
+    if auth.Grant == GrantPassword {
+        form.Set("grant_type", GrantPassword)
+        form.Set("username", auth.Username)
+        form.Set("password", auth.Password)
+    }
+    if len(auth.Scopes) > 0 {
+        form.Set("scope", strings.Join(auth.Scopes, " "))
+    }
+    return form
+}
+
+// fetch posts the grant to the token endpoint, the client authenticating
+// with basic auth as RFC 6749 recommends.
+func (provider *oauth2Provider) fetch(form url.Values) error {
+    const (
+        errTokenStatus = "token endpoint answered %d: %s"
+        errNoToken     = "token endpoint returned no access token"
+    )
+    auth := provider.auth
+    request, err := http.NewRequest(http.MethodPost, auth.TokenURL, strings.NewReader(form.Encode()))
+    if err != nil {
+        return err
+    }
+    request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+    request.Header.Set("Accept", "application/json")
+    if auth.ClientID != "" {
+        request.SetBasicAuth(url.QueryEscape(auth.ClientID), url.QueryEscape(auth.ClientSecret))
+    }
+
+    client := &http.Client{
+        Transport: pool.Transport,
+        Timeout:   tokenTimeout,
+    }
+    response, err := client.Do(request)
+    if err != nil {
+        return err
+    }
+    defer response.Body.Close()
+    body, err := ioutil.ReadAll(response.Body)
+    if err != nil {
+        return err
+    }
+    if response.StatusCode != http.StatusOK {
+        return fmt.Errorf(errTokenStatus, response.StatusCode, body)
+    }
+
+    var token oauth2Token
+    if err := json.Unmarshal(body, &token); err != nil {
+        return err
+    }
+    if token.AccessToken == "" {
+        return errors.New(errNoToken)
+    }
+    provider.token = token.AccessToken
+    if token.RefreshToken != "" {
+        provider.refresh = token.RefreshToken
+    }
+    provider.expiry = time.Time{}
+    if token.ExpiresIn > 0 {
+        provider.expiry = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+    }
+    return nil
+}
@@ -1,21 +1,136 @@
 package app
 
 import (
-    "fmt"
+    "sort"
+    "strings"
+    "net/url"
+    "net/http"
 )
 
-func (config *Config) BuildURLs() []string {
-    const (
-        urlFormat = "%s%s"
-    )
-    urls := make([]string, 0)
+func (config *Config) BuildExploits() []*Exploit {
+    exploits := make([]*Exploit, 0)
     for _, endpoint := range config.Endpoints {
-        variants := Compose(endpoint)
-        for _, variant := range variants {
-            urls = append(urls, fmt.Sprintf(urlFormat, config.BaseURL, variant))
+        for _, variant := range Compose(endpoint.Path) {
+            exploits = append(exploits, config.BuildExploit(endpoint, config.BaseURL+variant))
         }
     }
-    return urls
+    for _, operation := range config.Operations {
+        for _, variant := range operation.Variants(config.FuzzValuesOrDefault()) {
+            exploits = append(exploits, config.BuildOperationExploit(variant))
+        }
+    }
+    return exploits
+}
+
+func (config *Config) BuildOperationExploit(operation Operation) *Exploit {
+    // bodies are validated by LoadConfig
+    body, _ := operation.BodyBytes()
+    exploit := &Exploit{
+        Operation:           operation.ID,
+        URL:                 config.BuildOperationURL(operation),
+        Methods:             []string{operation.Method},
+        Payloads:            []Payload{operation.Payload},
+        Body:                body,
+        Headers:             BuildHeaders(config.Headers, operation.Headers),
+        Auth:                config.Auth,
+        Signing:             config.Signing,
+        FilterResponseCodes: config.FilterResponseCodes,
+        Expectations:        operation.Expect,
+        Identities:          config.Identities,
+        Owner:               config.DefaultOwner(),
+        Interactions:        config.interactions,
+    }
+    if exploit.Expectations == nil {
+        exploit.Expectations = config.Expect
+    }
+    return exploit
+}
+
+// BuildExploit resolves the endpoint definition against the top level
+// defaults, which apply to every field the endpoint leaves unset.
+func (config *Config) BuildExploit(endpoint Endpoint, target string) *Exploit {
+    exploit := &Exploit{
+        URL:                 target,
+        Methods:             endpoint.Methods,
+        Payloads:            endpoint.Payloads,
+        Headers:             BuildHeaders(config.Headers, endpoint.Headers),
+        Auth:                endpoint.Auth,
+        Signing:             endpoint.Signing,
+        FilterResponseCodes: endpoint.FilterResponseCodes,
+        Expectations:        endpoint.Expect,
+        Identities:          config.Identities,
+        Owner:               endpoint.Owner,
+        Interactions:        config.interactions,
+    }
+    if exploit.Methods == nil {
+        exploit.Methods = config.Methods
+    }
+    if exploit.Payloads == nil {
+        exploit.Payloads = config.Payloads
+    }
+    if exploit.Auth == nil {
+        exploit.Auth = config.Auth
+    }
+    if exploit.Signing == nil {
+        exploit.Signing = config.Signing
+    }
+    if exploit.FilterResponseCodes == nil {
+        exploit.FilterResponseCodes = config.FilterResponseCodes
+    }
+    if exploit.Expectations == nil {
+        exploit.Expectations = config.Expect
+    }
+    if exploit.Owner == "" {
+        exploit.Owner = config.DefaultOwner()
+    }
+    return exploit
+}
+
+// DefaultOwner is the identity owning the resources of endpoints that
+// don't name one: the configured owner, or else the first identity.
+func (config *Config) DefaultOwner() string {
+    if config.Owner != "" || len(config.Identities) == 0 {
+        return config.Owner
+    }
+    return config.Identities[0].Name
+}
+
+func (config *Config) BuildOperationURL(operation Operation) string {
+    target := operation.URL
+    if !strings.Contains(target, "://") {
+        target = config.BaseURL + target
+    }
+    if len(operation.Query) == 0 {
+        return target
+    }
+    keys := make([]string, 0, len(operation.Query))
+    for key := range operation.Query {
+        keys = append(keys, key)
+    }
+    sort.Strings(keys)
+    query := make([]string, 0, len(keys))
+    for _, key := range keys {
+        query = append(query, url.QueryEscape(key)+"="+url.QueryEscape(operation.Query[key]))
+    }
+    separator := "?"
+    if strings.Contains(target, "?") {
+        separator = "&"
+    }
+    return target + separator + strings.Join(query, "&")
+}
+
+// BuildHeaders merges the given header sets, later ones taking precedence.
+func BuildHeaders(sets ...map[string]string) http.Header {
+    var result http.Header
+    for _, headers := range sets {
+        for name, value := range headers {
+            if result == nil {
+                result = make(http.Header)
+            }
+            result.Set(name, value)
+        }
+    }
+    return result
 }
 
 func Compose(endpoint string) []string {
@@ -0,0 +1,154 @@
+package app
+
+import (
+    "strings"
+    "strconv"
+    "net/url"
+)
+
+const (
+    CheckCORS     = "cors"
+    CheckRedirect = "redirect"
+    CheckHost     = "host"
+    CheckAudit    = "header-audit"
+    CheckVerb     = "verb"
+    CheckTrace    = "trace"
+    CheckOverride = "method-override"
+    CheckIdentity = "identity"
+    CheckGraphQL  = "graphql"
+)
+
+// Check records the check that judged a potential, with what it needs
+// beyond the request and the response, so that replays judge the new
+// response the same way rather than on its status alone.
+type Check struct {
+    Kind string            `json:"kind"`
+    Args map[string]string `json:"args,omitempty"`
+}
+
+// Judge runs the check again on the replayed exchange, telling whether
+// the finding still holds. The request is the replayed one, which the
+// checks comparing against other requests derive theirs from.
+func (check *Check) Judge(replayed *Potential, request *Request, config *Config) (bool, error) {
+    args := check.Args
+    switch check.Kind {
+    case CheckCORS:
+        origin := corsOrigin{kind: args["kind"], origin: args["origin"], severity: args["severity"]}
+        origin.Analyze(replayed, strings.Split(args["methods"], ","))
+    case CheckRedirect:
+        AnalyzeRedirect(replayed, args["parameter"], args["value"], args["host"])
+    case CheckHost:
+        tampering := hostTampering{kind: args["kind"]}
+        tampering.Analyze(replayed, args["host"])
+    case CheckAudit:
+        audit := &Audit{
+            ignore:   make(map[string]bool),
+            keys:     make([]string, 0),
+            findings: make(map[string]*headerFinding),
+        }
+        audit.inspect(*replayed)
+        for _, finding := range audit.findings {
+            if finding.potential.Failures[0] == args["message"] {
+                return true, nil
+            }
+        }
+        return false, nil
+    case CheckVerb:
+        guard, err := resend(request, args["guard"], nil)
+        if err != nil {
+            return false, err
+        }
+        return guarded(guard.ResponseStatus) && reachable(replayed.ResponseStatus), nil
+    case CheckTrace:
+        return reachable(replayed.ResponseStatus) && strings.HasPrefix(string(replayed.ResponsePayload), "TRACE "), nil
+    case CheckOverride:
+        // the override still reaches a method the target refuses, and
+        // the carrier without it answers otherwise
+        refused, err := resend(request, args["method"], func(plain *Request) { withoutOverride(plain, args) })
+        if err != nil {
+            return false, err
+        }
+        plain, err := resend(request, request.Method, func(plain *Request) { withoutOverride(plain, args) })
+        if err != nil {
+            return false, err
+        }
+        return blocked(refused.ResponseStatus) && reachable(replayed.ResponseStatus) && replayed.Signature() != plain.Signature(), nil
+    case CheckIdentity:
+        return judgeIdentity(replayed, request, config, args)
+    case CheckGraphQL:
+        expected, _ := strconv.Atoi(args["expected"])
+        graphCase := &GraphQLCase{Kind: args["kind"], Field: args["field"], Argument: args["argument"], Expected: expected}
+        graphCase.Analyze(replayed)
+    }
+    return len(replayed.Failures) > 0, nil
+}
+
+// judgeIdentity holds while the identity still gets the content of the
+// owner, and the control identity doesn't. The owner and the control are
+// sent again when the config knows them, the recorded owner content is
+// used otherwise, as for the valid token of the JWT tests.
+func judgeIdentity(replayed *Potential, request *Request, config *Config, args map[string]string) (bool, error) {
+    content := args["content"]
+    // the forged credential of the identity goes, the others send their own
+    as := func(identity Identity) func(*Request) {
+        return func(sent *Request) {
+            sent.Headers.Del(args["credential"])
+            sent.Auth, sent.Identity = identity.Auth, identity.Name
+        }
+    }
+    if owner, ok := config.Identity(args["owner"]); ok {
+        fresh, err := resend(request, request.Method, as(owner))
+        if err != nil {
+            return false, err
+        }
+        if fresh.ResponseStatus/100 != 2 {
+            return false, nil
+        }
+        content = fresh.Content()
+    }
+    if replayed.Content() != content {
+        return false, nil
+    }
+    if args["control"] == "" {
+        return true, nil
+    }
+    // a control unknown to the config, as the JWT tests missing token,
+    // is anonymous
+    control, _ := config.Identity(args["control"])
+    public, err := resend(request, request.Method, as(control))
+    if err != nil {
+        return false, err
+    }
+    return public.Content() != content, nil
+}
+
+// resend sends a variant of the replayed request, changed by change
+// when given.
+func resend(request *Request, method string, change func(*Request)) (Potential, error) {
+    sent := *request
+    sent.Method = method
+    sent.Headers = CloneHeaders(request.Headers)
+    if change != nil {
+        change(&sent)
+    }
+    response, apiErr := sent.Do()
+    if apiErr != nil {
+        return Potential{}, apiErr
+    }
+    return Potential{ResponseStatus: response.StatusCode, ResponsePayload: response.Payload}, nil
+}
+
+// withoutOverride drops the override header or parameter of the request.
+func withoutOverride(request *Request, args map[string]string) {
+    if header := args["header"]; header != "" {
+        request.Headers.Del(header)
+    }
+    if parameter := args["parameter"]; parameter != "" {
+        if parsed, err := url.Parse(request.URL); err == nil {
+            query := parsed.Query()
+            query.Del(parameter)
+            parsed.RawQuery = query.Encode()
+            request.URL = parsed.String()
+        }
+    }
+}
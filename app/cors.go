@@ -0,0 +1,198 @@
+package app
+
+import (
+    "fmt"
+    "net"
+    "strings"
+    "net/url"
+    "net/http"
+)
+
+const (
+    TagCORSReflected          = "cors-reflected-origin"
+    TagCORSNull               = "cors-null-origin"
+    TagCORSWildcard           = "cors-wildcard"
+    TagCORSCredentialWildcard = "cors-credentialed-wildcard"
+
+    defaultCORSOrigin = "https://evil.example"
+)
+
+var (
+    defaultPreflightMethods = []string{http.MethodPut, http.MethodDelete, http.MethodPatch}
+)
+
+// CORSTest sends simple and preflight requests with crafted origins and
+// reads how the Access-Control headers answer them.
+type CORSTest struct {
+    Origin  string   `json:"origin,omitempty"`
+    Methods []string `json:"methods,omitempty"`
+}
+
+// corsOrigin is a crafted origin and how bad trusting it is.
+type corsOrigin struct {
+    kind     string
+    origin   string
+    severity string
+}
+
+// Origins crafts the origins for the target: the attacker domain, null,
+// the target host as a prefix and a suffix of other domains, a made up
+// subdomain and, for https targets, plain http.
+func (test *CORSTest) Origins(target string) []corsOrigin {
+    attacker := orDefault(test.Origin, defaultCORSOrigin)
+    origins := []corsOrigin{
+        {"attacker domain", attacker, SeverityHigh},
+        {"null", "null", SeverityHigh},
+    }
+    parsed, err := url.Parse(target)
+    if err != nil || parsed.Host == "" {
+        return origins
+    }
+    host := parsed.Hostname()
+    attackerHost := strings.TrimPrefix(strings.TrimPrefix(attacker, "https://"), "http://")
+    origins = append(origins, corsOrigin{"suffix trick", parsed.Scheme + "://" + host + "." + attackerHost, SeverityHigh})
+    // addresses have no domain to play prefix or subdomain tricks on
+    if net.ParseIP(host) == nil {
+        origins = append(origins,
+            corsOrigin{"prefix trick", parsed.Scheme + "://evil" + registrableDomain(host), SeverityHigh},
+            corsOrigin{"subdomain", parsed.Scheme + "://evil." + host, SeverityLow},
+        )
+    }
+    if parsed.Scheme == "https" {
+        origins = append(origins, corsOrigin{"plain http", "http://" + parsed.Host, SeverityMedium})
+    }
+    return origins
+}
+
+// registrableDomain keeps the last two labels of the host, which is
+// close enough to tell example.com from notexample.com.
+func registrableDomain(host string) string {
+    labels := strings.Split(host, ".")
+    if len(labels) <= 2 {
+        return host
+    }
+    return strings.Join(labels[len(labels)-2:], ".")
+}
+
+func (test *CORSTest) Run(exploit *Exploit) ExploitResult {
+    result := ExploitResult{
+        Potentials: make(ExploitPotentials, 0),
+        Passed:     make(ExploitPotentials, 0),
+        Failed:     make([]FailedRequest, 0),
+    }
+    methods := test.Methods
+    if len(methods) == 0 {
+        methods = defaultPreflightMethods
+    }
+    // a wildcard answers every origin the same, so it is reported once
+    // per request kind
+    wildcards := make(map[string]bool)
+    for _, origin := range test.Origins(exploit.URL) {
+        simple := exploit.Request(http.MethodGet)
+        preflight := exploit.Request(http.MethodOptions)
+        preflight.Auth, preflight.Signing = nil, nil
+        for _, request := range []*Request{simple, preflight} {
+            if request.Headers == nil {
+                request.Headers = make(http.Header)
+            }
+            request.Headers.Set("Origin", origin.origin)
+        }
+        preflight.Headers.Set("Access-Control-Request-Method", methods[0])
+        preflight.Headers.Set("Access-Control-Request-Headers", "authorization, content-type")
+
+        for _, request := range []*Request{simple, preflight} {
+            potential, failure := request.Send()
+            if failure != nil {
+                result.Failed = append(result.Failed, *failure)
+                continue
+            }
+            origin.Analyze(&potential, methods)
+            potential.Check = origin.Check(methods)
+            if potential.Tag == TagCORSWildcard || potential.Tag == TagCORSCredentialWildcard {
+                if wildcards[request.Method] {
+                    potential.Failures = nil
+                }
+                wildcards[request.Method] = true
+            }
+            result.Flag(potential)
+        }
+    }
+    return result
+}
+
+// Check records the origin for replays to analyze the response again.
+func (origin corsOrigin) Check(methods []string) *Check {
+    return &Check{Kind: CheckCORS, Args: map[string]string{
+        "kind":     origin.kind,
+        "origin":   origin.origin,
+        "severity": origin.severity,
+        "methods":  strings.Join(methods, ","),
+    }}
+}
+
+// Analyze flags the response when it lets the crafted origin in: by
+// reflecting it, or through a wildcard. Allowing credentials makes it
+// worse, as the browser then sends the victim cookies.
+func (origin corsOrigin) Analyze(potential *Potential, methods []string) {
+    const (
+        reflectedFormat = "%s origin %s allowed"
+        wildcardFormat  = "wildcard origin allowed"
+        withCredentials = ", with credentials"
+        withMethods     = ", methods %s"
+    )
+    headers := potential.ResponseHeaders
+    allowed := headers.Get("Access-Control-Allow-Origin")
+    credentials := strings.EqualFold(headers.Get("Access-Control-Allow-Credentials"), "true")
+    var message string
+    switch {
+    case allowed == "*" && credentials:
+        potential.Tag, potential.Severity = TagCORSCredentialWildcard, SeverityMedium
+        message = wildcardFormat
+    case allowed == "*":
+        potential.Tag, potential.Severity = TagCORSWildcard, SeverityLow
+        message = wildcardFormat
+    case allowed != "" && allowed == origin.origin:
+        potential.Tag, potential.Severity = TagCORSReflected, origin.severity
+        if origin.origin == "null" {
+            potential.Tag = TagCORSNull
+        }
+        if !credentials {
+            potential.Severity = lowerSeverity(origin.severity)
+        }
+        message = fmt.Sprintf(reflectedFormat, origin.kind, origin.origin)
+    default:
+        return
+    }
+    if credentials {
+        message += withCredentials
+    }
+    if allowedMethods := dangerousMethods(headers.Get("Access-Control-Allow-Methods"), methods); len(allowedMethods) > 0 {
+        message += fmt.Sprintf(withMethods, strings.Join(allowedMethods, ", "))
+    }
+    potential.Failures = append(potential.Failures, message)
+}
+
+func dangerousMethods(allowed string, methods []string) []string {
+    found := make([]string, 0)
+    for _, method := range strings.Split(allowed, ",") {
+        method = strings.ToUpper(strings.TrimSpace(method))
+        if method == "*" {
+            return []string{"*"}
+        }
+        for _, dangerous := range methods {
+            if method == dangerous {
+                found = append(found, method)
+            }
+        }
+    }
+    return found
+}
+
+func lowerSeverity(severity string) string {
+    for name, rank := range severityRanks {
+        if rank == severityRanks[severity]-1 {
+            return name
+        }
+    }
+    return severity
+}
@@ -0,0 +1,68 @@
+package app
+
+import (
+    "fmt"
+    "sync"
+)
+
+type Coverage struct {
+    mutex      sync.Mutex
+    operations []string
+    statuses   map[string][]int
+}
+
+func NewCoverage(operations []Operation) *Coverage {
+    coverage := &Coverage{
+        operations: make([]string, 0, len(operations)),
+        statuses:   make(map[string][]int),
+    }
+    for _, operation := range operations {
+        coverage.operations = append(coverage.operations, operation.ID)
+    }
+    return coverage
+}
+
+func (coverage *Coverage) Record(operation string, potentials ExploitPotentials) {
+    if operation == "" {
+        return
+    }
+    coverage.mutex.Lock()
+    defer coverage.mutex.Unlock()
+    for _, potential := range potentials {
+        coverage.statuses[operation] = append(coverage.statuses[operation], potential.ResponseStatus)
+    }
+}
+
+func (coverage *Coverage) Exercised() int {
+    coverage.mutex.Lock()
+    defer coverage.mutex.Unlock()
+    exercised := 0
+    for _, operation := range coverage.operations {
+        if len(coverage.statuses[operation]) > 0 {
+            exercised++
+        }
+    }
+    return exercised
+}
+
+func (coverage *Coverage) Print() {
+    const (
+        summaryFormat     = "Coverage: %d/%d documented operations exercised\n"
+        exercisedFormat   = "  [x] %s %v\n"
+        unexercisedFormat = "  [ ] %s\n"
+    )
+    if len(coverage.operations) == 0 {
+        return
+    }
+    fmt.Printf(summaryFormat, coverage.Exercised(), len(coverage.operations))
+    coverage.mutex.Lock()
+    defer coverage.mutex.Unlock()
+    for _, operation := range coverage.operations {
+        statuses := coverage.statuses[operation]
+        if len(statuses) == 0 {
+            fmt.Printf(unexercisedFormat, operation)
+            continue
+        }
+        fmt.Printf(exercisedFormat, operation, statuses)
+    }
+}
@@ -0,0 +1,417 @@
+package app
+
+import (
+    "fmt"
+    "errors"
+    "strings"
+    "net/url"
+    "io/ioutil"
+    "unicode/utf8"
+    "encoding/base64"
+)
+
+var (
+    // curlSwitches take no value and don't change the request.
+    curlSwitches = map[string]bool{
+        "--compressed": true, "-k": true, "--insecure": true, "-s": true, "--silent": true,
+        "-S": true, "--show-error": true, "-L": true, "--location": true, "-v": true,
+        "--verbose": true, "-i": true, "--include": true, "-f": true, "--fail": true,
+        "--http1.1": true, "--http2": true, "-N": true, "--no-buffer": true, "-g": true,
+        "--globoff": true, "--path-as-is": true,
+    }
+
+    // curlIgnored take a value that doesn't change the request.
+    curlIgnored = map[string]bool{
+        "-o": true, "--output": true, "-m": true, "--max-time": true, "--connect-timeout": true,
+        "--retry": true, "-x": true, "--proxy": true, "--cacert": true, "-E": true, "--cert": true,
+        "--key": true, "-w": true, "--write-out": true, "--resolve": true, "-c": true, "--cookie-jar": true,
+    }
+)
+
+// shellWord is a word of a shell command line, or one of the operators
+// separating commands: a line break, ;, &&, || or |.
+type shellWord struct {
+    text     string
+    operator bool
+}
+
+type curlCommand struct {
+    method  string
+    target  string
+    headers map[string]string
+    data    []string
+    form    [][2]string
+    get     bool
+}
+
+func LoadCurl(filename string) (*Config, error) {
+    const (
+        errInvalidCommand = "invalid curl command %d: %v"
+    )
+    bytes, err := ioutil.ReadFile(filename)
+    if err != nil {
+        return nil, err
+    }
+    commands, err := SplitCurlCommands(string(bytes))
+    if err != nil {
+        return nil, err
+    }
+    operations := make([]Operation, 0, len(commands))
+    for i, args := range commands {
+        operation, err := ParseCurl(args)
+        if err != nil {
+            return nil, fmt.Errorf(errInvalidCommand, i+1, err)
+        }
+        operation.ID = ImportedOperationID(i, operation.Method, operation.URL)
+        operations = append(operations, operation)
+    }
+    return ImportedConfig(operations), nil
+}
+
+// SplitCurlCommands tokenizes the file the way a POSIX shell would and
+// starts a new command at every curl word in command position, so curl
+// as the value of an option stays a value.
+func SplitCurlCommands(text string) ([][]string, error) {
+    lines := strings.Split(strings.Replace(text, "\r\n", "\n", -1), "\n")
+    kept := make([]string, 0, len(lines))
+    for _, line := range lines {
+        if strings.HasPrefix(strings.TrimSpace(line), "#") {
+            continue
+        }
+        kept = append(kept, line)
+    }
+    words, err := shellWords(strings.Join(kept, "\n"))
+    if err != nil {
+        return nil, err
+    }
+    commands := make([][]string, 0)
+    active, starting := false, true
+    for _, word := range words {
+        switch {
+        case word.operator:
+            active, starting = false, true
+            continue
+        case starting && word.text == "curl":
+            commands = append(commands, []string{})
+            active, starting = true, false
+            continue
+        }
+        starting = false
+        if !active {
+            continue
+        }
+        commands[len(commands)-1] = append(commands[len(commands)-1], word.text)
+    }
+    return commands, nil
+}
+
+func shellWords(text string) ([]shellWord, error) {
+    const (
+        errUnterminated = "unterminated quote"
+    )
+    words := make([]shellWord, 0)
+    var word strings.Builder
+    inWord, quoted := false, false
+    flush := func() {
+        if inWord {
+            value := word.String()
+            operator := !quoted && (value == "&&" || value == "||" || value == "|")
+            words = append(words, shellWord{text: value, operator: operator})
+            word.Reset()
+        }
+        inWord, quoted = false, false
+    }
+    runes := []rune(text)
+    for i := 0; i < len(runes); i++ {
+        switch r := runes[i]; {
+        case r == '\\' && i+1 < len(runes):
+            i++
+            if runes[i] != '\n' {
+                word.WriteRune(runes[i])
+                inWord, quoted = true, true
+            }
+        case r == '\'':
+            end := indexRune(runes, i+1, '\'')
+            if end < 0 {
+                return nil, errors.New(errUnterminated)
+            }
+            word.WriteString(string(runes[i+1 : end]))
+            i, inWord, quoted = end, true, true
+        case r == '$' && i+1 < len(runes) && runes[i+1] == '\'':
+            end := i + 2
+            for ; end < len(runes) && runes[end] != '\''; end++ {
+                if runes[end] == '\\' {
+                    end++
+                }
+            }
+            if end >= len(runes) {
+                return nil, errors.New(errUnterminated)
+            }
+            word.WriteString(ansiUnquote(string(runes[i+2 : end])))
+            i, inWord, quoted = end, true, true
+        case r == '"':
+            end := i + 1
+            for ; end < len(runes) && runes[end] != '"'; end++ {
+                if runes[end] == '\\' && end+1 < len(runes) && strings.ContainsRune("\"\\$`\n", runes[end+1]) {
+                    end++
+                    if runes[end] != '\n' {
+                        word.WriteRune(runes[end])
+                    }
+                    continue
+                }
+                word.WriteRune(runes[end])
+            }
+            if end >= len(runes) {
+                return nil, errors.New(errUnterminated)
+            }
+            i, inWord, quoted = end, true, true
+        case r == ' ' || r == '\t':
+            flush()
+        case r == '\n' || r == ';':
+            flush()
+            words = append(words, shellWord{text: string(r), operator: true})
+        default:
+            word.WriteRune(r)
+            inWord = true
+        }
+    }
+    flush()
+    return words, nil
+}
+
+func indexRune(runes []rune, from int, target rune) int {
+    for i := from; i < len(runes); i++ {
+        if runes[i] == target {
+            return i
+        }
+    }
+    return -1
+}
+
+// ansiUnquote expands the escapes of bash $'...' strings, which browsers
+// use when copying requests as curl.
+func ansiUnquote(value string) string {
+    replacer := strings.NewReplacer(
+        `\\`, `\`, `\'`, `'`, `\"`, `"`, `\n`, "\n", `\r`, "\r", `\t`, "\t", `\0`, "\x00",
+    )
+    return replacer.Replace(value)
+}
+
+func ParseCurl(args []string) (Operation, error) {
+    const (
+        errMissingValue = "missing value for %s"
+        errMissingURL   = "missing url"
+    )
+    command := &curlCommand{
+        headers: make(map[string]string),
+    }
+    for i := 0; i < len(args); i++ {
+        name, value, attached := splitCurlOption(args[i])
+        if !strings.HasPrefix(name, "-") {
+            command.target = name
+            continue
+        }
+        if curlSwitches[name] || isCurlSwitchGroup(name) {
+            continue
+        }
+        switch name {
+        case "-G", "--get":
+            command.get = true
+            continue
+        case "-I", "--head":
+            command.method = "HEAD"
+            continue
+        }
+        if !attached {
+            if i+1 >= len(args) {
+                return Operation{}, fmt.Errorf(errMissingValue, name)
+            }
+            i++
+            value = args[i]
+        }
+        if err := command.apply(name, value); err != nil {
+            return Operation{}, err
+        }
+    }
+    if command.target == "" {
+        return Operation{}, errors.New(errMissingURL)
+    }
+    return command.operation()
+}
+
+// splitCurlOption separates values glued to short options, as in -XPOST,
+// and to long ones, as in --request=POST.
+func splitCurlOption(arg string) (string, string, bool) {
+    if strings.HasPrefix(arg, "--") {
+        if i := strings.Index(arg, "="); i > 0 {
+            return arg[:i], arg[i+1:], true
+        }
+        return arg, "", false
+    }
+    if strings.HasPrefix(arg, "-") && len(arg) > 2 && strings.ContainsRune("XHdbuAeFo", rune(arg[1])) {
+        return arg[:2], arg[2:], true
+    }
+    return arg, "", false
+}
+
+func isCurlSwitchGroup(name string) bool {
+    if strings.HasPrefix(name, "--") || len(name) < 3 {
+        return false
+    }
+    for _, flag := range name[1:] {
+        if !curlSwitches["-"+string(flag)] {
+            return false
+        }
+    }
+    return true
+}
+
+func (command *curlCommand) apply(name string, value string) error {
+    const (
+        errUnknownOption = "unsupported option %s"
+    )
+    switch name {
+    case "-X", "--request":
+        command.method = strings.ToUpper(value)
+    case "--url":
+        command.target = value
+    case "-H", "--header":
+        if i := strings.Index(value, ":"); i > 0 {
+            command.headers[strings.TrimSpace(value[:i])] = strings.TrimSpace(value[i+1:])
+        }
+    case "--data-raw":
+        command.data = append(command.data, value)
+    case "-d", "--data", "--data-binary", "--data-ascii":
+        if strings.HasPrefix(value, "@") {
+            content, err := readCurlFile(value[1:])
+            if err != nil {
+                return err
+            }
+            // only --data-binary keeps the line breaks of the file
+            if value = content; name != "--data-binary" {
+                value = strings.NewReplacer("\r", "", "\n", "").Replace(content)
+            }
+        }
+        command.data = append(command.data, value)
+    case "--data-urlencode":
+        encoded, err := curlURLEncode(value)
+        if err != nil {
+            return err
+        }
+        command.data = append(command.data, encoded)
+    case "--json":
+        if strings.HasPrefix(value, "@") {
+            content, err := readCurlFile(value[1:])
+            if err != nil {
+                return err
+            }
+            value = content
+        }
+        command.data = append(command.data, value)
+        setDefaultHeader(command.headers, "Content-Type", "application/json")
+        setDefaultHeader(command.headers, "Accept", "application/json")
+    case "-F", "--form":
+        if i := strings.Index(value, "="); i > 0 {
+            command.form = append(command.form, [2]string{value[:i], value[i+1:]})
+        }
+    case "-u", "--user":
+        command.headers["Authorization"] = "Basic " + base64.StdEncoding.EncodeToString([]byte(value))
+    case "-A", "--user-agent":
+        command.headers["User-Agent"] = value
+    case "-e", "--referer":
+        command.headers["Referer"] = value
+    case "-b", "--cookie":
+        command.headers["Cookie"] = value
+    default:
+        if !curlIgnored[name] {
+            return fmt.Errorf(errUnknownOption, name)
+        }
+    }
+    return nil
+}
+
+// curlURLEncode encodes the value the ways --data-urlencode takes it:
+// content, =content, name=content, @file and name@file.
+func curlURLEncode(value string) (string, error) {
+    if i := strings.Index(value, "="); i >= 0 {
+        return value[:i+1] + url.QueryEscape(value[i+1:]), nil
+    }
+    i := strings.Index(value, "@")
+    if i < 0 {
+        return url.QueryEscape(value), nil
+    }
+    content, err := readCurlFile(value[i+1:])
+    if err != nil {
+        return "", err
+    }
+    if i == 0 {
+        return url.QueryEscape(content), nil
+    }
+    return value[:i] + "=" + url.QueryEscape(content), nil
+}
+
+// readCurlFile reads the file a data option points at with @, relative
+// to the working directory as curl itself would.
+func readCurlFile(filename string) (string, error) {
+    const (
+        errStdin = "data from stdin is not supported"
+    )
+    if filename == "-" {
+        return "", errors.New(errStdin)
+    }
+    content, err := ioutil.ReadFile(filename)
+    if err != nil {
+        return "", err
+    }
+    return string(content), nil
+}
+
+func (command *curlCommand) operation() (Operation, error) {
+    operation := Operation{
+        Method:  command.method,
+        URL:     command.target,
+        Headers: command.headers,
+    }
+    if !strings.Contains(operation.URL, "://") {
+        operation.URL = "http://" + operation.URL
+    }
+    data := strings.Join(command.data, "&")
+
+    switch {
+    case command.get:
+        if data != "" {
+            separator := "?"
+            if strings.Contains(operation.URL, "?") {
+                separator = "&"
+            }
+            operation.URL += separator + data
+        }
+    case len(command.form) > 0:
+        body, contentType, err := MultipartBody(command.form)
+        if err != nil {
+            return Operation{}, err
+        }
+        operation.Body = base64.StdEncoding.EncodeToString(body)
+        operation.Encoding = EncodingBase64
+        operation.Headers["Content-Type"] = contentType
+    case len(command.data) > 0:
+        operation.Body = data
+        operation.Encoding = EncodingText
+        if !utf8.ValidString(data) {
+            operation.Body = base64.StdEncoding.EncodeToString([]byte(data))
+            operation.Encoding = EncodingBase64
+        }
+        setDefaultHeader(operation.Headers, "Content-Type", "application/x-www-form-urlencoded")
+    }
+
+    if operation.Method == "" {
+        operation.Method = "GET"
+        if operation.Body != "" {
+            operation.Method = "POST"
+        }
+    }
+    if len(operation.Headers) == 0 {
+        operation.Headers = nil
+    }
+    return operation, nil
+}
@@ -0,0 +1,194 @@
+package app
+
+import (
+    "fmt"
+    "sort"
+    "regexp"
+    "strings"
+    "net/http"
+    "crypto/sha1"
+    "encoding/hex"
+    "encoding/json"
+)
+
+const (
+    DiffNew         = "new"
+    DiffDisappeared = "disappeared"
+    DiffChanged     = "changed"
+)
+
+var (
+    digits = regexp.MustCompile(`[0-9]+`)
+)
+
+type DiffEntry struct {
+    Change   string
+    Baseline *Potential
+    Current  *Potential
+}
+
+type RunDiff struct {
+    Baseline string
+    Current  string
+    Entries  []DiffEntry
+}
+
+// RequestIdentity names the request that produced the potential, the
+// check and who sent it, so the same request can be found in another
+// run. The headers count too, checks tamper with Origin, Host or the
+// method overrides. Callback tokens are left out, each run handing out
+// new ones, and so are credentials, sessions and tokens, the identity
+// already naming them.
+func (potential *Potential) RequestIdentity() string {
+    target := stripTokens([]byte(potential.RequestURL))
+    headers := make([]string, 0, len(potential.RequestHeaders))
+    for name, values := range potential.RequestHeaders {
+        switch http.CanonicalHeaderKey(name) {
+        case "Authorization", "Proxy-Authorization", "Cookie":
+            continue
+        }
+        value := strings.Join(values, ", ")
+        if _, err := ParseJWT(value); err == nil || value == redactedValue {
+            continue
+        }
+        headers = append(headers, http.CanonicalHeaderKey(name)+": "+string(stripTokens([]byte(value))))
+    }
+    sort.Strings(headers)
+    return potential.Identity + " " + potential.Tag + " " + potential.RequestMethod + " " + string(target) + " " + digest([]byte(strings.Join(headers, "\n"))) + " " + digest(stripTokens(potential.Body()))
+}
+
+// Signature summarizes the response leaving out what changes on every
+// call: the shape of JSON payloads, or the text with numbers blanked.
+func (potential *Potential) Signature() string {
+    var payload interface{}
+    if err := json.Unmarshal(potential.ResponsePayload, &payload); err == nil {
+        return fmt.Sprintf("%d %s", potential.ResponseStatus, digest([]byte(shape(payload))))
+    }
+    return fmt.Sprintf("%d %s", potential.ResponseStatus, digest(digits.ReplaceAll(potential.ResponsePayload, []byte("0"))))
+}
+
+func shape(value interface{}) string {
+    switch value := value.(type) {
+    case map[string]interface{}:
+        keys := make([]string, 0, len(value))
+        for key := range value {
+            keys = append(keys, key)
+        }
+        sort.Strings(keys)
+        fields := make([]string, 0, len(keys))
+        for _, key := range keys {
+            fields = append(fields, key+":"+shape(value[key]))
+        }
+        return "{" + strings.Join(fields, ",") + "}"
+    case []interface{}:
+        if len(value) == 0 {
+            return "[]"
+        }
+        return "[" + shape(value[0]) + "]"
+    case string:
+        return "string"
+    case float64:
+        return "number"
+    case bool:
+        return "bool"
+    }
+    return "null"
+}
+
+func digest(bytes []byte) string {
+    sum := sha1.Sum(bytes)
+    return hex.EncodeToString(sum[:])
+}
+
+func indexPotentials(potentials []Potential) (map[string]*Potential, []string) {
+    index := make(map[string]*Potential)
+    order := make([]string, 0, len(potentials))
+    for i := range potentials {
+        identity := potentials[i].RequestIdentity()
+        if _, ok := index[identity]; !ok {
+            order = append(order, identity)
+        }
+        index[identity] = &potentials[i]
+    }
+    return index, order
+}
+
+// Diff matches both runs on request identity, keeping what is new in
+// current, what is gone from it and what answers differently.
+func Diff(baselineRun string, baseline []Potential, currentRun string, current []Potential) RunDiff {
+    diff := RunDiff{
+        Baseline: baselineRun,
+        Current:  currentRun,
+        Entries:  make([]DiffEntry, 0),
+    }
+    baselineIndex, baselineOrder := indexPotentials(baseline)
+    currentIndex, currentOrder := indexPotentials(current)
+    for _, identity := range currentOrder {
+        now := currentIndex[identity]
+        before, ok := baselineIndex[identity]
+        switch {
+        case !ok:
+            diff.Entries = append(diff.Entries, DiffEntry{Change: DiffNew, Current: now})
+        case before.Signature() != now.Signature():
+            diff.Entries = append(diff.Entries, DiffEntry{Change: DiffChanged, Baseline: before, Current: now})
+        }
+    }
+    for _, identity := range baselineOrder {
+        if _, ok := currentIndex[identity]; !ok {
+            diff.Entries = append(diff.Entries, DiffEntry{Change: DiffDisappeared, Baseline: baselineIndex[identity]})
+        }
+    }
+    return diff
+}
+
+func (diff RunDiff) Count(change string) int {
+    count := 0
+    for _, entry := range diff.Entries {
+        if entry.Change == change {
+            count++
+        }
+    }
+    return count
+}
+
+// Violations lists the thresholds exceeded by new and changed potentials
+// at each severity or above.
+func (diff RunDiff) Violations(thresholds map[string]int) []string {
+    const (
+        violationFormat = "%d %s or above, %d allowed"
+    )
+    severities := make([]string, 0, len(thresholds))
+    for severity := range thresholds {
+        severities = append(severities, severity)
+    }
+    sort.Slice(severities, func(i, j int) bool {
+        return severityRanks[severities[i]] > severityRanks[severities[j]]
+    })
+    violations := make([]string, 0)
+    for _, severity := range severities {
+        count := 0
+        for _, entry := range diff.Entries {
+            if entry.Change != DiffDisappeared && SeverityAtLeast(entry.Current.Classify(), severity) {
+                count++
+            }
+        }
+        if count > thresholds[severity] {
+            violations = append(violations, fmt.Sprintf(violationFormat, count, severity, thresholds[severity]))
+        }
+    }
+    return violations
+}
+
+func (entry DiffEntry) String() string {
+    const (
+        entryFormat   = "[%s] [%s] %s %s %d"
+        changedFormat = "[%s] [%s] %s %s %d -> %d"
+    )
+    switch entry.Change {
+    case DiffChanged:
+        return fmt.Sprintf(changedFormat, entry.Change, entry.Current.Classify(), entry.Current.RequestMethod, entry.Current.RequestURL, entry.Baseline.ResponseStatus, entry.Current.ResponseStatus)
+    case DiffDisappeared:
+        return fmt.Sprintf(entryFormat, entry.Change, entry.Baseline.Classify(), entry.Baseline.RequestMethod, entry.Baseline.RequestURL, entry.Baseline.ResponseStatus)
+    }
+    return fmt.Sprintf(entryFormat, entry.Change, entry.Current.Classify(), entry.Current.RequestMethod, entry.Current.RequestURL, entry.Current.ResponseStatus)
+}
@@ -10,71 +10,195 @@ import (
 )
 
 type Exploit struct {
-    URL      string
-    Methods  []string
-    Payloads []Payload
+    Operation           string
+    URL                 string
+    Methods             []string
+    Payloads            []Payload
+    Body                []byte
+    Headers             http.Header
+    Auth                *Auth
+    Signing             *Signing
+    FilterResponseCodes []int
+    Expectations        []Expectation
+    Identities          []Identity
+    Owner               string
+    Control             string
+    Interactions        *Interactions
 }
 
 type Potential struct {
+    ID              int64
+    RunID           string
+    Tag             string
+    Identity        string
+    Severity        string
     RequestMethod   string
     RequestURL      string
+    RequestHeaders  http.Header
     RequestPayload  Payload
+    RequestBody     []byte
     ResponseStatus  int
     ResponseHeaders http.Header
     ResponsePayload []byte
+    Latency         time.Duration
+    Failures        []string
+    Check           *Check
 }
 
 type ExploitPotentials []Potential
 
-func (config *Config) Execute() error {
+// FailedRequest is a request that got no response at all.
+type FailedRequest struct {
+    Potential Potential
+    Err       string
+}
+
+// ExploitResult carries everything an exploit sent: the potentials, the
+// responses the filters dropped and the requests that failed.
+type ExploitResult struct {
+    Potentials ExploitPotentials
+    Passed     ExploitPotentials
+    Failed     []FailedRequest
+    Asserted   bool
+}
+
+func (config *Config) Execute(sinks []Sink) error {
     const (
-        errSavingPotential = "error saving potential"
+        errRecordingResult = "error recording result"
     )
 
-    out := make(chan ExploitPotentials)
+    out := make(chan ExploitResult)
+    done := make(chan bool)
+    contract := &ExploitResult{}
+    audit := config.NewAudit()
 
-    go func() {
-        for {
-            exploitPotentials := <-out
+    interactions, err := config.StartInteractions()
+    if err != nil {
+        return err
+    }
+    defer interactions.Close()
+    config.interactions = interactions
 
-            for _, potential := range exploitPotentials {
-                if !potential.Match(config.FilterResponseCodes) {
-                    continue
-                }
-                if err := potential.Save(); err != nil {
-                    fmt.Println(errSavingPotential, err)
-                    continue
-                }
+    runID := NewRunID()
+    fmt.Println("Starting run", runID)
+
+    record := func(result ExploitResult) {
+        result.Stamp(runID)
+        for _, sink := range sinks {
+            if err := sink.Record(result); err != nil {
+                fmt.Println(errRecordingResult, err)
+            }
+        }
+    }
+
+    go func() {
+        for result := range out {
+            if result.Asserted {
+                contract.Add(result)
             }
+            if audit != nil {
+                audit.Inspect(result)
+            }
+            record(result)
         }
+        done <- true
     }()
 
     fmt.Println("Building URLS..")
-    domain := config.BuildURLs()
+    exploits := config.BuildExploits()
+    chains := config.BuildChains()
+    coverage := NewCoverage(config.Operations)
+
+    tampered, err := config.BuildJWTExploits(exploits, coverage)
+    if err != nil {
+        close(out)
+        <-done
+        return err
+    }
+    graphs, introspections, err := config.BuildGraphQLCases()
+    if err != nil {
+        close(out)
+        <-done
+        return err
+    }
+    for _, result := range introspections {
+        out <- result
+    }
+    calls, reflections, err := config.BuildGRPCCases()
+    if err != nil {
+        close(out)
+        <-done
+        return err
+    }
+    for _, result := range reflections {
+        out <- result
+    }
+    raws, baselines, err := config.BuildRawCases()
+    if err != nil {
+        close(out)
+        <-done
+        return err
+    }
+    for _, result := range baselines {
+        out <- result
+    }
+    sockets := config.BuildWebSocketCases()
+    modules := config.Modules()
 
     var group sync.WaitGroup
-    group.Add(len(domain))
+    group.Add(len(exploits) + len(tampered) + len(chains) + len(graphs) + len(calls) + len(sockets) + len(raws) + len(modules)*len(exploits))
 
     limiter := make(chan bool, config.RateLimiter)
 
     fmt.Println("Executing exploits...")
 
-    for i, url := range domain {
+    for i, exploit := range exploits {
         limiter <- true
 
         if i > 0 {
             fmt.Printf("\r%c[2K", 27)
         }
 
-        exploit := &Exploit{
-            URL:      url,
-            Methods:  config.Methods,
-            Payloads: config.Payloads,
-        }
-
         fmt.Print(exploit.Methods, " >> ", exploit.URL)
 
-        go exploit.AsyncExecute(&group, limiter, out)
+        go exploit.AsyncExecute(&group, limiter, coverage, out)
+    }
+
+    for _, exploit := range tampered {
+        limiter <- true
+        go exploit.AsyncExecute(&group, limiter, coverage, out)
+    }
+
+    for _, chain := range chains {
+        limiter <- true
+        go chain.AsyncExecute(config, &group, limiter, coverage, out)
+    }
+
+    for _, graphCase := range graphs {
+        limiter <- true
+        go graphCase.AsyncExecute(&group, limiter, out)
+    }
+
+    for _, grpcCase := range calls {
+        limiter <- true
+        go grpcCase.AsyncExecute(&group, limiter, out)
+    }
+
+    for _, socketCase := range sockets {
+        limiter <- true
+        go socketCase.AsyncExecute(&group, limiter, out)
+    }
+
+    for _, rawCase := range raws {
+        limiter <- true
+        go rawCase.AsyncExecute(&group, limiter, out)
+    }
+
+    for _, module := range modules {
+        for _, exploit := range exploits {
+            limiter <- true
+            go AsyncRun(module, exploit, &group, limiter, out)
+        }
     }
 
     fmt.Println()
@@ -85,45 +209,242 @@ func (config *Config) Execute() error {
 
     fmt.Println("Finishing execution...")
 
-    time.Sleep(1 * time.Second)
+    close(out)
+    <-done
+
+    coverage.Print()
+    contract.PrintAssertions()
+
+    if interactions != nil {
+        interactions.Await()
+        record(interactions.Result())
+        interactions.Print()
+    }
+
+    if audit != nil {
+        record(audit.Result())
+        audit.Print()
+    }
 
+    for _, sink := range sinks {
+        if err := sink.Close(); err != nil {
+            return err
+        }
+    }
     return nil
 }
 
-func (exploit *Exploit) AsyncExecute(group *sync.WaitGroup, limiter chan bool, out chan ExploitPotentials) {
+// NewRunID identifies the potentials saved by one execution, the random
+// suffix telling apart runs started within the same second.
+func NewRunID() string {
+    const (
+        runIDFormat = "20060102-150405"
+    )
+    suffix, _ := randomHex(4)
+    return time.Now().Format(runIDFormat) + "-" + suffix
+}
+
+func (exploit *Exploit) AsyncExecute(group *sync.WaitGroup, limiter chan bool, coverage *Coverage, out chan ExploitResult) {
     defer group.Done()
-    out <- exploit.Execute()
+    out <- exploit.Run(coverage)
     <-limiter
 }
 
-func (exploit *Exploit) Execute() ExploitPotentials {
+// Run executes the exploit and sorts what it got into a result.
+func (exploit *Exploit) Run(coverage *Coverage) ExploitResult {
+    potentials, failed := exploit.Execute()
+    coverage.Record(exploit.Operation, potentials)
+    result := ExploitResult{
+        Potentials: make(ExploitPotentials, 0),
+        Passed:     make(ExploitPotentials, 0),
+        Failed:     failed,
+        Asserted:   len(exploit.Expectations) > 0,
+    }
+    for _, potential := range potentials {
+        if exploit.Reports(&potential) {
+            result.Potentials = append(result.Potentials, potential)
+        } else {
+            result.Passed = append(result.Passed, potential)
+        }
+    }
+    return result
+}
+
+func (exploit *Exploit) Execute() (ExploitPotentials, []FailedRequest) {
     potentials := make(ExploitPotentials, 0)
+    failed := make([]FailedRequest, 0)
+
+    // without identities every request goes once with the exploit auth
+    identities := exploit.Identities
+    if len(identities) == 0 {
+        identities = []Identity{{Auth: exploit.Auth}}
+    }
+
     for _, method := range exploit.Methods {
-        // Change payload validation
-        for _, payload := range exploit.Payloads {
-            request := &Request{
-                Method:  method,
-                URL:     exploit.URL,
-                Payload: payload,
+        payloads, indexed := exploit.Payloads, true
+        if !AcceptsPayload(method) || len(payloads) == 0 {
+            payloads, indexed = []Payload{nil}, false
+        }
+        for i, payload := range payloads {
+            replays := make([]Potential, 0, len(identities))
+            for _, identity := range identities {
+                request := &Request{
+                    Method:   method,
+                    URL:      exploit.URL,
+                    Headers:  exploit.Headers,
+                    Auth:     identity.Auth,
+                    Signing:  exploit.Signing,
+                    Payload:  payload,
+                    Body:     exploit.Body,
+                    Identity: identity.Name,
+
+                    Interactions: exploit.Interactions,
+                }
+                potential, failure := request.Send()
+                if failure != nil {
+                    failed = append(failed, *failure)
+                    continue
+                }
+                if len(exploit.Expectations) > 0 && exploit.Owns(&potential) {
+                    index := i
+                    if !indexed {
+                        index = -1
+                    }
+                    if potential.Failures = potential.Assert(exploit.Expectations, index); len(potential.Failures) > 0 {
+                        potential.Tag = TagContract
+                    }
+                }
+                replays = append(replays, potential)
             }
-            response, apiErr := request.Do()
-            if apiErr != nil {
-                // handle apiErr
-                continue
+            if len(exploit.Identities) > 0 {
+                exploit.CompareIdentities(replays)
             }
-            potentials = append(potentials,
-                Potential{
-                    RequestMethod:   request.Method,
-                    RequestURL:      request.URL,
-                    RequestPayload:  request.Payload,
-                    ResponseStatus:  response.StatusCode,
-                    ResponseHeaders: response.Headers,
-                    ResponsePayload: response.Payload,
-                },
-            )
+            potentials = append(potentials, replays...)
+        }
+    }
+    return potentials, failed
+}
+
+// Send does the request, recording the exchange as a potential or why
+// it failed. Callback placeholders get a token tracked back to it.
+func (request *Request) Send() (Potential, *FailedRequest) {
+    request, token := request.Interactions.Inject(request)
+    response, apiErr := request.Do()
+    if apiErr != nil {
+        headers, target := Redact(request.Headers, request.URL, request.Auth, request.Signing)
+        failure := &FailedRequest{
+            Potential: Potential{
+                Identity:       request.Identity,
+                RequestMethod:  request.Method,
+                RequestURL:     target,
+                RequestHeaders: headers,
+                RequestPayload: request.Payload,
+                RequestBody:    request.Body,
+            },
+            Err: apiErr.Error(),
         }
+        request.Interactions.Track(token, failure.Potential)
+        return Potential{}, failure
+    }
+    potential := Potential{
+        Identity:        request.Identity,
+        RequestMethod:   request.Method,
+        RequestURL:      response.URL,
+        RequestHeaders:  response.RequestHeaders,
+        RequestPayload:  request.Payload,
+        RequestBody:     request.Body,
+        ResponseStatus:  response.StatusCode,
+        ResponseHeaders: response.Headers,
+        ResponsePayload: response.Payload,
+        Latency:         response.Latency,
+    }
+    request.Interactions.Track(token, potential)
+    return potential, nil
+}
+
+// AcceptsPayload tells whether the method carries a request body, so
+// the other methods are sent once instead of once per payload.
+func AcceptsPayload(method string) bool {
+    switch method {
+    case http.MethodPost, http.MethodPut, http.MethodPatch:
+        return true
+    }
+    return false
+}
+
+// Reports tells whether the potential is reported or counts as a passing
+// check: on the expectations when the exploit declares any, on the
+// filtered response codes otherwise. Responses to the identities that
+// don't own the resource only count when they broke access control.
+func (exploit *Exploit) Reports(potential *Potential) bool {
+    if !exploit.Owns(potential) {
+        return len(potential.Failures) > 0
+    }
+    if len(exploit.Expectations) > 0 {
+        return len(potential.Failures) > 0
+    }
+    return potential.Match(exploit.FilterResponseCodes)
+}
+
+// Classify asserts the potential when the exploit has expectations, then
+// adds it to the result with the same rules as the regular responses.
+// Index is the position of the payload sent, -1 when not one of the
+// exploit payloads.
+func (exploit *Exploit) Classify(potential Potential, index int, result *ExploitResult) {
+    if len(exploit.Expectations) > 0 && exploit.Owns(&potential) {
+        if potential.Failures = potential.Assert(exploit.Expectations, index); len(potential.Failures) > 0 {
+            potential.Tag = TagContract
+        }
+    }
+    if exploit.Reports(&potential) {
+        result.Potentials = append(result.Potentials, potential)
+        return
+    }
+    result.Passed = append(result.Passed, potential)
+}
+
+// Owns tells whether the potential was sent as the owner of the resource,
+// which is always the case without identities.
+func (exploit *Exploit) Owns(potential *Potential) bool {
+    return potential.Identity == "" || potential.Identity == exploit.Owner
+}
+
+func (result *ExploitResult) Add(other ExploitResult) {
+    result.Potentials = append(result.Potentials, other.Potentials...)
+    result.Passed = append(result.Passed, other.Passed...)
+    result.Failed = append(result.Failed, other.Failed...)
+}
+
+// PrintAssertions lists the broken expectations of the run, if it had any.
+func (result *ExploitResult) PrintAssertions() {
+    const (
+        failureFormat = "FAIL %s %s\n"
+        reasonFormat  = "    %s\n"
+        summaryFormat = "Assertions: %d passed, %d failed, %d errors\n"
+    )
+    if len(result.Potentials)+len(result.Passed)+len(result.Failed) == 0 {
+        return
+    }
+    for _, potential := range result.Potentials {
+        fmt.Printf(failureFormat, potential.RequestMethod, potential.RequestURL)
+        for _, failure := range potential.Failures {
+            fmt.Printf(reasonFormat, failure)
+        }
+    }
+    fmt.Printf(summaryFormat, len(result.Passed), len(result.Potentials), len(result.Failed))
+}
+
+// Stamp marks everything in the result as part of the run.
+func (result *ExploitResult) Stamp(runID string) {
+    for i := range result.Potentials {
+        result.Potentials[i].RunID = runID
+    }
+    for i := range result.Passed {
+        result.Passed[i].RunID = runID
+    }
+    for i := range result.Failed {
+        result.Failed[i].Potential.RunID = runID
     }
-    return potentials
 }
 
 func (potential *Potential) Match(responseCodes []int) bool {
@@ -137,8 +458,12 @@ func (potential *Potential) Match(responseCodes []int) bool {
 
 func (potential *Potential) Save() error {
     const (
-        potentialInsertQuery = "insert into potentials (request_method, request_url, request_payload, response_status, response_headers, response_payload) values (?, ?, ?, ?, ?, ?);"
+        potentialInsertQuery = "insert into potentials (run_id, tag, identity, severity, request_method, request_url, request_headers, request_payload, request_body, response_status, response_headers, response_payload, latency_ms, assertions, replay_check) values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);"
     )
+    requestHeaders, err := json.Marshal(potential.RequestHeaders)
+    if err != nil {
+        return err
+    }
     requestPayload, err := json.Marshal(potential.RequestPayload)
     if err != nil {
         return err
@@ -147,14 +472,36 @@ func (potential *Potential) Save() error {
     if err != nil {
         return err
     }
+    assertions, err := json.Marshal(potential.Failures)
+    if err != nil {
+        return err
+    }
+    check, err := json.Marshal(potential.Check)
+    if err != nil {
+        return err
+    }
+    // the body is stored as sent, it may not be text
+    requestBody := potential.RequestBody
+    if requestBody == nil {
+        requestBody = []byte{}
+    }
     _, err = db.Client.Exec(
         potentialInsertQuery,
+        potential.RunID,
+        potential.Tag,
+        potential.Identity,
+        potential.Classify(),
         potential.RequestMethod,
         potential.RequestURL,
+        string(requestHeaders),
         string(requestPayload),
+        requestBody,
         potential.ResponseStatus,
         string(responseHeaders),
         string(potential.ResponsePayload),
+        potential.Latency.Nanoseconds()/int64(time.Millisecond),
+        string(assertions),
+        string(check),
     )
     if err != nil {
         return err
@@ -0,0 +1,377 @@
+package app
+
+import (
+    "fmt"
+    "sort"
+    "bytes"
+    "regexp"
+    "strings"
+    "net/url"
+    "strconv"
+    "net/http"
+    "text/template"
+    "encoding/json"
+)
+
+const (
+    ExportCurl   = "curl"
+    ExportHTTP   = "http"
+    ExportGoTest = "go"
+)
+
+var (
+    // exportPlaceholder stands in the exports for a redacted credential,
+    // read from the environment variable it names.
+    exportPlaceholder = regexp.MustCompile(`\$\{([A-Z0-9_]+)\}`)
+    nonVariable       = regexp.MustCompile(`[^A-Z0-9]+`)
+
+    goTestTemplate = template.Must(template.New("test").Funcs(template.FuncMap{
+        "quote": strconv.Quote,
+    }).Parse(`package reproduce
+
+import (
+	"net/http"
+	"net/http/httptest"
+{{- if .Env}}
+	"os"
+{{- end}}
+	"strings"
+	"testing"
+)
+{{range .Potentials}}
+// TestPotential{{.ID}} fails while potential {{.ID}} still answers {{.ResponseStatus}}.
+func TestPotential{{.ID}}(t *testing.T) {
+	request := httptest.NewRequest({{quote .RequestMethod}}, {{.GoValue .ExportURL}}, strings.NewReader({{quote .BodyText}}))
+{{- $potential := .}}
+{{- range $name, $value := .ExportHeaders}}
+	request.Header.Set({{quote $name}}, {{$potential.GoValue $value}})
+{{- end}}
+
+	// httptest builds server side requests, clearing the URI lets the
+	// client send it to the live target
+	request.RequestURI = ""
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode == {{.ResponseStatus}} {
+		t.Errorf("potential {{.ID}} reproduces: %s %s answered %d", request.Method, request.URL, response.StatusCode)
+	}
+}
+{{end}}`))
+)
+
+// Body returns the bytes sent with the request: the raw body when there
+// was one, or the JSON payload.
+func (potential *Potential) Body() []byte {
+    if potential.RequestBody != nil {
+        return potential.RequestBody
+    }
+    if potential.RequestPayload == nil {
+        return nil
+    }
+    body, err := json.Marshal(potential.RequestPayload)
+    if err != nil {
+        return nil
+    }
+    return body
+}
+
+func (potential *Potential) BodyText() string {
+    return string(potential.Body())
+}
+
+// ExportHeaders flattens the recorded headers, adding the JSON content
+// type rest sets on its own for payloads. Redacted credentials become
+// placeholders, see ExportURL.
+func (potential *Potential) ExportHeaders() map[string]string {
+    headers := make(map[string]string)
+    for name, values := range potential.RequestHeaders {
+        if len(values) == 1 && values[0] == redactedValue {
+            headers[name] = "${" + envVariable(name) + "}"
+            continue
+        }
+        headers[name] = strings.Join(values, ", ")
+    }
+    if potential.RequestBody == nil && potential.RequestPayload != nil {
+        setDefaultHeader(headers, "Content-Type", "application/json")
+    }
+    return headers
+}
+
+// ExportURL returns the recorded URL with the redacted credentials as
+// ${NAME} placeholders, which each export reads from the environment:
+// AUTH for the Authorization header, the header or parameter name in
+// upper snake case otherwise.
+func (potential *Potential) ExportURL() string {
+    parsed, err := url.Parse(potential.RequestURL)
+    if err != nil || !strings.Contains(parsed.RawQuery, redactedValue) {
+        return potential.RequestURL
+    }
+    target := potential.RequestURL
+    for name, values := range parsed.Query() {
+        if len(values) == 1 && values[0] == redactedValue {
+            // Redact masked the parameter encoded this way
+            redacted := url.Values{name: {redactedValue}}.Encode()
+            target = strings.Replace(target, redacted, url.QueryEscape(name)+"=${"+envVariable(name)+"}", -1)
+        }
+    }
+    return target
+}
+
+// envVariables names the environment variables of the placeholders.
+func (potential *Potential) envVariables() map[string]bool {
+    variables := make(map[string]bool)
+    for name, values := range potential.RequestHeaders {
+        if len(values) == 1 && values[0] == redactedValue {
+            variables[envVariable(name)] = true
+        }
+    }
+    if parsed, err := url.Parse(potential.RequestURL); err == nil {
+        for name, values := range parsed.Query() {
+            if len(values) == 1 && values[0] == redactedValue {
+                variables[envVariable(name)] = true
+            }
+        }
+    }
+    return variables
+}
+
+// envParts cuts a value around its placeholders: literal text at even
+// indexes, variable names at odd ones.
+func (potential *Potential) envParts(value string) []string {
+    variables := potential.envVariables()
+    parts := make([]string, 0, 1)
+    last := 0
+    for _, match := range exportPlaceholder.FindAllStringSubmatchIndex(value, -1) {
+        if !variables[value[match[2]:match[3]]] {
+            continue
+        }
+        parts = append(parts, value[last:match[0]], value[match[2]:match[3]])
+        last = match[1]
+    }
+    return append(parts, value[last:])
+}
+
+// shellValue quotes the value for the shell, leaving the placeholders
+// for it to expand.
+func (potential *Potential) shellValue(value string) string {
+    parts := potential.envParts(value)
+    quoted := make([]string, 0, len(parts))
+    for i, part := range parts {
+        if i%2 == 1 {
+            quoted = append(quoted, `"${`+part+`}"`)
+        } else if part != "" || len(parts) == 1 {
+            quoted = append(quoted, shellQuote(part))
+        }
+    }
+    return strings.Join(quoted, "")
+}
+
+// GoValue writes the value as a Go expression, reading the placeholders
+// with os.Getenv.
+func (potential *Potential) GoValue(value string) string {
+    parts := potential.envParts(value)
+    quoted := make([]string, 0, len(parts))
+    for i, part := range parts {
+        if i%2 == 1 {
+            quoted = append(quoted, "os.Getenv("+strconv.Quote(part)+")")
+        } else if part != "" || len(parts) == 1 {
+            quoted = append(quoted, strconv.Quote(part))
+        }
+    }
+    return strings.Join(quoted, " + ")
+}
+
+// httpValue writes the placeholders the {{NAME}} way of the HTTP file
+// clients.
+func (potential *Potential) httpValue(value string) string {
+    parts := potential.envParts(value)
+    for i := 1; i < len(parts); i += 2 {
+        parts[i] = "{{" + parts[i] + "}}"
+    }
+    return strings.Join(parts, "")
+}
+
+func envVariable(name string) string {
+    if strings.EqualFold(name, "Authorization") {
+        return "AUTH"
+    }
+    return strings.Trim(nonVariable.ReplaceAllString(strings.ToUpper(name), "_"), "_")
+}
+
+func (potential *Potential) sortedHeaders() ([]string, map[string]string) {
+    headers := potential.ExportHeaders()
+    names := make([]string, 0, len(headers))
+    for name := range headers {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+    return names, headers
+}
+
+// Rebuildable tells why the potential can't be sent again as an HTTP
+// request, as raw writes, WebSocket messages and gRPC calls can't, nil
+// when it can.
+func (potential *Potential) Rebuildable() error {
+    const (
+        errNotHTTP = "potential %d was sent as %s, not as an HTTP request"
+    )
+    switch potential.RequestMethod {
+    case rawMethod, webSocketMethod, grpcMethod:
+        return fmt.Errorf(errNotHTTP, potential.ID, potential.RequestMethod)
+    }
+    return nil
+}
+
+// Request rebuilds the request that produced the potential, less the
+// credentials redacted from its recording.
+func (potential *Potential) Request() (*Request, error) {
+    if err := potential.Rebuildable(); err != nil {
+        return nil, err
+    }
+    headers, target := Unredact(potential.RequestHeaders, potential.RequestURL)
+    request := &Request{
+        Method:  potential.RequestMethod,
+        URL:     target,
+        Headers: headers,
+        Payload: potential.RequestPayload,
+        Body:    potential.RequestBody,
+    }
+    return request, nil
+}
+
+// Curl writes the request as a curl command, empty for potentials that
+// were not sent as HTTP requests.
+func (potential *Potential) Curl() string {
+    if potential.Rebuildable() != nil {
+        return ""
+    }
+    var command strings.Builder
+    // with -X HEAD curl waits for a body that never comes
+    if potential.RequestMethod == http.MethodHead {
+        command.WriteString("curl -I " + potential.shellValue(potential.ExportURL()))
+    } else {
+        command.WriteString("curl -X " + shellQuote(potential.RequestMethod) + " " + potential.shellValue(potential.ExportURL()))
+    }
+    names, headers := potential.sortedHeaders()
+    for _, name := range names {
+        command.WriteString(" \\\n  -H " + potential.shellValue(name+": "+headers[name]))
+    }
+    if body := potential.Body(); body != nil {
+        command.WriteString(" \\\n  --data-binary " + shellQuote(string(body)))
+    }
+    return command.String()
+}
+
+// Sent writes what was sent for the reports: the curl command, or the
+// method, URL and body as recorded for what curl can't send.
+func (potential *Potential) Sent() string {
+    if curl := potential.Curl(); curl != "" {
+        return curl
+    }
+    return potential.RequestMethod + " " + potential.RequestURL + "\n\n" + potential.BodyText()
+}
+
+func (potential *Potential) HTTP() (string, error) {
+    if err := potential.Rebuildable(); err != nil {
+        return "", err
+    }
+    target, err := url.Parse(potential.RequestURL)
+    if err != nil {
+        return "", err
+    }
+    // the request URI of the exported URL keeps the placeholders as typed
+    requestURI := strings.TrimPrefix(potential.ExportURL(), target.Scheme+"://"+target.Host)
+    if requestURI == "" {
+        requestURI = "/"
+    }
+    var raw strings.Builder
+    raw.WriteString(fmt.Sprintf("%s %s HTTP/1.1\r\n", potential.RequestMethod, potential.httpValue(requestURI)))
+    raw.WriteString("Host: " + target.Host + "\r\n")
+    names, headers := potential.sortedHeaders()
+    for _, name := range names {
+        raw.WriteString(name + ": " + potential.httpValue(headers[name]) + "\r\n")
+    }
+    body := potential.Body()
+    if body != nil {
+        raw.WriteString("Content-Length: " + strconv.Itoa(len(body)) + "\r\n")
+    }
+    raw.WriteString("\r\n")
+    raw.Write(body)
+    return raw.String(), nil
+}
+
+func GoTest(potentials []Potential) (string, error) {
+    env := false
+    for _, potential := range potentials {
+        if err := potential.Rebuildable(); err != nil {
+            return "", err
+        }
+        env = env || len(potential.envVariables()) > 0
+    }
+    data := struct {
+        Potentials []Potential
+        Env        bool
+    }{potentials, env}
+    var buffer bytes.Buffer
+    if err := goTestTemplate.Execute(&buffer, data); err != nil {
+        return "", err
+    }
+    return buffer.String(), nil
+}
+
+func Curls(potentials []Potential) (string, error) {
+    const (
+        curlFormat = "# potential %d\n%s\n"
+    )
+    exported := make([]string, 0, len(potentials))
+    for _, potential := range potentials {
+        if err := potential.Rebuildable(); err != nil {
+            return "", err
+        }
+        exported = append(exported, fmt.Sprintf(curlFormat, potential.ID, potential.Curl()))
+    }
+    return strings.Join(exported, "\n"), nil
+}
+
+// HTTPFile lays the requests out the way the http importer reads them.
+func HTTPFile(potentials []Potential) (string, error) {
+    exported := make([]string, 0, len(potentials))
+    for _, potential := range potentials {
+        raw, err := potential.HTTP()
+        if err != nil {
+            return "", err
+        }
+        exported = append(exported, raw)
+    }
+    return strings.Join(exported, "\n"+httpFileSeparator+"\n") + "\n", nil
+}
+
+func Export(potentials []Potential, format string) (string, error) {
+    const (
+        errUnknownExport = "unknown export format %s"
+    )
+    switch format {
+    case ExportCurl:
+        return Curls(potentials)
+    case ExportHTTP:
+        return HTTPFile(potentials)
+    case ExportGoTest:
+        return GoTest(potentials)
+    case ExportJUnit, ExportSARIF, ExportHTML:
+        report := &Report{
+            Potentials: potentials,
+        }
+        rendered, err := report.Render(format)
+        return string(rendered), err
+    }
+    return "", fmt.Errorf(errUnknownExport, format)
+}
+
+func shellQuote(value string) string {
+    return "'" + strings.Replace(value, "'", `'\''`, -1) + "'"
+}
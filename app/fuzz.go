@@ -0,0 +1,113 @@
+package app
+
+import (
+    "regexp"
+    "strings"
+    "net/url"
+    "unicode/utf8"
+    "encoding/json"
+)
+
+var (
+    // the values every injection point, field and argument gets when
+    // the config names none
+    defaultFuzzValues = []string{"'", `"`, "' OR '1'='1", "../../../../etc/passwd", "<script>alert(1)</script>", "-1", "0", "2147483648", "9223372036854775807", "1e308"}
+
+    // injectionMarker delimits an injection point and its default value,
+    // as in §value§.
+    injectionMarker = regexp.MustCompile(`§([^§]*)§`)
+)
+
+// FuzzValuesOrDefault returns the configured fuzz values, or the default
+// ones when the config has none.
+func (config *Config) FuzzValuesOrDefault() []string {
+    if len(config.FuzzValues) == 0 {
+        return defaultFuzzValues
+    }
+    return config.FuzzValues
+}
+
+// Variants expands the injection points of the operation. The first variant
+// sends every default value; then each point in turn receives every fuzz
+// value while the others keep their defaults. Values going into the url
+// are escaped for the path or the query, where they land.
+func (operation Operation) Variants(values []string) []Operation {
+    // variants are reported under the operation they come from, so the
+    // ID is left out of the injection points
+    seed := operation
+    seed.ID = ""
+    // markers in encoded bodies, as multipart forms are, only show once
+    // decoded
+    if seed.Encoding == EncodingBase64 {
+        if body, err := seed.BodyBytes(); err == nil && utf8.Valid(body) {
+            seed.Body, seed.Encoding = string(body), EncodingText
+        }
+    }
+    bytes, err := json.Marshal(seed)
+    if err != nil {
+        return []Operation{operation}
+    }
+    text := string(bytes)
+    markers := injectionMarker.FindAllStringSubmatchIndex(text, -1)
+    if len(markers) == 0 {
+        return []Operation{operation}
+    }
+
+    // where the url sits in the serialized operation, and its query
+    quoted, _ := json.Marshal(seed.URL)
+    urlStart := strings.Index(text, `"url":`+string(quoted)) + len(`"url":`)
+    urlEnd := urlStart + len(quoted)
+    queryStart := urlEnd
+    if i := strings.IndexByte(text[urlStart:urlEnd], '?'); i >= 0 {
+        queryStart = urlStart + i
+    }
+
+    variants := make([]Operation, 0, 1+len(markers)*len(values))
+    if variant, ok := injectVariant(text, markers, -1, ""); ok {
+        variants = append(variants, variant)
+    }
+    for target, marker := range markers {
+        for _, value := range values {
+            switch {
+            case marker[0] > queryStart && marker[0] < urlEnd:
+                value = url.QueryEscape(value)
+            case marker[0] > urlStart && marker[0] < urlEnd:
+                value = url.PathEscape(value)
+            }
+            if variant, ok := injectVariant(text, markers, target, value); ok {
+                variants = append(variants, variant)
+            }
+        }
+    }
+    for i := range variants {
+        variants[i].ID = operation.ID
+    }
+    return variants
+}
+
+// injectVariant rewrites the serialized operation, so every field holding
+// markers is covered, and escapes the injected value as a JSON string.
+func injectVariant(text string, markers [][]int, target int, value string) (Operation, bool) {
+    escaped, err := json.Marshal(value)
+    if err != nil {
+        return Operation{}, false
+    }
+    result := make([]byte, 0, len(text))
+    last := 0
+    for i, marker := range markers {
+        result = append(result, text[last:marker[0]]...)
+        if i == target {
+            result = append(result, escaped[1:len(escaped)-1]...)
+        } else {
+            result = append(result, text[marker[2]:marker[3]]...)
+        }
+        last = marker[1]
+    }
+    result = append(result, text[last:]...)
+
+    var variant Operation
+    if err := json.Unmarshal(result, &variant); err != nil {
+        return Operation{}, false
+    }
+    return variant, true
+}
@@ -0,0 +1,327 @@
+package app
+
+import (
+    "fmt"
+    "sync"
+    "regexp"
+    "strings"
+    "strconv"
+    "net/http"
+    "encoding/json"
+)
+
+const (
+    TagGraphQLError         = "graphql-error"
+    TagGraphQLErrorLeak     = "graphql-error-leak"
+    TagGraphQLSensitiveData = "graphql-sensitive-data"
+    TagGraphQLIntrospection = "graphql-introspection"
+    TagGraphQLDepth         = "graphql-depth-limit"
+    TagGraphQLAlias         = "graphql-alias-abuse"
+    TagGraphQLBatching      = "graphql-batching"
+
+    graphQLIntrospection = "introspection"
+    graphQLQuery         = "query"
+    graphQLMutation      = "mutation"
+    graphQLNesting       = "depth"
+    graphQLAliases       = "alias"
+    graphQLBatch         = "batch"
+
+    defaultGraphQLDepth   = 10
+    defaultGraphQLAliases = 100
+    defaultGraphQLBatch   = 10
+)
+
+var (
+    // graphQLLeak matches the internals unhandled errors give away:
+    // exceptions, stack frames, SQL errors and server paths.
+    graphQLLeak = regexp.MustCompile(`(?i)(stack ?trace|traceback|exception|\bat [\w$.<>]+ ?\([^)]*:\d+|\.(java|py|js|ts|go|rb|php|cs):\d+|sql syntax|syntax error at or near|ORA-\d{5}|SQLSTATE|/(usr|home|var|app|srv|opt)/[\w./-]+)`)
+    graphQLSensitive = regexp.MustCompile(`(?i)^(password|passwd|secret|.*token|api_?key|ssn|credit_?card|card_?number|private_?key|.*hash|salt)$`)
+)
+
+// GraphQLTest fuzzes a GraphQL endpoint: every query and mutation field
+// with fuzzed arguments, then queries abusing the lack of depth, alias
+// and batching limits. The schema comes from introspection, or from
+// Schema, an introspection result or SDL file, when set.
+type GraphQLTest struct {
+    URL           string `json:"url"`
+    Schema        string `json:"schema,omitempty"`
+    SkipMutations bool   `json:"skip_mutations,omitempty"`
+    Depth         int    `json:"depth,omitempty"`
+    Aliases       int    `json:"aliases,omitempty"`
+    Batch         int    `json:"batch,omitempty"`
+}
+
+// GraphQLCase is a document sent to the endpoint and what it tests:
+// the field called, with a fuzz value in Argument if any, or the
+// nesting, aliases or batch size Expected to be refused.
+type GraphQLCase struct {
+    Exploit  *Exploit
+    Kind     string
+    Field    string
+    Argument string
+    Document interface{}
+    Expected int
+}
+
+// BuildGraphQLCases gets the schema of every GraphQL endpoint and
+// generates its cases. The introspection requests are results too, as
+// leaving introspection on is a finding of its own.
+func (config *Config) BuildGraphQLCases() ([]*GraphQLCase, []ExploitResult, error) {
+    const (
+        errSchema        = "error loading graphql schema %s: %v"
+        errIntrospection = "introspection failed: %v"
+    )
+    cases := make([]*GraphQLCase, 0)
+    results := make([]ExploitResult, 0)
+    fuzzValues := config.FuzzValuesOrDefault()
+    for _, test := range config.GraphQL {
+        target := test.URL
+        if !strings.Contains(target, "://") {
+            target = config.BaseURL + target
+        }
+        exploit := config.BuildExploit(Endpoint{Path: test.URL}, target)
+
+        var schema *GraphQLSchema
+        if test.Schema != "" {
+            loaded, err := LoadGraphQLSchema(test.Schema)
+            if err != nil {
+                return nil, nil, fmt.Errorf(errSchema, test.Schema, err)
+            }
+            schema = loaded
+        } else {
+            introspection := &GraphQLCase{
+                Exploit:  exploit,
+                Kind:     graphQLIntrospection,
+                Document: map[string]interface{}{"query": introspectionQuery},
+            }
+            result := introspection.Run()
+            results = append(results, result)
+            responses := append(append(ExploitPotentials{}, result.Potentials...), result.Passed...)
+            if len(responses) == 0 {
+                continue
+            }
+            introspected, err := ParseIntrospection(responses[0].ResponsePayload)
+            if err != nil {
+                results = append(results, ExploitResult{
+                    Failed: []FailedRequest{{Potential: responses[0], Err: fmt.Sprintf(errIntrospection, err)}},
+                })
+                continue
+            }
+            schema = introspected
+        }
+        cases = append(cases, test.Cases(exploit, schema, fuzzValues)...)
+    }
+    return cases, results, nil
+}
+
+// Cases calls every root field once with plain arguments and once per
+// argument and fitting fuzz value, then adds the abuse cases.
+func (test *GraphQLTest) Cases(exploit *Exploit, schema *GraphQLSchema, fuzzValues []string) []*GraphQLCase {
+    cases := make([]*GraphQLCase, 0)
+    add := func(kind string, field string, argument string, query interface{}, expected int) {
+        document := query
+        if text, ok := query.(string); ok {
+            document = map[string]interface{}{"query": text}
+        }
+        cases = append(cases, &GraphQLCase{Exploit: exploit, Kind: kind, Field: field, Argument: argument, Document: document, Expected: expected})
+    }
+
+    operations := []string{graphQLQuery}
+    if !test.SkipMutations {
+        operations = append(operations, graphQLMutation)
+    }
+    for _, operation := range operations {
+        root := schema.Root(operation)
+        if root == nil {
+            continue
+        }
+        for i := range root.Fields {
+            field := &root.Fields[i]
+            add(operation, field.Name, "", schema.Query(operation, field, -1, nil), 0)
+            for target, arg := range field.Args {
+                for _, value := range fuzzValues {
+                    value := value
+                    if schema.Accepts(&arg.Type, value) {
+                        add(operation, field.Name, arg.Name, schema.Query(operation, field, target, &value), 0)
+                    }
+                }
+            }
+        }
+    }
+
+    if query, levels := schema.NestedQuery(orDefaultInt(test.Depth, defaultGraphQLDepth)); query != "" {
+        add(graphQLNesting, "", "", query, levels)
+    }
+    aliases := orDefaultInt(test.Aliases, defaultGraphQLAliases)
+    if query, field := schema.AliasQuery(aliases); query != "" {
+        add(graphQLAliases, field, "", query, aliases)
+    }
+    batch := make([]map[string]interface{}, orDefaultInt(test.Batch, defaultGraphQLBatch))
+    for i := range batch {
+        batch[i] = map[string]interface{}{"query": "query { __typename }"}
+    }
+    add(graphQLBatch, "", "", batch, len(batch))
+    return cases
+}
+
+func containsString(values []string, value string) bool {
+    for _, candidate := range values {
+        if candidate == value {
+            return true
+        }
+    }
+    return false
+}
+
+func orDefaultInt(value int, fallback int) int {
+    if value == 0 {
+        return fallback
+    }
+    return value
+}
+
+func (graphCase *GraphQLCase) AsyncExecute(group *sync.WaitGroup, limiter chan bool, out chan ExploitResult) {
+    defer group.Done()
+    out <- graphCase.Run()
+    <-limiter
+}
+
+// Run posts the document and analyzes the response.
+func (graphCase *GraphQLCase) Run() ExploitResult {
+    result := ExploitResult{
+        Potentials: make(ExploitPotentials, 0),
+        Passed:     make(ExploitPotentials, 0),
+        Failed:     make([]FailedRequest, 0),
+    }
+    body, err := json.Marshal(graphCase.Document)
+    if err != nil {
+        result.Failed = append(result.Failed, FailedRequest{Err: err.Error()})
+        return result
+    }
+    request := graphCase.Exploit.Request(http.MethodPost)
+    if request.Headers == nil {
+        request.Headers = make(http.Header)
+    }
+    request.Headers.Set("Content-Type", "application/json")
+    request.Body = body
+    potential, failure := request.Send()
+    if failure != nil {
+        result.Failed = append(result.Failed, *failure)
+        return result
+    }
+    graphCase.Analyze(&potential)
+    potential.Check = &Check{Kind: CheckGraphQL, Args: map[string]string{
+        "kind":     graphCase.Kind,
+        "field":    graphCase.Field,
+        "argument": graphCase.Argument,
+        "expected": strconv.Itoa(graphCase.Expected),
+    }}
+    result.Flag(potential)
+    return result
+}
+
+// Analyze flags what the response gives away: unhandled and leaking
+// errors, sensitive fields, introspection, and abuse the endpoint did
+// not limit.
+func (graphCase *GraphQLCase) Analyze(potential *Potential) {
+    const (
+        errServer        = "%s answered %d"
+        errLeak          = "%s error leaks %s"
+        errSensitive     = "%s returns %s"
+        errIntrospection = "introspection is enabled"
+        errNesting       = "query nested %d levels deep answered"
+        errAliases       = "%d aliases of %s answered"
+        errBatch         = "batch of %d queries answered"
+    )
+    operation := strings.TrimSpace(graphCase.Kind + " " + graphCase.Field)
+    if graphCase.Argument != "" {
+        operation += "(" + graphCase.Argument + ")"
+    }
+    if potential.ResponseStatus/100 == 5 {
+        flagGraphQL(potential, TagGraphQLError, SeverityHigh, fmt.Sprintf(errServer, operation, potential.ResponseStatus))
+    }
+    var response interface{}
+    if err := json.Unmarshal(potential.ResponsePayload, &response); err != nil {
+        return
+    }
+    if batch, ok := response.([]interface{}); ok {
+        if graphCase.Kind == graphQLBatch && len(batch) >= graphCase.Expected {
+            flagGraphQL(potential, TagGraphQLBatching, SeverityLow, fmt.Sprintf(errBatch, len(batch)))
+        }
+        return
+    }
+    document, ok := response.(map[string]interface{})
+    if !ok {
+        return
+    }
+    errs, data := document["errors"], document["data"]
+    if errs != nil {
+        leaks := make([]string, 0)
+        for _, leak := range graphQLLeak.FindAllString(jsonText(errs), -1) {
+            if !containsString(leaks, leak) {
+                leaks = append(leaks, leak)
+            }
+        }
+        if len(leaks) > 0 {
+            flagGraphQL(potential, TagGraphQLErrorLeak, SeverityMedium, fmt.Sprintf(errLeak, operation, strings.Join(leaks, ", ")))
+        }
+    }
+    answered, _ := data.(map[string]interface{})
+    switch graphCase.Kind {
+    case graphQLIntrospection:
+        if answered["__schema"] != nil {
+            flagGraphQL(potential, TagGraphQLIntrospection, SeverityLow, errIntrospection)
+        }
+    case graphQLNesting:
+        if answered != nil && errs == nil {
+            flagGraphQL(potential, TagGraphQLDepth, SeverityMedium, fmt.Sprintf(errNesting, graphCase.Expected))
+        }
+    case graphQLAliases:
+        if len(answered) >= graphCase.Expected {
+            flagGraphQL(potential, TagGraphQLAlias, SeverityLow, fmt.Sprintf(errAliases, len(answered), graphCase.Field))
+        }
+    case graphQLQuery, graphQLMutation:
+        // the fields hold the same whatever the fuzz values, so they
+        // are reported once, on the plain call
+        if graphCase.Argument != "" {
+            break
+        }
+        if fields := sensitiveFields(data, make([]string, 0)); len(fields) > 0 {
+            flagGraphQL(potential, TagGraphQLSensitiveData, SeverityMedium, fmt.Sprintf(errSensitive, operation, strings.Join(fields, ", ")))
+        }
+    }
+}
+
+// flagGraphQL adds the finding, the potential keeping the tag of the
+// most severe one.
+func flagGraphQL(potential *Potential, tag string, severity string, message string) {
+    if potential.Tag == "" || !SeverityAtLeast(potential.Severity, severity) {
+        potential.Tag, potential.Severity = tag, severity
+    }
+    potential.Failures = append(potential.Failures, message)
+}
+
+// sensitiveFields lists the fields of the data named like secrets that
+// hold a value.
+func sensitiveFields(value interface{}, found []string) []string {
+    switch typed := value.(type) {
+    case map[string]interface{}:
+        for _, name := range sortedKeys(typed) {
+            item := typed[name]
+            if graphQLSensitive.MatchString(name) && item != nil && item != "" {
+                if _, nested := item.(map[string]interface{}); !nested {
+                    if !containsString(found, name) {
+                        found = append(found, name)
+                    }
+                    continue
+                }
+            }
+            found = sensitiveFields(item, found)
+        }
+    case []interface{}:
+        for _, item := range typed {
+            found = sensitiveFields(item, found)
+        }
+    }
+    return found
+}
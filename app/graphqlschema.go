@@ -0,0 +1,365 @@
+package app
+
+import (
+    "fmt"
+    "errors"
+    "strconv"
+    "strings"
+    "io/ioutil"
+    "encoding/json"
+)
+
+const (
+    graphQLNonNull = "NON_NULL"
+    graphQLList    = "LIST"
+    graphQLScalar  = "SCALAR"
+    graphQLObject  = "OBJECT"
+    graphQLInput   = "INPUT_OBJECT"
+    graphQLEnum    = "ENUM"
+    graphQLIface   = "INTERFACE"
+    graphQLUnion   = "UNION"
+
+    // deep enough for the type references of any sane schema
+    introspectionQuery = `query IntrospectionQuery { __schema { queryType { name } mutationType { name } types { kind name fields(includeDeprecated: true) { name args { name type { ...TypeRef } } type { ...TypeRef } } inputFields { name type { ...TypeRef } } enumValues(includeDeprecated: true) { name } } } }
+fragment TypeRef on __Type { kind name ofType { kind name ofType { kind name ofType { kind name ofType { kind name ofType { kind name ofType { kind name ofType { kind name } } } } } } } }`
+)
+
+var (
+    graphQLBuiltinScalars = []string{"Int", "Float", "String", "Boolean", "ID"}
+)
+
+// GraphQLSchema is the part of an introspection result the queries are
+// generated from. Schema files in SDL are read into the same shape.
+type GraphQLSchema struct {
+    QueryType    *GraphQLNamed `json:"queryType"`
+    MutationType *GraphQLNamed `json:"mutationType"`
+    Types        []GraphQLType `json:"types"`
+
+    index map[string]*GraphQLType
+}
+
+type GraphQLNamed struct {
+    Name string `json:"name"`
+}
+
+type GraphQLType struct {
+    Kind        string         `json:"kind"`
+    Name        string         `json:"name"`
+    Fields      []GraphQLField `json:"fields"`
+    InputFields []GraphQLInput `json:"inputFields"`
+    EnumValues  []GraphQLNamed `json:"enumValues"`
+}
+
+type GraphQLField struct {
+    Name string         `json:"name"`
+    Args []GraphQLInput `json:"args"`
+    Type GraphQLTypeRef `json:"type"`
+}
+
+type GraphQLInput struct {
+    Name string         `json:"name"`
+    Type GraphQLTypeRef `json:"type"`
+}
+
+// GraphQLTypeRef is a named type, possibly wrapped as non null or list.
+type GraphQLTypeRef struct {
+    Kind   string          `json:"kind"`
+    Name   string          `json:"name"`
+    OfType *GraphQLTypeRef `json:"ofType"`
+}
+
+// ParseIntrospection reads an introspection response, with or without
+// its data envelope.
+func ParseIntrospection(bytes []byte) (*GraphQLSchema, error) {
+    const (
+        errNoSchema = "no __schema in introspection result"
+    )
+    var document struct {
+        Data struct {
+            Schema *GraphQLSchema `json:"__schema"`
+        } `json:"data"`
+        Schema *GraphQLSchema `json:"__schema"`
+    }
+    if err := json.Unmarshal(bytes, &document); err != nil {
+        return nil, err
+    }
+    schema := document.Data.Schema
+    if schema == nil {
+        schema = document.Schema
+    }
+    if schema == nil || len(schema.Types) == 0 {
+        return nil, errors.New(errNoSchema)
+    }
+    return schema, nil
+}
+
+// LoadGraphQLSchema reads a schema file: an introspection result when it
+// is JSON, SDL otherwise.
+func LoadGraphQLSchema(path string) (*GraphQLSchema, error) {
+    bytes, err := ioutil.ReadFile(path)
+    if err != nil {
+        return nil, err
+    }
+    if strings.HasPrefix(strings.TrimSpace(string(bytes)), "{") {
+        return ParseIntrospection(bytes)
+    }
+    return ParseSDL(string(bytes))
+}
+
+// Type finds the named type, builtin scalars included.
+func (schema *GraphQLSchema) Type(name string) *GraphQLType {
+    if schema.index == nil {
+        schema.index = make(map[string]*GraphQLType, len(schema.Types))
+        for i := range schema.Types {
+            schema.index[schema.Types[i].Name] = &schema.Types[i]
+        }
+        for _, scalar := range graphQLBuiltinScalars {
+            if _, ok := schema.index[scalar]; !ok {
+                schema.index[scalar] = &GraphQLType{Kind: graphQLScalar, Name: scalar}
+            }
+        }
+    }
+    return schema.index[name]
+}
+
+// Root finds the query or mutation type.
+func (schema *GraphQLSchema) Root(operation string) *GraphQLType {
+    root := schema.QueryType
+    if operation == "mutation" {
+        root = schema.MutationType
+    }
+    if root == nil {
+        return nil
+    }
+    return schema.Type(root.Name)
+}
+
+// Named unwraps the reference down to the type it names.
+func (ref *GraphQLTypeRef) Named() string {
+    for ref.OfType != nil && ref.Name == "" {
+        ref = ref.OfType
+    }
+    return ref.Name
+}
+
+func (ref *GraphQLTypeRef) Required() bool {
+    return ref.Kind == graphQLNonNull
+}
+
+func (ref *GraphQLTypeRef) String() string {
+    switch ref.Kind {
+    case graphQLNonNull:
+        return ref.OfType.String() + "!"
+    case graphQLList:
+        return "[" + ref.OfType.String() + "]"
+    }
+    return ref.Name
+}
+
+// Literal writes a value of the input type: the fuzz value for scalars
+// when one is given, a plain valid value otherwise. Input objects get
+// their required fields, as deep as it takes.
+func (schema *GraphQLSchema) Literal(ref *GraphQLTypeRef, fuzz *string, depth int) string {
+    switch ref.Kind {
+    case graphQLNonNull:
+        return schema.Literal(ref.OfType, fuzz, depth)
+    case graphQLList:
+        return "[" + schema.Literal(ref.OfType, fuzz, depth) + "]"
+    }
+    named := schema.Type(ref.Name)
+    if named == nil {
+        return "null"
+    }
+    switch named.Kind {
+    case graphQLEnum:
+        if len(named.EnumValues) == 0 {
+            return "null"
+        }
+        return named.EnumValues[0].Name
+    case graphQLInput:
+        if depth > 3 {
+            return "null"
+        }
+        fields := make([]string, 0, len(named.InputFields))
+        for _, field := range named.InputFields {
+            if field.Type.Required() {
+                fields = append(fields, field.Name+": "+schema.Literal(&field.Type, nil, depth+1))
+            }
+        }
+        return "{" + strings.Join(fields, ", ") + "}"
+    }
+    switch named.Name {
+    case "Int":
+        if fuzz != nil {
+            return *fuzz
+        }
+        return "1"
+    case "Float":
+        if fuzz != nil {
+            return *fuzz
+        }
+        return "1.5"
+    case "Boolean":
+        return "true"
+    }
+    value := "test"
+    if fuzz != nil {
+        value = *fuzz
+    }
+    quoted, _ := json.Marshal(value)
+    return string(quoted)
+}
+
+// Accepts tells whether the fuzz value fits the argument: numeric
+// arguments only take numbers, booleans and enums nothing.
+func (schema *GraphQLSchema) Accepts(ref *GraphQLTypeRef, value string) bool {
+    named := schema.Type(ref.Named())
+    if named == nil || named.Kind != graphQLScalar {
+        return false
+    }
+    switch named.Name {
+    case "Int":
+        _, err := strconv.ParseInt(value, 10, 64)
+        return err == nil
+    case "Float":
+        _, err := strconv.ParseFloat(value, 64)
+        return err == nil
+    case "Boolean":
+        return false
+    }
+    return true
+}
+
+// Selection writes the selection set of the output type: its scalar
+// fields taking no required arguments, and those of the objects below
+// for another depth levels.
+func (schema *GraphQLSchema) Selection(ref *GraphQLTypeRef, depth int) string {
+    named := schema.Type(ref.Named())
+    if named == nil {
+        return ""
+    }
+    switch named.Kind {
+    case graphQLScalar, graphQLEnum:
+        return ""
+    case graphQLUnion:
+        return " { __typename }"
+    }
+    fields := make([]string, 0, len(named.Fields))
+    for _, field := range named.Fields {
+        if field.RequiresArgs() {
+            continue
+        }
+        child := schema.Type(field.Type.Named())
+        if child == nil {
+            continue
+        }
+        switch {
+        case child.Kind == graphQLScalar || child.Kind == graphQLEnum:
+            fields = append(fields, field.Name)
+        case depth > 0:
+            fields = append(fields, field.Name+schema.Selection(&field.Type, depth-1))
+        }
+    }
+    if len(fields) == 0 {
+        return " { __typename }"
+    }
+    return " { " + strings.Join(fields, " ") + " }"
+}
+
+func (field *GraphQLField) RequiresArgs() bool {
+    for _, arg := range field.Args {
+        if arg.Type.Required() {
+            return true
+        }
+    }
+    return false
+}
+
+// Query writes the operation calling the field, with the fuzz value in
+// the argument at target and plain values in the others.
+func (schema *GraphQLSchema) Query(operation string, field *GraphQLField, target int, fuzz *string) string {
+    args := make([]string, 0, len(field.Args))
+    for i, arg := range field.Args {
+        if i == target {
+            args = append(args, arg.Name+": "+schema.Literal(&arg.Type, fuzz, 0))
+        } else if arg.Type.Required() {
+            args = append(args, arg.Name+": "+schema.Literal(&arg.Type, nil, 0))
+        }
+    }
+    call := field.Name
+    if len(args) > 0 {
+        call += "(" + strings.Join(args, ", ") + ")"
+    }
+    return operation + " { " + call + schema.Selection(&field.Type, 1) + " }"
+}
+
+// NestedQuery follows object fields down to the depth, looping through
+// the types that reference each other, as queries abusing the lack of a
+// depth limit do. It is empty when no path goes that deep, a schema
+// without cycles not needing a limit.
+func (schema *GraphQLSchema) NestedQuery(depth int) (string, int) {
+    root := schema.Root("query")
+    if root == nil || depth < 1 {
+        return "", 0
+    }
+    path := schema.objectPath(root, depth, make(map[string]int))
+    if path == nil {
+        return "", 0
+    }
+    var builder strings.Builder
+    builder.WriteString("query {")
+    for _, field := range path {
+        builder.WriteString(" " + field.Name + " {")
+    }
+    builder.WriteString(" __typename")
+    builder.WriteString(strings.Repeat(" }", len(path)+1))
+    return builder.String(), len(path)
+}
+
+// objectPath finds fields without required arguments leading from the
+// type through depth objects, nil when there is none. Failed keeps the
+// least depth each type was found not to reach.
+func (schema *GraphQLSchema) objectPath(parent *GraphQLType, depth int, failed map[string]int) []*GraphQLField {
+    if depth == 0 {
+        return []*GraphQLField{}
+    }
+    if least, ok := failed[parent.Name]; ok && depth >= least {
+        return nil
+    }
+    for i := range parent.Fields {
+        field := &parent.Fields[i]
+        if field.RequiresArgs() {
+            continue
+        }
+        named := schema.Type(field.Type.Named())
+        if named == nil || (named.Kind != graphQLObject && named.Kind != graphQLIface) {
+            continue
+        }
+        if path := schema.objectPath(named, depth-1, failed); path != nil {
+            return append([]*GraphQLField{field}, path...)
+        }
+    }
+    failed[parent.Name] = depth
+    return nil
+}
+
+// AliasQuery repeats the cheapest query field under count aliases.
+func (schema *GraphQLSchema) AliasQuery(count int) (string, string) {
+    root := schema.Root("query")
+    if root == nil {
+        return "", ""
+    }
+    for i := range root.Fields {
+        field := &root.Fields[i]
+        if field.RequiresArgs() {
+            continue
+        }
+        selection := schema.Selection(&field.Type, 0)
+        aliases := make([]string, 0, count)
+        for alias := 0; alias < count; alias++ {
+            aliases = append(aliases, fmt.Sprintf("a%d: %s%s", alias, field.Name, selection))
+        }
+        return "query { " + strings.Join(aliases, " ") + " }", field.Name
+    }
+    return "", ""
+}
@@ -0,0 +1,335 @@
+package app
+
+import (
+    "fmt"
+    "strings"
+)
+
+// sdlParser reads the type definitions of a GraphQL schema in SDL, the
+// parts queries are generated from. Descriptions, directives, default
+// values and interface lists are read past.
+type sdlParser struct {
+    tokens   []string
+    position int
+}
+
+// ParseSDL reads a schema in SDL. Without a schema definition the roots
+// are the Query and Mutation types.
+func ParseSDL(text string) (*GraphQLSchema, error) {
+    const (
+        errUnexpected = "unexpected %q in schema at token %d"
+    )
+    parser := &sdlParser{tokens: sdlTokens(text)}
+    schema := &GraphQLSchema{Types: make([]GraphQLType, 0)}
+    types := make(map[string]int)
+    define := func(definition GraphQLType) {
+        if i, ok := types[definition.Name]; ok {
+            // extensions add to the type defined before
+            existing := &schema.Types[i]
+            existing.Fields = append(existing.Fields, definition.Fields...)
+            existing.InputFields = append(existing.InputFields, definition.InputFields...)
+            existing.EnumValues = append(existing.EnumValues, definition.EnumValues...)
+            return
+        }
+        types[definition.Name] = len(schema.Types)
+        schema.Types = append(schema.Types, definition)
+    }
+
+    for !parser.done() {
+        parser.skipDescription()
+        keyword := parser.next()
+        if keyword == "extend" {
+            keyword = parser.next()
+        }
+        switch keyword {
+        case "schema":
+            parser.skipDirectives()
+            parser.expect("{")
+            for !parser.done() && parser.peek() != "}" {
+                operation := parser.next()
+                parser.expect(":")
+                root := &GraphQLNamed{Name: parser.next()}
+                switch operation {
+                case "query":
+                    schema.QueryType = root
+                case "mutation":
+                    schema.MutationType = root
+                }
+            }
+            parser.expect("}")
+        case "type", "interface":
+            kind := graphQLObject
+            if keyword == "interface" {
+                kind = graphQLIface
+            }
+            definition := GraphQLType{Kind: kind, Name: parser.next()}
+            if parser.peek() == "implements" {
+                parser.next()
+                for parser.peek() != "{" && parser.peek() != "@" && !parser.done() {
+                    parser.next()
+                }
+            }
+            parser.skipDirectives()
+            if parser.peek() == "{" {
+                definition.Fields = parser.fields()
+            }
+            define(definition)
+        case "input":
+            definition := GraphQLType{Kind: graphQLInput, Name: parser.next()}
+            parser.skipDirectives()
+            if parser.peek() == "{" {
+                parser.next()
+                for !parser.done() && parser.peek() != "}" {
+                    definition.InputFields = append(definition.InputFields, parser.input())
+                }
+                parser.expect("}")
+            }
+            define(definition)
+        case "enum":
+            definition := GraphQLType{Kind: graphQLEnum, Name: parser.next()}
+            parser.skipDirectives()
+            if parser.peek() == "{" {
+                parser.next()
+                for !parser.done() && parser.peek() != "}" {
+                    parser.skipDescription()
+                    definition.EnumValues = append(definition.EnumValues, GraphQLNamed{Name: parser.next()})
+                    parser.skipDirectives()
+                }
+                parser.expect("}")
+            }
+            define(definition)
+        case "scalar":
+            define(GraphQLType{Kind: graphQLScalar, Name: parser.next()})
+            parser.skipDirectives()
+        case "union":
+            define(GraphQLType{Kind: graphQLUnion, Name: parser.next()})
+            parser.skipDirectives()
+            if parser.peek() == "=" {
+                parser.next()
+                for parser.peek() == "|" || isSDLName(parser.peek()) && !isSDLKeyword(parser.peek()) {
+                    parser.next()
+                }
+            }
+        case "directive":
+            parser.expect("@")
+            parser.next()
+            if parser.peek() == "(" {
+                parser.skipBalanced()
+            }
+            if parser.peek() == "repeatable" {
+                parser.next()
+            }
+            parser.expect("on")
+            for parser.peek() == "|" || isSDLName(parser.peek()) && !isSDLKeyword(parser.peek()) {
+                parser.next()
+            }
+        case "":
+        default:
+            return nil, fmt.Errorf(errUnexpected, keyword, parser.position)
+        }
+    }
+
+    if schema.QueryType == nil {
+        if _, ok := types["Query"]; ok {
+            schema.QueryType = &GraphQLNamed{Name: "Query"}
+        }
+    }
+    if schema.MutationType == nil {
+        if _, ok := types["Mutation"]; ok {
+            schema.MutationType = &GraphQLNamed{Name: "Mutation"}
+        }
+    }
+    return schema, nil
+}
+
+func (parser *sdlParser) fields() []GraphQLField {
+    fields := make([]GraphQLField, 0)
+    parser.expect("{")
+    for !parser.done() && parser.peek() != "}" {
+        parser.skipDescription()
+        field := GraphQLField{Name: parser.next(), Args: make([]GraphQLInput, 0)}
+        if parser.peek() == "(" {
+            parser.next()
+            for !parser.done() && parser.peek() != ")" {
+                field.Args = append(field.Args, parser.input())
+            }
+            parser.expect(")")
+        }
+        parser.expect(":")
+        field.Type = parser.typeRef()
+        parser.skipDirectives()
+        fields = append(fields, field)
+    }
+    parser.expect("}")
+    return fields
+}
+
+// input reads an argument or input field, default value included.
+func (parser *sdlParser) input() GraphQLInput {
+    parser.skipDescription()
+    input := GraphQLInput{Name: parser.next()}
+    parser.expect(":")
+    input.Type = parser.typeRef()
+    if parser.peek() == "=" {
+        parser.next()
+        parser.skipValue()
+    }
+    parser.skipDirectives()
+    return input
+}
+
+func (parser *sdlParser) typeRef() GraphQLTypeRef {
+    var ref GraphQLTypeRef
+    if parser.peek() == "[" {
+        parser.next()
+        inner := parser.typeRef()
+        parser.expect("]")
+        ref = GraphQLTypeRef{Kind: graphQLList, OfType: &inner}
+    } else {
+        ref = GraphQLTypeRef{Name: parser.next()}
+    }
+    if parser.peek() == "!" {
+        parser.next()
+        inner := ref
+        ref = GraphQLTypeRef{Kind: graphQLNonNull, OfType: &inner}
+    }
+    return ref
+}
+
+func (parser *sdlParser) skipDescription() {
+    for strings.HasPrefix(parser.peek(), `"`) {
+        parser.next()
+    }
+}
+
+func (parser *sdlParser) skipDirectives() {
+    for parser.peek() == "@" {
+        parser.next()
+        parser.next()
+        if parser.peek() == "(" {
+            parser.skipBalanced()
+        }
+    }
+}
+
+func (parser *sdlParser) skipValue() {
+    switch parser.peek() {
+    case "[", "{", "(":
+        parser.skipBalanced()
+    default:
+        parser.next()
+    }
+}
+
+// skipBalanced reads past a bracketed group and everything nested in it.
+func (parser *sdlParser) skipBalanced() {
+    depth := 0
+    for !parser.done() {
+        switch parser.next() {
+        case "(", "[", "{":
+            depth++
+        case ")", "]", "}":
+            depth--
+        }
+        if depth == 0 {
+            return
+        }
+    }
+}
+
+func (parser *sdlParser) done() bool {
+    return parser.position >= len(parser.tokens)
+}
+
+func (parser *sdlParser) peek() string {
+    if parser.done() {
+        return ""
+    }
+    return parser.tokens[parser.position]
+}
+
+func (parser *sdlParser) next() string {
+    token := parser.peek()
+    parser.position++
+    return token
+}
+
+// expect reads past the token, which a malformed schema may lack: the
+// parse goes on and yields what it could make out.
+func (parser *sdlParser) expect(token string) {
+    if parser.peek() == token {
+        parser.next()
+    }
+}
+
+// sdlTokens splits the schema into names, punctuation and strings,
+// dropping comments, commas and white space.
+func sdlTokens(text string) []string {
+    tokens := make([]string, 0)
+    text = strings.TrimPrefix(text, "\uFEFF")
+    for i := 0; i < len(text); {
+        character := text[i]
+        switch {
+        case character == ' ' || character == '\t' || character == '\n' || character == '\r' || character == ',':
+            i++
+        case character == '#':
+            for i < len(text) && text[i] != '\n' {
+                i++
+            }
+        case strings.HasPrefix(text[i:], `"""`):
+            end := strings.Index(text[i+3:], `"""`)
+            if end < 0 {
+                return tokens
+            }
+            tokens = append(tokens, text[i:i+3+end+3])
+            i += 3 + end + 3
+        case character == '"':
+            start := i
+            for i++; i < len(text) && text[i] != '"' && text[i] != '\n'; i++ {
+                if text[i] == '\\' {
+                    i++
+                }
+            }
+            if i < len(text) {
+                i++
+            }
+            tokens = append(tokens, text[start:i])
+        case strings.HasPrefix(text[i:], "..."):
+            tokens = append(tokens, "...")
+            i += 3
+        case strings.IndexByte("{}()[]:!=@|&$", character) >= 0:
+            tokens = append(tokens, string(character))
+            i++
+        default:
+            start := i
+            for i < len(text) && isSDLNameByte(text[i]) {
+                i++
+            }
+            if i == start {
+                i++
+            }
+            tokens = append(tokens, text[start:i])
+        }
+    }
+    return tokens
+}
+
+// isSDLNameByte tells whether the byte goes on a name, or a number as
+// in default values.
+func isSDLNameByte(character byte) bool {
+    return character == '_' || character == '-' || character == '+' || character == '.' ||
+        'a' <= character && character <= 'z' || 'A' <= character && character <= 'Z' || '0' <= character && character <= '9'
+}
+
+func isSDLName(token string) bool {
+    return token != "" && (token[0] == '_' || 'a' <= token[0] && token[0] <= 'z' || 'A' <= token[0] && token[0] <= 'Z')
+}
+
+// isSDLKeyword tells whether the token starts the next definition.
+func isSDLKeyword(token string) bool {
+    switch token {
+    case "type", "interface", "input", "enum", "scalar", "union", "directive", "schema", "extend":
+        return true
+    }
+    return false
+}
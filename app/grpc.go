@@ -0,0 +1,439 @@
+package app
+
+import (
+    "fmt"
+    "context"
+    "sync"
+    "time"
+    "bytes"
+    "errors"
+    "strconv"
+    "strings"
+    "net/url"
+    "net/http"
+    "io/ioutil"
+    "encoding/json"
+    "encoding/binary"
+)
+
+const (
+    TagGRPCReflection = "grpc-reflection"
+
+    // what gRPC calls are recorded with as request method
+    grpcMethod = "GRPC"
+
+    defaultGRPCTimeout = 10000
+)
+
+var (
+    grpcReflectionServices = []string{"grpc.reflection.v1.ServerReflection", "grpc.reflection.v1alpha.ServerReflection"}
+
+    // the HTTP statuses gRPC gateways answer each status code with, so
+    // calls are filtered and rated as requests are
+    grpcHTTPStatuses = []int{
+        http.StatusOK,                  // OK
+        499,                            // CANCELLED
+        http.StatusInternalServerError, // UNKNOWN
+        http.StatusBadRequest,          // INVALID_ARGUMENT
+        http.StatusGatewayTimeout,      // DEADLINE_EXCEEDED
+        http.StatusNotFound,            // NOT_FOUND
+        http.StatusConflict,            // ALREADY_EXISTS
+        http.StatusForbidden,           // PERMISSION_DENIED
+        http.StatusTooManyRequests,     // RESOURCE_EXHAUSTED
+        http.StatusBadRequest,          // FAILED_PRECONDITION
+        http.StatusConflict,            // ABORTED
+        http.StatusBadRequest,          // OUT_OF_RANGE
+        http.StatusNotImplemented,      // UNIMPLEMENTED
+        http.StatusInternalServerError, // INTERNAL
+        http.StatusServiceUnavailable,  // UNAVAILABLE
+        http.StatusInternalServerError, // DATA_LOSS
+        http.StatusUnauthorized,        // UNAUTHENTICATED
+    }
+
+    grpcClient = &http.Client{
+        Transport: &http.Transport{
+            Proxy:     http.ProxyFromEnvironment,
+            Protocols: grpcProtocols(),
+        },
+    }
+)
+
+// GRPCTest fuzzes the methods of a gRPC server, over cleartext HTTP/2 for
+// http urls and TLS for https. The services come from server reflection,
+// or from Protos, with their imports looked up in ImportPaths, when set.
+// Every method is called with its Seeds, keyed by method, service/method
+// or full name, else with the config payloads sharing fields with its
+// input, else with a sample input, and then their mutations. Each call
+// is given up after Timeout milliseconds, the streams too. Calls are
+// recorded with the HTTP status matching their gRPC status code, which
+// stays in the Grpc-Status trailer among the headers, or the HTTP status
+// when the response carries none.
+type GRPCTest struct {
+    URL           string               `json:"url"`
+    Protos        []string             `json:"protos,omitempty"`
+    ImportPaths   []string             `json:"import_paths,omitempty"`
+    Services      []string             `json:"services,omitempty"`
+    Headers       map[string]string    `json:"headers,omitempty"`
+    Seeds         map[string][]Payload `json:"seeds,omitempty"`
+    SkipMutations bool                 `json:"skip_mutations,omitempty"`
+    Timeout       int                  `json:"timeout_ms,omitempty"`
+}
+
+// GRPCCase is a call to a method with the payload as input. Index is the
+// position of the payload in the config payloads, -1 for the others.
+type GRPCCase struct {
+    Exploit *Exploit
+    Schema  *ProtoSchema
+    Service string
+    Method  *ProtoMethod
+    Payload Payload
+    Index   int
+    Timeout time.Duration
+}
+
+func grpcProtocols() *http.Protocols {
+    protocols := new(http.Protocols)
+    protocols.SetHTTP2(true)
+    protocols.SetUnencryptedHTTP2(true)
+    return protocols
+}
+
+// BuildGRPCCases gets the services of every gRPC server and generates
+// their cases. The reflection calls are results too, as leaving server
+// reflection on is a finding of its own.
+func (config *Config) BuildGRPCCases() ([]*GRPCCase, []ExploitResult, error) {
+    const (
+        errProtos     = "error loading proto files of %s: %v"
+        errReflection = "server reflection failed: %v"
+    )
+    cases := make([]*GRPCCase, 0)
+    results := make([]ExploitResult, 0)
+    fuzzValues := config.FuzzValuesOrDefault()
+    for _, test := range config.GRPC {
+        target := test.URL
+        if !strings.Contains(target, "://") {
+            target = config.BaseURL + target
+        }
+        exploit := config.BuildExploit(Endpoint{Path: test.URL, Headers: test.Headers}, target)
+        timeout := time.Duration(orDefaultInt(test.Timeout, defaultGRPCTimeout)) * time.Millisecond
+
+        var schema *ProtoSchema
+        if len(test.Protos) > 0 {
+            loaded, err := LoadProtoFiles(test.Protos, test.ImportPaths)
+            if err != nil {
+                return nil, nil, fmt.Errorf(errProtos, test.URL, err)
+            }
+            schema = loaded
+        } else {
+            reflected, potential, err := ReflectGRPC(exploit, timeout)
+            if err != nil {
+                results = append(results, ExploitResult{
+                    Failed: []FailedRequest{{Potential: potential, Err: fmt.Sprintf(errReflection, err)}},
+                })
+                continue
+            }
+            result := ExploitResult{}
+            result.Flag(potential)
+            results = append(results, result)
+            schema = reflected
+        }
+        cases = append(cases, test.Cases(exploit, schema, fuzzValues, timeout)...)
+    }
+    return cases, results, nil
+}
+
+// Cases calls every method with its seeds and their mutations.
+func (test *GRPCTest) Cases(exploit *Exploit, schema *ProtoSchema, fuzzValues []string, timeout time.Duration) []*GRPCCase {
+    cases := make([]*GRPCCase, 0)
+    for _, service := range schema.Services {
+        short := service.Name[strings.LastIndex(service.Name, ".")+1:]
+        if strings.HasPrefix(service.Name, "grpc.reflection.") {
+            continue
+        }
+        if len(test.Services) > 0 && !containsString(test.Services, service.Name) && !containsString(test.Services, short) {
+            continue
+        }
+        for i := range service.Methods {
+            method := &service.Methods[i]
+            seeds, indexes := test.Seeds[service.Name+"/"+method.Name], []int(nil)
+            if seeds == nil {
+                seeds = test.Seeds[short+"/"+method.Name]
+            }
+            if seeds == nil {
+                seeds = test.Seeds[method.Name]
+            }
+            if seeds == nil {
+                seeds, indexes = fittingPayloads(schema.Messages[method.Input], exploit.Payloads)
+            }
+            if len(seeds) == 0 {
+                seeds, indexes = []Payload{schema.Sample(method.Input, 0)}, nil
+            }
+            for j, seed := range seeds {
+                index := -1
+                if indexes != nil {
+                    index = indexes[j]
+                }
+                cases = append(cases, &GRPCCase{Exploit: exploit, Schema: schema, Service: service.Name, Method: method, Payload: seed, Index: index, Timeout: timeout})
+                if test.SkipMutations {
+                    continue
+                }
+                for _, mutation := range Mutate(seed, fuzzValues) {
+                    cases = append(cases, &GRPCCase{Exploit: exploit, Schema: schema, Service: service.Name, Method: method, Payload: mutation.Payload, Index: -1, Timeout: timeout})
+                }
+            }
+        }
+    }
+    return cases
+}
+
+// fittingPayloads picks the payloads sharing a field with the message,
+// with their positions.
+func fittingPayloads(message *ProtoMessage, payloads []Payload) ([]Payload, []int) {
+    fitting, indexes := make([]Payload, 0), make([]int, 0)
+    if message == nil {
+        return fitting, indexes
+    }
+    for i, payload := range payloads {
+        for name := range payload {
+            if message.Field(name) != nil {
+                fitting, indexes = append(fitting, payload), append(indexes, i)
+                break
+            }
+        }
+    }
+    return fitting, indexes
+}
+
+// ReflectGRPC lists the services of the server and gets the files they
+// are defined in through server reflection, v1 or else v1alpha. The
+// listing is returned as a potential.
+func ReflectGRPC(exploit *Exploit, timeout time.Duration) (*ProtoSchema, Potential, error) {
+    const (
+        errUnsupported = "server reflection is not supported"
+        errReflection  = "reflection error %d: %s"
+        errReflected   = "server reflection is enabled"
+    )
+    listing := appendBytes(appendTag(nil, 7, wireBytes), []byte("*"))
+    var potential Potential
+    var responses [][]byte
+    var reflection string
+    for _, service := range grpcReflectionServices {
+        var err error
+        reflection = service + "/ServerReflectionInfo"
+        potential, responses, err = CallGRPC(exploit, timeout, reflection, listing)
+        if err != nil {
+            return nil, potential, err
+        }
+        if potential.ResponseStatus != http.StatusNotImplemented && potential.ResponseStatus != http.StatusNotFound {
+            break
+        }
+    }
+    if potential.ResponseStatus != http.StatusOK || len(responses) == 0 {
+        return nil, potential, errors.New(errUnsupported)
+    }
+
+    names := make([]string, 0)
+    raws, _ := readProto(responses[0])
+    for _, raw := range raws {
+        switch raw.number {
+        case 6:
+            listed, _ := readProto(raw.bytes)
+            for _, service := range listed {
+                if service.number == 1 {
+                    entry, _ := readProto(service.bytes)
+                    names = append(names, descriptorString(entry, 1))
+                }
+            }
+        case 7:
+            failure, _ := readProto(raw.bytes)
+            code := 0
+            for _, field := range failure {
+                if field.number == 1 {
+                    code = int(field.value)
+                }
+            }
+            return nil, potential, fmt.Errorf(errReflection, code, descriptorString(failure, 2))
+        }
+    }
+    potential.RequestPayload = Payload{"list_services": "*"}
+    potential.ResponsePayload = []byte(jsonText(map[string]interface{}{"services": names}))
+    potential.Tag, potential.Severity = TagGRPCReflection, SeverityLow
+    potential.Failures = append(potential.Failures, errReflected)
+
+    // one stream asks for the files of every service, which come back
+    // with the files they depend on
+    requests := make([][]byte, 0, len(names))
+    for _, name := range names {
+        requests = append(requests, appendBytes(appendTag(nil, 4, wireBytes), []byte(name)))
+    }
+    _, responses, err := CallGRPC(exploit, timeout, reflection, requests...)
+    if err != nil {
+        return nil, potential, err
+    }
+    schema := NewProtoSchema()
+    for _, response := range responses {
+        raws, _ := readProto(response)
+        for _, raw := range raws {
+            if raw.number != 4 {
+                continue
+            }
+            files, _ := readProto(raw.bytes)
+            for _, file := range files {
+                if file.number != 1 {
+                    continue
+                }
+                if err := schema.AddDescriptor(file.bytes); err != nil {
+                    return nil, potential, err
+                }
+            }
+        }
+    }
+    return schema, potential, nil
+}
+
+// CallGRPC sends the messages to the method, framed as gRPC does, once
+// more with fresh credentials when the auth can renew them and the call
+// is refused as unauthenticated, each within the timeout. It returns the
+// exchange and the response messages.
+func CallGRPC(exploit *Exploit, timeout time.Duration, method string, messages ...[]byte) (Potential, [][]byte, error) {
+    potential, responses, sent, err := callGRPC(exploit, timeout, method, messages)
+    if err == nil && potential.ResponseStatus == http.StatusUnauthorized && exploit.Auth.Refresh(sent) {
+        potential, responses, _, err = callGRPC(exploit, timeout, method, messages)
+    }
+    return potential, responses, err
+}
+
+func callGRPC(exploit *Exploit, timeout time.Duration, method string, messages [][]byte) (Potential, [][]byte, http.Header, error) {
+    const (
+        errAuthenticating = "error authenticating call: %v"
+        errCompressed     = "compressed response message"
+    )
+    headers := CloneHeaders(exploit.Headers)
+    if headers == nil {
+        headers = make(http.Header)
+    }
+    headers.Set("Content-Type", "application/grpc")
+    headers.Set("TE", "trailers")
+    // the payload the messages were encoded from tells more than their
+    // bytes, so those are left out
+    potential := Potential{RequestMethod: grpcMethod}
+    potential.RequestHeaders, potential.RequestURL = Redact(headers, exploit.URL, exploit.Auth, exploit.Signing)
+    target, err := exploit.Auth.Apply(headers, exploit.URL)
+    if err != nil {
+        return potential, nil, headers, fmt.Errorf(errAuthenticating, err)
+    }
+    endpoint, err := url.Parse(target)
+    if err != nil {
+        return potential, nil, headers, err
+    }
+    endpoint.Path = strings.TrimSuffix(endpoint.Path, "/") + "/" + method
+    potential.RequestHeaders, potential.RequestURL = Redact(headers, endpoint.String(), exploit.Auth, exploit.Signing)
+
+    body := make([]byte, 0)
+    for _, message := range messages {
+        body = append(body, 0)
+        body = binary.BigEndian.AppendUint32(body, uint32(len(message)))
+        body = append(body, message...)
+    }
+    ctx, cancel := context.WithTimeout(context.Background(), timeout)
+    defer cancel()
+    request, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.String(), bytes.NewReader(body))
+    if err != nil {
+        return potential, nil, headers, err
+    }
+    request.Header = CloneHeaders(headers)
+
+    start := time.Now()
+    response, err := grpcClient.Do(request)
+    if err != nil {
+        return potential, nil, headers, err
+    }
+    defer response.Body.Close()
+    data, err := ioutil.ReadAll(response.Body)
+    potential.Latency = time.Since(start)
+    if err != nil {
+        return potential, nil, headers, err
+    }
+
+    // trailers only responses carry the status in the headers
+    potential.ResponseHeaders = CloneHeaders(response.Header)
+    for name, values := range response.Trailer {
+        for _, value := range values {
+            potential.ResponseHeaders.Add(name, value)
+        }
+    }
+    potential.ResponseStatus = response.StatusCode
+    if code, err := strconv.Atoi(potential.ResponseHeaders.Get("Grpc-Status")); err == nil {
+        potential.ResponseStatus = http.StatusInternalServerError
+        if code >= 0 && code < len(grpcHTTPStatuses) {
+            potential.ResponseStatus = grpcHTTPStatuses[code]
+        }
+    }
+
+    responses := make([][]byte, 0)
+    for len(data) >= 5 {
+        length := int(binary.BigEndian.Uint32(data[1:5]))
+        if data[0] != 0 {
+            return potential, responses, headers, errors.New(errCompressed)
+        }
+        if len(data)-5 < length {
+            break
+        }
+        responses = append(responses, data[5:5+length])
+        data = data[5+length:]
+    }
+    if len(responses) == 0 && len(data) > 0 {
+        // not gRPC: the body of whatever answered
+        potential.ResponsePayload = data
+    }
+    return potential, responses, headers, nil
+}
+
+func (grpcCase *GRPCCase) AsyncExecute(group *sync.WaitGroup, limiter chan bool, out chan ExploitResult) {
+    defer group.Done()
+    out <- grpcCase.Run()
+    <-limiter
+}
+
+// Run encodes the payload as input of the method, calls it and records
+// the response messages as JSON, in an array for streaming methods.
+func (grpcCase *GRPCCase) Run() ExploitResult {
+    exploit := grpcCase.Exploit
+    result := ExploitResult{
+        Potentials: make(ExploitPotentials, 0),
+        Passed:     make(ExploitPotentials, 0),
+        Failed:     make([]FailedRequest, 0),
+        Asserted:   len(exploit.Expectations) > 0,
+    }
+    request := &Request{
+        Method:  grpcMethod,
+        URL:     exploit.URL,
+        Payload: grpcCase.Payload,
+
+        Interactions: exploit.Interactions,
+    }
+    request, token := request.Interactions.Inject(request)
+    message := grpcCase.Schema.Encode(grpcCase.Method.Input, request.Payload)
+    potential, responses, err := CallGRPC(exploit, grpcCase.Timeout, grpcCase.Service+"/"+grpcCase.Method.Name, message)
+    potential.RequestPayload = request.Payload
+    if err != nil {
+        failure := FailedRequest{Potential: potential, Err: err.Error()}
+        request.Interactions.Track(token, potential)
+        result.Failed = append(result.Failed, failure)
+        return result
+    }
+    decoded := make([]interface{}, 0, len(responses))
+    for _, response := range responses {
+        document, _ := grpcCase.Schema.Decode(grpcCase.Method.Output, response)
+        decoded = append(decoded, document)
+    }
+    switch {
+    case grpcCase.Method.ServerStreaming:
+        potential.ResponsePayload, _ = json.Marshal(decoded)
+    case len(decoded) > 0:
+        potential.ResponsePayload, _ = json.Marshal(decoded[0])
+    }
+    request.Interactions.Track(token, potential)
+    exploit.Classify(potential, grpcCase.Index, &result)
+    return result
+}
@@ -0,0 +1,217 @@
+package app
+
+import (
+    "time"
+    "bytes"
+    "testing"
+    "reflect"
+    "net/http"
+    "io/ioutil"
+    "net/http/httptest"
+    "encoding/binary"
+    _ "github.com/emikohmann/go-tester/app/internal/testflags"
+)
+
+// testGreeterDescriptor is the FileDescriptorProto of
+//
+//     package test;
+//     message HelloRequest { string name = 1; repeated sint32 lucky = 2; }
+//     message HelloReply { string message = 1; }
+//     service Greeter {
+//         rpc Hello(HelloRequest) returns (HelloReply);
+//         rpc Slow(HelloRequest) returns (stream HelloReply);
+//     }
+func testGreeterDescriptor() []byte {
+    field := func(name string, number int, label int, fieldType int) []byte {
+        data := appendBytes(appendTag(nil, 1, wireBytes), []byte(name))
+        data = appendVarint(appendTag(data, 3, wireVarint), uint64(number))
+        data = appendVarint(appendTag(data, 4, wireVarint), uint64(label))
+        return appendVarint(appendTag(data, 5, wireVarint), uint64(fieldType))
+    }
+    message := func(name string, fields ...[]byte) []byte {
+        data := appendBytes(appendTag(nil, 1, wireBytes), []byte(name))
+        for _, field := range fields {
+            data = appendBytes(appendTag(data, 2, wireBytes), field)
+        }
+        return data
+    }
+    method := func(name string, input string, output string, serverStreaming bool) []byte {
+        data := appendBytes(appendTag(nil, 1, wireBytes), []byte(name))
+        data = appendBytes(appendTag(data, 2, wireBytes), []byte(input))
+        data = appendBytes(appendTag(data, 3, wireBytes), []byte(output))
+        if serverStreaming {
+            data = appendVarint(appendTag(data, 6, wireVarint), 1)
+        }
+        return data
+    }
+    service := appendBytes(appendTag(nil, 1, wireBytes), []byte("Greeter"))
+    service = appendBytes(appendTag(service, 2, wireBytes), method("Hello", ".test.HelloRequest", ".test.HelloReply", false))
+    service = appendBytes(appendTag(service, 2, wireBytes), method("Slow", ".test.HelloRequest", ".test.HelloReply", true))
+
+    file := appendBytes(appendTag(nil, 1, wireBytes), []byte("greeter.proto"))
+    file = appendBytes(appendTag(file, 2, wireBytes), []byte("test"))
+    file = appendBytes(appendTag(file, 4, wireBytes), message("HelloRequest", field("name", 1, 1, protoString), field("lucky", 2, 3, protoSint32)))
+    file = appendBytes(appendTag(file, 4, wireBytes), message("HelloReply", field("message", 1, 1, protoString)))
+    return appendBytes(appendTag(file, 6, wireBytes), service)
+}
+
+// testGRPCServer serves server reflection v1 and the Greeter service
+// over cleartext HTTP/2. Hello answers "hello <name>" to callers with the
+// bearer token, NOT_FOUND for the name "missing"; Slow answers when the
+// call is cancelled.
+func testGRPCServer(t *testing.T) *httptest.Server {
+    frames := func(data []byte) [][]byte {
+        messages := make([][]byte, 0)
+        for len(data) >= 5 {
+            length := int(binary.BigEndian.Uint32(data[1:5]))
+            messages, data = append(messages, data[5:5+length]), data[5+length:]
+        }
+        return messages
+    }
+    respond := func(writer http.ResponseWriter, status string, messages ...[]byte) {
+        writer.Header().Set("Content-Type", "application/grpc")
+        writer.Header().Set("Trailer", "Grpc-Status")
+        writer.WriteHeader(http.StatusOK)
+        for _, message := range messages {
+            frame := binary.BigEndian.AppendUint32([]byte{0}, uint32(len(message)))
+            writer.Write(append(frame, message...))
+        }
+        writer.Header().Set("Grpc-Status", status)
+    }
+
+    handler := func(writer http.ResponseWriter, request *http.Request) {
+        body, _ := ioutil.ReadAll(request.Body)
+        switch request.URL.Path {
+        case "/grpc.reflection.v1.ServerReflection/ServerReflectionInfo":
+            responses := make([][]byte, 0)
+            for _, message := range frames(body) {
+                raws, _ := readProto(message)
+                switch raws[0].number {
+                case 7:
+                    listed := make([]byte, 0)
+                    for _, name := range []string{"test.Greeter", "grpc.reflection.v1.ServerReflection"} {
+                        listed = appendBytes(appendTag(listed, 1, wireBytes), appendBytes(appendTag(nil, 1, wireBytes), []byte(name)))
+                    }
+                    responses = append(responses, appendBytes(appendTag(nil, 6, wireBytes), listed))
+                case 4:
+                    files := appendBytes(appendTag(nil, 1, wireBytes), testGreeterDescriptor())
+                    responses = append(responses, appendBytes(appendTag(nil, 4, wireBytes), files))
+                }
+            }
+            respond(writer, "0", responses...)
+        case "/test.Greeter/Hello":
+            if request.Header.Get("Authorization") != "Bearer secret" {
+                // trailers only
+                writer.Header().Set("Content-Type", "application/grpc")
+                writer.Header().Set("Grpc-Status", "16")
+                writer.WriteHeader(http.StatusOK)
+                return
+            }
+            raws, _ := readProto(frames(body)[0])
+            name := descriptorString(raws, 1)
+            if name == "missing" {
+                respond(writer, "5")
+                return
+            }
+            respond(writer, "0", appendBytes(appendTag(nil, 1, wireBytes), []byte("hello "+name)))
+        case "/test.Greeter/Slow":
+            select {
+            case <-request.Context().Done():
+            case <-time.After(5 * time.Second):
+                t.Error("slow call was not cancelled")
+            }
+        default:
+            respond(writer, "12")
+        }
+    }
+    server := httptest.NewUnstartedServer(http.HandlerFunc(handler))
+    server.Config.Protocols = new(http.Protocols)
+    server.Config.Protocols.SetUnencryptedHTTP2(true)
+    server.Start()
+    return server
+}
+
+func TestGRPC(t *testing.T) {
+    server := testGRPCServer(t)
+    defer server.Close()
+    exploit := &Exploit{URL: server.URL, Headers: http.Header{"Authorization": {"Bearer secret"}}}
+
+    schema, potential, err := ReflectGRPC(exploit, time.Second)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if potential.Tag != TagGRPCReflection || potential.ResponseStatus != http.StatusOK {
+        t.Errorf("reflection potential: got tag %q status %d", potential.Tag, potential.ResponseStatus)
+    }
+    if want := `{"services":["test.Greeter","grpc.reflection.v1.ServerReflection"]}`; string(potential.ResponsePayload) != want {
+        t.Errorf("reflection listing: got %s, want %s", potential.ResponsePayload, want)
+    }
+    services := []ProtoService{{Name: "test.Greeter", Methods: []ProtoMethod{
+        {Name: "Hello", Input: "test.HelloRequest", Output: "test.HelloReply"},
+        {Name: "Slow", Input: "test.HelloRequest", Output: "test.HelloReply", ServerStreaming: true},
+    }}}
+    if !reflect.DeepEqual(schema.Services, services) {
+        t.Errorf("reflected services:\n got %+v\nwant %+v", schema.Services, services)
+    }
+    lucky := schema.Messages["test.HelloRequest"].Field("lucky")
+    if lucky == nil || lucky.Type != protoSint32 || !lucky.Repeated {
+        t.Errorf("reflected lucky field: got %+v", lucky)
+    }
+
+    cases := []struct {
+        name    string
+        headers http.Header
+        status  int
+        code    string
+        reply   map[string]interface{}
+    }{
+        {"ada", exploit.Headers, http.StatusOK, "0", map[string]interface{}{"message": "hello ada"}},
+        {"missing", exploit.Headers, http.StatusNotFound, "5", nil},
+        {"ada", nil, http.StatusUnauthorized, "16", nil},
+    }
+    for _, c := range cases {
+        caller := &Exploit{URL: server.URL, Headers: c.headers}
+        message := schema.Encode("test.HelloRequest", map[string]interface{}{"name": c.name, "lucky": []interface{}{float64(-7)}})
+        potential, responses, err := CallGRPC(caller, time.Second, "test.Greeter/Hello", message)
+        if err != nil {
+            t.Errorf("calling with %s: %v", c.name, err)
+            continue
+        }
+        if potential.ResponseStatus != c.status || potential.ResponseHeaders.Get("Grpc-Status") != c.code {
+            t.Errorf("calling with %s: got status %d and code %q, want %d and %q", c.name, potential.ResponseStatus, potential.ResponseHeaders.Get("Grpc-Status"), c.status, c.code)
+        }
+        if potential.RequestMethod != grpcMethod || potential.RequestURL != server.URL+"/test.Greeter/Hello" {
+            t.Errorf("calling with %s: recorded as %s %s", c.name, potential.RequestMethod, potential.RequestURL)
+        }
+        if c.headers != nil && potential.RequestHeaders.Get("Authorization") != redactedValue {
+            t.Errorf("calling with %s: recorded the credentials %q", c.name, potential.RequestHeaders.Get("Authorization"))
+        }
+        if c.reply == nil {
+            if len(responses) != 0 {
+                t.Errorf("calling with %s: got % x, want no response", c.name, responses)
+            }
+            continue
+        }
+        if len(responses) != 1 {
+            t.Errorf("calling with %s: got %d responses, want 1", c.name, len(responses))
+            continue
+        }
+        if reply, _ := schema.Decode("test.HelloReply", responses[0]); !reflect.DeepEqual(reply, c.reply) {
+            t.Errorf("calling with %s: got %v, want %v", c.name, reply, c.reply)
+        }
+    }
+
+    start := time.Now()
+    if _, _, err := CallGRPC(exploit, 100*time.Millisecond, "test.Greeter/Slow", []byte{}); err == nil {
+        t.Error("slow call returned without error")
+    }
+    if elapsed := time.Since(start); elapsed > time.Second {
+        t.Errorf("slow call given up after %s, want 100ms", elapsed)
+    }
+    if potential, _, err := CallGRPC(exploit, time.Second, "test.Greeter/Missing", []byte{}); err != nil || potential.ResponseStatus != http.StatusNotImplemented {
+        t.Errorf("unknown method: got status %d, %v", potential.ResponseStatus, err)
+    }
+    if !bytes.Equal(schema.Encode("test.HelloRequest", map[string]interface{}{"lucky": []interface{}{float64(-7)}}), []byte{0x10, 0x0d}) {
+        t.Error("reflected sint32 field not zigzag encoded")
+    }
+}
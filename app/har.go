@@ -0,0 +1,99 @@
+package app
+
+import (
+    "strings"
+    "net/url"
+    "io/ioutil"
+    "encoding/json"
+)
+
+type HAR struct {
+    Log struct {
+        Entries []HAREntry `json:"entries"`
+    } `json:"log"`
+}
+
+type HAREntry struct {
+    Request HARRequest `json:"request"`
+}
+
+type HARRequest struct {
+    Method   string         `json:"method"`
+    URL      string         `json:"url"`
+    Headers  []HARNameValue `json:"headers"`
+    PostData *HARPostData   `json:"postData"`
+}
+
+type HARPostData struct {
+    MimeType string         `json:"mimeType"`
+    Text     string         `json:"text"`
+    Encoding string         `json:"encoding"`
+    Params   []HARNameValue `json:"params"`
+}
+
+type HARNameValue struct {
+    Name  string `json:"name"`
+    Value string `json:"value"`
+}
+
+func LoadHAR(filename string) (*HAR, error) {
+    bytes, err := ioutil.ReadFile(filename)
+    if err != nil {
+        return nil, err
+    }
+    var har HAR
+    if err := json.Unmarshal(bytes, &har); err != nil {
+        return nil, err
+    }
+    return &har, nil
+}
+
+func (har *HAR) Config() *Config {
+    operations := make([]Operation, 0, len(har.Log.Entries))
+    for i, entry := range har.Log.Entries {
+        request := entry.Request
+        operation := Operation{
+            ID:     ImportedOperationID(i, request.Method, request.URL),
+            Method: strings.ToUpper(request.Method),
+            URL:    request.URL,
+        }
+        for _, header := range request.Headers {
+            // HTTP/2 captures list pseudo headers such as :authority
+            if strings.HasPrefix(header.Name, ":") || transportHeaders[strings.ToLower(header.Name)] {
+                continue
+            }
+            if operation.Headers == nil {
+                operation.Headers = make(map[string]string)
+            }
+            operation.Headers[header.Name] = header.Value
+        }
+        if data := request.PostData; data != nil {
+            operation.Body, operation.Encoding = data.Body()
+            if data.MimeType != "" {
+                if operation.Headers == nil {
+                    operation.Headers = make(map[string]string)
+                }
+                setDefaultHeader(operation.Headers, "Content-Type", data.MimeType)
+            }
+            ImportJSONBody(&operation)
+        }
+        operations = append(operations, operation)
+    }
+    return ImportedConfig(operations)
+}
+
+// Body returns the captured text, or rebuilds a url encoded body from
+// the params when the browser only recorded those.
+func (data *HARPostData) Body() (string, string) {
+    if data.Encoding == EncodingBase64 {
+        return data.Text, EncodingBase64
+    }
+    if data.Text != "" || len(data.Params) == 0 {
+        return data.Text, EncodingText
+    }
+    values := make(url.Values)
+    for _, param := range data.Params {
+        values.Add(param.Name, param.Value)
+    }
+    return values.Encode(), EncodingText
+}
@@ -0,0 +1,369 @@
+package app
+
+import (
+    "fmt"
+    "sort"
+    "bytes"
+    "strings"
+    "net/http"
+    "html/template"
+)
+
+const (
+    ExportHTML = "html"
+
+    // htmlPayloadLimit keeps huge response bodies from bloating the page.
+    htmlPayloadLimit = 64 * 1024
+)
+
+var (
+    // latencyBuckets are the upper bounds of the histogram, in
+    // milliseconds, the last bucket taking everything slower.
+    latencyBuckets = []int64{50, 100, 250, 500, 1000, 2500}
+
+    htmlTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>go-tester {{.Runs}}</title>
+<style>
+body { font: 14px/1.4 -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2em; color: #222; }
+h1 { font-size: 1.6em; margin-bottom: 0; }
+h2 { font-size: 1.2em; margin-top: 2em; }
+.summary { color: #666; }
+.charts { display: flex; flex-wrap: wrap; gap: 2em; }
+.chart { flex: 1 1 300px; }
+.row { display: flex; align-items: center; margin: 4px 0; }
+.label { width: 90px; font-family: monospace; }
+.bars { flex: 1; display: flex; height: 18px; background: #f3f3f3; }
+.bar { height: 100%; color: #fff; font-size: 11px; text-align: center; overflow: hidden; }
+.count { width: 50px; text-align: right; color: #666; }
+.s1, .s2 { background: #4caf50; } .s3 { background: #2196f3; } .s4 { background: #ff9800; } .s5 { background: #f44336; }
+.info { background: #9e9e9e; } .low { background: #2196f3; } .medium { background: #ff9800; } .high { background: #f44336; } .critical { background: #7b1fa2; }
+.latency { background: #607d8b; }
+.filters { margin: 1em 0; display: flex; gap: 1em; }
+table { border-collapse: collapse; width: 100%; }
+th, td { text-align: left; padding: 4px 8px; border-bottom: 1px solid #ddd; vertical-align: top; }
+td.url { word-break: break-all; }
+.tag { display: inline-block; padding: 0 6px; border-radius: 3px; color: #fff; font-size: 12px; }
+details pre { background: #f6f8fa; padding: 8px; overflow-x: auto; max-height: 400px; white-space: pre-wrap; word-break: break-all; }
+button { cursor: pointer; }
+.failures { margin: 4px 0; padding-left: 1.2em; color: #c62828; }
+</style>
+</head>
+<body>
+<h1>go-tester report</h1>
+<p class="summary">Run {{.Runs}}: {{len .Potentials}} potentials out of {{.Total}} requests, {{len .Failed}} failed requests.</p>
+
+<div class="charts">
+<div class="chart">
+<h2>Status by method</h2>
+{{range .Statuses}}<div class="row"><span class="label">{{.Label}}</span><div class="bars">{{range .Segments}}<div class="bar {{.Class}}" style="width: {{.Width}}%" title="{{.Label}}: {{.Count}}">{{.Label}}</div>{{end}}</div><span class="count">{{.Count}}</span></div>
+{{end}}</div>
+<div class="chart">
+<h2>Findings by severity</h2>
+{{range .Severities}}<div class="row"><span class="label">{{.Label}}</span><div class="bars"><div class="bar {{.Class}}" style="width: {{.Width}}%"></div></div><span class="count">{{.Count}}</span></div>
+{{end}}</div>
+<div class="chart">
+<h2>Latency</h2>
+{{range .Latencies}}<div class="row"><span class="label">{{.Label}}</span><div class="bars"><div class="bar {{.Class}}" style="width: {{.Width}}%"></div></div><span class="count">{{.Count}}</span></div>
+{{end}}</div>
+</div>
+
+<h2>Potentials</h2>
+<div class="filters">
+<input id="search" type="search" placeholder="Filter by url, rule or payload" size="40">
+<select id="severity"><option value="">All severities</option>{{range .Severities}}<option>{{.Label}}</option>{{end}}</select>
+<select id="method"><option value="">All methods</option>{{range .Statuses}}<option>{{.Label}}</option>{{end}}</select>
+</div>
+<table>
+<thead><tr><th>#</th><th>Severity</th><th>Rule</th><th>Method</th><th>URL</th><th>Status</th><th>Latency</th><th></th></tr></thead>
+<tbody>
+{{range .Potentials}}<tr class="potential" data-severity="{{.Severity}}" data-method="{{.Method}}">
+<td>{{.ID}}</td><td><span class="tag {{.Severity}}">{{.Severity}}</span></td><td>{{.Rule}}</td><td>{{.Method}}</td>
+<td class="url">{{.URL}}{{if .Failures}}<ul class="failures">{{range .Failures}}<li>{{.}}</li>{{end}}</ul>{{end}}<details><summary>Request and response</summary>
+<pre>{{.Method}} {{.URL}}
+{{.RequestHeaders}}
+{{.RequestBody}}</pre>
+<pre>{{.Status}}
+{{.ResponseHeaders}}
+{{.ResponsePayload}}</pre>
+</details></td>
+<td>{{.Status}}</td><td>{{.Latency}} ms</td>
+<td>{{if .Curl}}<button class="copy" data-command="{{.Curl}}">Copy as curl</button>{{end}}</td>
+</tr>
+{{end}}</tbody>
+</table>
+{{if .Failed}}
+<h2>Failed requests</h2>
+<table>
+<thead><tr><th>Method</th><th>URL</th><th>Error</th></tr></thead>
+<tbody>
+{{range .Failed}}<tr><td>{{.Potential.RequestMethod}}</td><td class="url">{{.Potential.RequestURL}}</td><td>{{.Err}}</td></tr>
+{{end}}</tbody>
+</table>
+{{end}}
+<script>
+(function () {
+    var search = document.getElementById("search");
+    var severity = document.getElementById("severity");
+    var method = document.getElementById("method");
+    function filter() {
+        var text = search.value.toLowerCase();
+        document.querySelectorAll("tr.potential").forEach(function (row) {
+            var visible = row.textContent.toLowerCase().indexOf(text) >= 0 &&
+                (!severity.value || row.dataset.severity === severity.value) &&
+                (!method.value || row.dataset.method === method.value);
+            row.style.display = visible ? "" : "none";
+        });
+    }
+    search.addEventListener("input", filter);
+    severity.addEventListener("change", filter);
+    method.addEventListener("change", filter);
+
+    document.querySelectorAll("button.copy").forEach(function (button) {
+        button.addEventListener("click", function () {
+            var curl = button.dataset.command;
+            var done = function () {
+                button.textContent = "Copied";
+                setTimeout(function () { button.textContent = "Copy as curl"; }, 1500);
+            };
+            if (navigator.clipboard) {
+                navigator.clipboard.writeText(curl).then(done);
+                return;
+            }
+            // file:// pages may not get the clipboard API
+            var area = document.createElement("textarea");
+            area.value = curl;
+            document.body.appendChild(area);
+            area.select();
+            document.execCommand("copy");
+            document.body.removeChild(area);
+            done();
+        });
+    });
+})();
+</script>
+</body>
+</html>
+`))
+)
+
+type htmlReport struct {
+    Runs       string
+    Total      int
+    Statuses   []htmlBar
+    Severities []htmlBar
+    Latencies  []htmlBar
+    Potentials []htmlPotential
+    Failed     []FailedRequest
+}
+
+// htmlBar is a chart row, or a segment of one when it has segments.
+type htmlBar struct {
+    Label    string
+    Class    string
+    Count    int
+    Width    int
+    Segments []htmlBar
+}
+
+type htmlPotential struct {
+    ID              int64
+    Severity        string
+    Rule            string
+    Method          string
+    URL             string
+    Status          int
+    Latency         int64
+    RequestHeaders  string
+    RequestBody     string
+    ResponseHeaders string
+    ResponsePayload string
+    Curl            string
+    Failures        []string
+}
+
+// HTML renders the run as a single page with no external assets: charts
+// of every response, and the potentials with their full exchange.
+func (report *Report) HTML() ([]byte, error) {
+    responses := append(append(ExploitPotentials{}, report.Potentials...), report.Passed...)
+    page := htmlReport{
+        Runs:       report.Runs(),
+        Total:      len(responses) + len(report.Failed),
+        Statuses:   statusChart(responses),
+        Severities: severityChart(report.Potentials),
+        Latencies:  latencyChart(responses),
+        Potentials: make([]htmlPotential, 0, len(report.Potentials)),
+        Failed:     report.Failed,
+    }
+    for _, potential := range report.Potentials {
+        page.Potentials = append(page.Potentials, htmlPotential{
+            ID:              potential.ID,
+            Severity:        potential.Classify(),
+            Rule:            potential.Rule(),
+            Method:          potential.RequestMethod,
+            URL:             potential.RequestURL,
+            Status:          potential.ResponseStatus,
+            Latency:         potential.Latency.Nanoseconds() / 1e6,
+            RequestHeaders:  headerText(potential.RequestHeaders),
+            RequestBody:     truncate(potential.BodyText()),
+            ResponseHeaders: headerText(potential.ResponseHeaders),
+            ResponsePayload: truncate(string(potential.ResponsePayload)),
+            Curl:            potential.Curl(),
+            Failures:        potential.Failures,
+        })
+    }
+    var buffer bytes.Buffer
+    if err := htmlTemplate.Execute(&buffer, page); err != nil {
+        return nil, err
+    }
+    return buffer.Bytes(), nil
+}
+
+// Runs lists the run IDs in the report.
+func (report *Report) Runs() string {
+    seen := make(map[string]bool)
+    runs := make([]string, 0)
+    all := append(append(ExploitPotentials{}, report.Potentials...), report.Passed...)
+    for _, failed := range report.Failed {
+        all = append(all, failed.Potential)
+    }
+    for _, potential := range all {
+        if !seen[potential.RunID] {
+            seen[potential.RunID] = true
+            runs = append(runs, potential.RunID)
+        }
+    }
+    sort.Strings(runs)
+    return strings.Join(runs, ", ")
+}
+
+func statusChart(potentials ExploitPotentials) []htmlBar {
+    counts := make(map[string]map[int]int)
+    totals := make(map[string]int)
+    for _, potential := range potentials {
+        if counts[potential.RequestMethod] == nil {
+            counts[potential.RequestMethod] = make(map[int]int)
+        }
+        counts[potential.RequestMethod][potential.ResponseStatus]++
+        totals[potential.RequestMethod]++
+    }
+    methods := make([]string, 0, len(counts))
+    for method := range counts {
+        methods = append(methods, method)
+    }
+    sort.Strings(methods)
+    chart := make([]htmlBar, 0, len(methods))
+    for _, method := range methods {
+        statuses := make([]int, 0, len(counts[method]))
+        for status := range counts[method] {
+            statuses = append(statuses, status)
+        }
+        sort.Ints(statuses)
+        row := htmlBar{
+            Label: method,
+            Count: totals[method],
+        }
+        for _, status := range statuses {
+            row.Segments = append(row.Segments, htmlBar{
+                Label: fmt.Sprint(status),
+                Class: fmt.Sprintf("s%d", status/100),
+                Count: counts[method][status],
+                Width: percent(counts[method][status], maxCount(totals)),
+            })
+        }
+        chart = append(chart, row)
+    }
+    return chart
+}
+
+func severityChart(potentials ExploitPotentials) []htmlBar {
+    counts := make(map[string]int)
+    for _, potential := range potentials {
+        counts[potential.Classify()]++
+    }
+    chart := make([]htmlBar, 0)
+    for _, severity := range []string{SeverityCritical, SeverityHigh, SeverityMedium, SeverityLow, SeverityInfo} {
+        if counts[severity] == 0 {
+            continue
+        }
+        chart = append(chart, htmlBar{
+            Label: severity,
+            Class: severity,
+            Count: counts[severity],
+            Width: percent(counts[severity], maxCount(counts)),
+        })
+    }
+    return chart
+}
+
+func latencyChart(potentials ExploitPotentials) []htmlBar {
+    counts := make([]int, len(latencyBuckets)+1)
+    for _, potential := range potentials {
+        milliseconds := potential.Latency.Nanoseconds() / 1e6
+        bucket := sort.Search(len(latencyBuckets), func(i int) bool {
+            return milliseconds < latencyBuckets[i]
+        })
+        counts[bucket]++
+    }
+    highest := 0
+    for _, count := range counts {
+        if count > highest {
+            highest = count
+        }
+    }
+    chart := make([]htmlBar, 0, len(counts))
+    for i, count := range counts {
+        var label string
+        if i < len(latencyBuckets) {
+            label = fmt.Sprintf("< %d ms", latencyBuckets[i])
+        } else {
+            label = fmt.Sprintf(">= %d ms", latencyBuckets[i-1])
+        }
+        chart = append(chart, htmlBar{
+            Label: label,
+            Class: "latency",
+            Count: count,
+            Width: percent(count, highest),
+        })
+    }
+    return chart
+}
+
+func maxCount(counts map[string]int) int {
+    highest := 0
+    for _, count := range counts {
+        if count > highest {
+            highest = count
+        }
+    }
+    return highest
+}
+
+func percent(count int, total int) int {
+    if total == 0 {
+        return 0
+    }
+    return count * 100 / total
+}
+
+func headerText(headers http.Header) string {
+    names := make([]string, 0, len(headers))
+    for name := range headers {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+    lines := make([]string, 0, len(names))
+    for _, name := range names {
+        lines = append(lines, name+": "+strings.Join(headers[name], ", "))
+    }
+    return strings.Join(lines, "\n")
+}
+
+func truncate(text string) string {
+    if len(text) <= htmlPayloadLimit {
+        return text
+    }
+    return text[:htmlPayloadLimit] + "\n[truncated]"
+}
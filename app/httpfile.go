@@ -0,0 +1,138 @@
+package app
+
+import (
+    "fmt"
+    "errors"
+    "strconv"
+    "strings"
+    "io/ioutil"
+)
+
+const (
+    // httpFileSeparator splits the requests of a raw HTTP file.
+    httpFileSeparator = "###"
+)
+
+func LoadHTTPFile(filename string) (*Config, error) {
+    const (
+        errInvalidRequest = "invalid request %d: %v"
+    )
+    bytes, err := ioutil.ReadFile(filename)
+    if err != nil {
+        return nil, err
+    }
+    operations := make([]Operation, 0)
+    for _, text := range SplitHTTPRequests(string(bytes)) {
+        operation, err := ParseHTTPRequest(text)
+        if err != nil {
+            return nil, fmt.Errorf(errInvalidRequest, len(operations)+1, err)
+        }
+        operation.ID = ImportedOperationID(len(operations), operation.Method, operation.URL)
+        operations = append(operations, operation)
+    }
+    return ImportedConfig(operations), nil
+}
+
+// SplitHTTPRequests cuts the file on separator lines, dropping blocks that
+// hold nothing but whitespace. Line endings are kept as they are, bodies
+// depending on them.
+func SplitHTTPRequests(text string) []string {
+    requests := make([]string, 0)
+    var current strings.Builder
+    flush := func() {
+        request := current.String()
+        if strings.TrimSpace(request) != "" {
+            requests = append(requests, strings.TrimLeft(request, "\r\n"))
+        }
+        current.Reset()
+    }
+    for _, line := range strings.SplitAfter(text, "\n") {
+        if strings.HasPrefix(strings.TrimSpace(line), httpFileSeparator) {
+            flush()
+            continue
+        }
+        current.WriteString(line)
+    }
+    flush()
+    return requests
+}
+
+// ParseHTTPRequest reads an HTTP/1.1 request dump. The URL is rebuilt from
+// the Host header unless the request line already holds an absolute one.
+// The body is taken byte for byte, up to the Content-Length when given,
+// or else up to the line break closing the request.
+func ParseHTTPRequest(text string) (Operation, error) {
+    const (
+        errEmptyRequest = "empty request"
+        errRequestLine  = "invalid request line %q"
+        errMissingHost  = "missing Host header"
+    )
+    lines := strings.SplitAfter(text, "\n")
+    requestLine := strings.TrimRight(lines[0], "\r\n")
+    if requestLine == "" {
+        return Operation{}, errors.New(errEmptyRequest)
+    }
+    fields := strings.Fields(requestLine)
+    if len(fields) < 2 {
+        return Operation{}, fmt.Errorf(errRequestLine, requestLine)
+    }
+    operation := Operation{
+        Method: strings.ToUpper(fields[0]),
+        URL:    fields[1],
+    }
+
+    host, length, offset := "", -1, len(lines[0])
+    body := ""
+    for _, raw := range lines[1:] {
+        offset += len(raw)
+        line := strings.TrimRight(raw, "\r\n")
+        if line == "" {
+            body = text[offset:]
+            break
+        }
+        i := strings.Index(line, ":")
+        if i <= 0 {
+            continue
+        }
+        name, value := strings.TrimSpace(line[:i]), strings.TrimSpace(line[i+1:])
+        switch strings.ToLower(name) {
+        case "host":
+            host = value
+        case "content-length":
+            if declared, err := strconv.Atoi(value); err == nil {
+                length = declared
+            }
+        }
+        if transportHeaders[strings.ToLower(name)] {
+            continue
+        }
+        if operation.Headers == nil {
+            operation.Headers = make(map[string]string)
+        }
+        operation.Headers[name] = value
+    }
+
+    switch {
+    case length >= 0 && length <= len(body):
+        body = body[:length]
+    case strings.HasSuffix(body, "\r\n"):
+        body = strings.TrimSuffix(body, "\r\n")
+    default:
+        body = strings.TrimSuffix(body, "\n")
+    }
+    if operation.Body = body; operation.Body != "" {
+        operation.Encoding = EncodingText
+    }
+
+    if !strings.Contains(operation.URL, "://") {
+        if host == "" {
+            return Operation{}, errors.New(errMissingHost)
+        }
+        scheme := "https"
+        if strings.HasSuffix(host, ":80") {
+            scheme = "http"
+        }
+        operation.URL = scheme + "://" + host + operation.URL
+    }
+    return operation, nil
+}
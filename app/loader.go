@@ -1,19 +1,126 @@
 package app
 
 import (
+    "fmt"
+    "mime"
+    "strings"
     "io/ioutil"
     "encoding/json"
+    "encoding/base64"
 )
 
 type Payload map[string]interface{}
 
+// Operation is a single documented or captured request. Its body is
+// either a JSON Payload or a raw Body, which the Encoding says how to
+// decode before sending.
+type Operation struct {
+    ID       string            `json:"id"`
+    Method   string            `json:"method"`
+    URL      string            `json:"url"`
+    Query    map[string]string `json:"query,omitempty"`
+    Headers  map[string]string `json:"headers,omitempty"`
+    Payload  Payload           `json:"payload,omitempty"`
+    Body     string            `json:"body,omitempty"`
+    Encoding string            `json:"encoding,omitempty"`
+    Expect   []Expectation     `json:"expect,omitempty"`
+}
+
+const (
+    EncodingText   = "text"
+    EncodingBase64 = "base64"
+
+    errInvalidBody = "invalid body in operation %s: %v"
+)
+
+func (operation Operation) BodyBytes() ([]byte, error) {
+    if operation.Body == "" {
+        return nil, nil
+    }
+    if operation.Encoding == EncodingBase64 {
+        return base64.StdEncoding.DecodeString(operation.Body)
+    }
+    return []byte(operation.Body), nil
+}
+
+// Endpoint is either a plain path, which uses the top level methods,
+// payloads, headers, auth and filters, or an object overriding them.
+type Endpoint struct {
+    Path                string            `json:"path"`
+    Methods             []string          `json:"methods,omitempty"`
+    Payloads            []Payload         `json:"payloads,omitempty"`
+    Headers             map[string]string `json:"headers,omitempty"`
+    Auth                *Auth             `json:"auth,omitempty"`
+    Signing             *Signing          `json:"signing,omitempty"`
+    FilterResponseCodes []int             `json:"filter_response_codes,omitempty"`
+    Expect              []Expectation     `json:"expect,omitempty"`
+    Owner               string            `json:"owner,omitempty"`
+}
+
+type endpointDefinition Endpoint
+
 type Config struct {
-    BaseURL             string    `json:"baseUrl"`
-    Endpoints           []string  `json:"endpoints"`
-    Methods             []string  `json:"methods"`
-    Payloads            []Payload `json:"payloads"`
-    RateLimiter         int       `json:"rate_limiter"`
-    FilterResponseCodes []int     `json:"filter_response_codes"`
+    BaseURL             string            `json:"baseUrl"`
+    Endpoints           []Endpoint        `json:"endpoints"`
+    Methods             []string          `json:"methods"`
+    Payloads            []Payload         `json:"payloads"`
+    Headers             map[string]string `json:"headers,omitempty"`
+    Auth                *Auth             `json:"auth,omitempty"`
+    Signing             *Signing          `json:"signing,omitempty"`
+    Operations          []Operation       `json:"operations,omitempty"`
+    Scenarios           []Scenario        `json:"scenarios,omitempty"`
+    GraphQL             []GraphQLTest     `json:"graphql,omitempty"`
+    WebSockets          []WebSocketTest   `json:"websockets,omitempty"`
+    GRPC                []GRPCTest        `json:"grpc,omitempty"`
+    Raw                 []RawTest         `json:"raw,omitempty"`
+    FuzzValues          []string          `json:"fuzz_values,omitempty"`
+    RateLimiter         int               `json:"rate_limiter"`
+    FilterResponseCodes []int             `json:"filter_response_codes"`
+    Expect              []Expectation     `json:"expect,omitempty"`
+    Identities          []Identity        `json:"identities,omitempty"`
+    JWT                 *JWTTest          `json:"jwt,omitempty"`
+    CORS                *CORSTest         `json:"cors,omitempty"`
+    HeaderAudit         *HeaderAudit      `json:"header_audit,omitempty"`
+    VerbTampering       *VerbTamperTest   `json:"verb_tampering,omitempty"`
+    Redirect            *RedirectTest     `json:"redirect,omitempty"`
+    MassAssignment      *MassAssignTest   `json:"mass_assignment,omitempty"`
+    OOB                 *OOBListener      `json:"oob,omitempty"`
+    Owner               string            `json:"owner,omitempty"`
+
+    // the callbacks of the running execution, handed to its exploits
+    interactions *Interactions
+}
+
+func (endpoint *Endpoint) UnmarshalJSON(bytes []byte) error {
+    var path string
+    if err := json.Unmarshal(bytes, &path); err == nil {
+        *endpoint = Endpoint{Path: path}
+        return nil
+    }
+    var definition endpointDefinition
+    if err := json.Unmarshal(bytes, &definition); err != nil {
+        return err
+    }
+    *endpoint = Endpoint(definition)
+    return nil
+}
+
+func (endpoint Endpoint) MarshalJSON() ([]byte, error) {
+    if endpoint.IsPlain() {
+        return json.Marshal(endpoint.Path)
+    }
+    return json.Marshal(endpointDefinition(endpoint))
+}
+
+func (endpoint Endpoint) IsPlain() bool {
+    return endpoint.Methods == nil &&
+        endpoint.Payloads == nil &&
+        endpoint.Headers == nil &&
+        endpoint.Auth == nil &&
+        endpoint.Signing == nil &&
+        endpoint.FilterResponseCodes == nil &&
+        endpoint.Expect == nil &&
+        endpoint.Owner == ""
 }
 
 func LoadConfig(filename string) (*Config, error) {
@@ -25,5 +132,84 @@ func LoadConfig(filename string) (*Config, error) {
     if err := json.Unmarshal(bytes, &config); err != nil {
         return nil, err
     }
+    for _, operation := range config.Operations {
+        if _, err := operation.BodyBytes(); err != nil {
+            return nil, fmt.Errorf(errInvalidBody, operation.ID, err)
+        }
+    }
+    for _, scenario := range config.Scenarios {
+        for _, step := range scenario.Steps {
+            if _, err := step.BodyBytes(); err != nil {
+                return nil, fmt.Errorf(errInvalidBody, scenario.ID+" "+step.ID, err)
+            }
+        }
+    }
     return &config, nil
 }
+
+var (
+    // transportHeaders are recomputed by the transport on every request,
+    // so imported requests drop them.
+    transportHeaders = map[string]bool{
+        "host":              true,
+        "content-length":    true,
+        "connection":        true,
+        "transfer-encoding": true,
+    }
+)
+
+// ImportedOperationID names the i-th captured request.
+func ImportedOperationID(i int, method string, target string) string {
+    const (
+        idFormat = "%d %s %s"
+    )
+    return fmt.Sprintf(idFormat, i+1, method, target)
+}
+
+// ImportJSONBody turns a captured JSON object body into the payload, for
+// the mutations and the mass assignment cases to work on its fields.
+// Other bodies, and JSON under vendor content types rest would replace,
+// stay raw.
+func ImportJSONBody(operation *Operation) {
+    if operation.Body == "" || operation.Encoding == EncodingBase64 {
+        return
+    }
+    isJSON := false
+    for name, value := range operation.Headers {
+        if strings.EqualFold(name, "Content-Type") {
+            mediaType, _, err := mime.ParseMediaType(value)
+            isJSON = err == nil && mediaType == "application/json"
+        }
+    }
+    if !isJSON {
+        return
+    }
+    var payload Payload
+    if err := json.Unmarshal([]byte(operation.Body), &payload); err != nil || payload == nil {
+        return
+    }
+    operation.Payload, operation.Body, operation.Encoding = payload, "", ""
+}
+
+// ImportedConfig wraps imported operations in a config with the default settings.
+func ImportedConfig(operations []Operation) *Config {
+    const (
+        defaultRateLimiter = 10
+    )
+    return &Config{
+        Endpoints:           []Endpoint{},
+        Methods:             []string{},
+        Payloads:            []Payload{},
+        Operations:          operations,
+        RateLimiter:         defaultRateLimiter,
+        FilterResponseCodes: []int{},
+    }
+}
+
+func SaveConfig(config *Config, filename string) error {
+    bytes, err := json.MarshalIndent(config, "", "    ")
+    if err != nil {
+        return err
+    }
+    return ioutil.WriteFile(filename, append(bytes, '\n'), 0644)
+}
@@ -0,0 +1,174 @@
+package app
+
+import (
+    "fmt"
+    "reflect"
+    "strings"
+    "net/http"
+    "encoding/json"
+)
+
+const (
+    TagMassAssignment = "mass-assignment"
+)
+
+var (
+    defaultPrivilegedFields = map[string]interface{}{
+        "isAdmin":  true,
+        "is_admin": true,
+        "role":     "admin",
+        "owner_id": float64(31337),
+        "ownerId":  float64(31337),
+        "price":    0.01,
+        "verified": true,
+    }
+)
+
+// MassAssignTest adds privileged fields to the payloads and reads
+// the resource back to see which ones were persisted. ReadBack is the
+// url of the resource, the exploit url by default, where {{url}} is the
+// exploit url and {{id}} the value at IDPath in the write response.
+// Root is the path of the resource within the read back response.
+type MassAssignTest struct {
+    Fields   map[string]interface{} `json:"fields,omitempty"`
+    ReadBack string                 `json:"read_back,omitempty"`
+    IDPath   string                 `json:"id_path,omitempty"`
+    Root     string                 `json:"root,omitempty"`
+}
+
+func (test *MassAssignTest) Run(exploit *Exploit) ExploitResult {
+    result := ExploitResult{
+        Potentials: make(ExploitPotentials, 0),
+        Passed:     make(ExploitPotentials, 0),
+        Failed:     make([]FailedRequest, 0),
+    }
+    fields := test.Fields
+    if len(fields) == 0 {
+        fields = defaultPrivilegedFields
+    }
+    for _, method := range exploit.Methods {
+        if !AcceptsPayload(method) {
+            continue
+        }
+        for _, seed := range exploit.Payloads {
+            candidates := make(map[string]interface{})
+            for name, value := range fields {
+                if _, ok := seed[name]; !ok {
+                    candidates[name] = value
+                }
+            }
+            if len(candidates) == 0 {
+                continue
+            }
+            // the seed alone tells the values the resource gets anyway
+            control, ok := test.assign(exploit, method, seed, &result)
+            if !ok {
+                continue
+            }
+            if test.inject(exploit, method, seed, candidates, control, &result) {
+                continue
+            }
+            // refused all together, as some APIs do with unknown fields
+            for name, value := range candidates {
+                test.inject(exploit, method, seed, map[string]interface{}{name: value}, control, &result)
+            }
+        }
+    }
+    return result
+}
+
+// inject writes the seed with the candidates and flags the candidates
+// the resource reads back with, unlike the control. It tells whether
+// the write was accepted.
+func (test *MassAssignTest) inject(exploit *Exploit, method string, seed Payload, candidates map[string]interface{}, control interface{}, result *ExploitResult) bool {
+    const (
+        errPersisted = "%s persisted as %s, read back from %s"
+    )
+    payload := seed
+    for name, value := range candidates {
+        payload = withField(payload, name, value)
+    }
+    request := exploit.Request(method)
+    request.Payload = payload
+    write, failure := request.Send()
+    if failure != nil {
+        result.Failed = append(result.Failed, *failure)
+        return true
+    }
+    if !reachable(write.ResponseStatus) {
+        result.Passed = append(result.Passed, write)
+        return false
+    }
+    readBack, resource, ok := test.read(exploit, &write, result)
+    if ok {
+        for _, name := range sortedKeys(candidates) {
+            actual, err := LookupJSON(resource, name)
+            if err != nil || !reflect.DeepEqual(actual, candidates[name]) {
+                continue
+            }
+            if original, err := LookupJSON(control, name); err == nil && reflect.DeepEqual(original, actual) {
+                continue
+            }
+            write.Failures = append(write.Failures, fmt.Sprintf(errPersisted, name, jsonText(actual), readBack))
+        }
+    }
+    if len(write.Failures) > 0 {
+        write.Tag, write.Severity = TagMassAssignment, SeverityHigh
+    }
+    result.Flag(write)
+    return true
+}
+
+// assign writes the seed and reads the resource it left.
+func (test *MassAssignTest) assign(exploit *Exploit, method string, seed Payload, result *ExploitResult) (interface{}, bool) {
+    request := exploit.Request(method)
+    request.Payload = seed
+    write, failure := request.Send()
+    if failure != nil {
+        result.Failed = append(result.Failed, *failure)
+        return nil, false
+    }
+    result.Passed = append(result.Passed, write)
+    if !reachable(write.ResponseStatus) {
+        return nil, false
+    }
+    _, resource, ok := test.read(exploit, &write, result)
+    return resource, ok
+}
+
+// read gets the resource the write left, returning where it read it
+// from and the resource document.
+func (test *MassAssignTest) read(exploit *Exploit, write *Potential, result *ExploitResult) (string, interface{}, bool) {
+    target := strings.Replace(orDefault(test.ReadBack, "{{url}}"), "{{url}}", exploit.URL, -1)
+    if strings.Contains(target, "{{id}}") {
+        var document interface{}
+        if err := json.Unmarshal(write.ResponsePayload, &document); err != nil {
+            return target, nil, false
+        }
+        id, err := LookupJSON(document, orDefault(test.IDPath, "id"))
+        if err != nil {
+            return target, nil, false
+        }
+        target = strings.Replace(target, "{{id}}", strings.Trim(jsonText(id), `"`), -1)
+    }
+    request := exploit.Request(http.MethodGet)
+    request.URL = target
+    potential, failure := request.Send()
+    if failure != nil {
+        result.Failed = append(result.Failed, *failure)
+        return target, nil, false
+    }
+    result.Passed = append(result.Passed, potential)
+    var resource interface{}
+    if err := json.Unmarshal(potential.ResponsePayload, &resource); err != nil {
+        return target, nil, false
+    }
+    if test.Root != "" {
+        root, err := LookupJSON(resource, test.Root)
+        if err != nil {
+            return target, nil, false
+        }
+        resource = root
+    }
+    return target, resource, true
+}
@@ -0,0 +1,59 @@
+package app
+
+import (
+    "sync"
+)
+
+// Module is a check that sends its own requests for every exploit of
+// the scan, on top of the regular ones.
+type Module interface {
+    Run(exploit *Exploit) ExploitResult
+}
+
+// Modules lists the checks the config enables.
+func (config *Config) Modules() []Module {
+    modules := make([]Module, 0)
+    if config.CORS != nil {
+        modules = append(modules, config.CORS)
+    }
+    if config.VerbTampering != nil {
+        modules = append(modules, config.VerbTampering)
+    }
+    if config.Redirect != nil {
+        modules = append(modules, config.Redirect)
+    }
+    if config.MassAssignment != nil {
+        modules = append(modules, config.MassAssignment)
+    }
+    return modules
+}
+
+func AsyncRun(module Module, exploit *Exploit, group *sync.WaitGroup, limiter chan bool, out chan ExploitResult) {
+    defer group.Done()
+    out <- module.Run(exploit)
+    <-limiter
+}
+
+// Request starts a request to the exploit target carrying its headers
+// and credentials.
+func (exploit *Exploit) Request(method string) *Request {
+    return &Request{
+        Method:  method,
+        URL:     exploit.URL,
+        Headers: CloneHeaders(exploit.Headers),
+        Auth:    exploit.Auth,
+        Signing: exploit.Signing,
+
+        Interactions: exploit.Interactions,
+    }
+}
+
+// Flag adds the potential to the result, reported when it holds
+// findings and passed otherwise.
+func (result *ExploitResult) Flag(potential Potential) {
+    if len(potential.Failures) > 0 {
+        result.Potentials = append(result.Potentials, potential)
+        return
+    }
+    result.Passed = append(result.Passed, potential)
+}
@@ -0,0 +1,78 @@
+package app
+
+import (
+    "strings"
+)
+
+const (
+    oversizedLength = 65536
+)
+
+var (
+    // values of another type than any field is likely to expect
+    typeConfusions = []interface{}{nil, true, float64(-1), float64(0), 1e308, "", []interface{}{}, map[string]interface{}{}}
+)
+
+// Mutation is a variant of a seed payload and the change that made it.
+type Mutation struct {
+    Name    string
+    Payload Payload
+}
+
+// Mutate derives variants of the seed: every field in turn set to each
+// fuzz value, to values of other types and to an oversized string, and
+// dropped. Nested objects are mutated down to their leaves.
+func Mutate(seed Payload, fuzzValues []string) []Mutation {
+    mutations := make([]Mutation, 0)
+    for _, path := range leafPaths(map[string]interface{}(seed), "") {
+        for _, value := range fuzzValues {
+            mutations = append(mutations, Mutation{Name: path + "=" + value, Payload: mutateAt(seed, path, value, false)})
+        }
+        for _, value := range typeConfusions {
+            mutations = append(mutations, Mutation{Name: path + "=" + jsonText(value), Payload: mutateAt(seed, path, value, false)})
+        }
+        mutations = append(mutations,
+            Mutation{Name: path + " oversized", Payload: mutateAt(seed, path, strings.Repeat("A", oversizedLength), false)},
+            Mutation{Name: path + " removed", Payload: mutateAt(seed, path, nil, true)},
+        )
+    }
+    return mutations
+}
+
+// leafPaths lists the dotted paths of the fields holding no object.
+func leafPaths(document map[string]interface{}, prefix string) []string {
+    paths := make([]string, 0)
+    for _, name := range sortedKeys(document) {
+        if nested, ok := document[name].(map[string]interface{}); ok && len(nested) > 0 {
+            paths = append(paths, leafPaths(nested, prefix+name+".")...)
+            continue
+        }
+        paths = append(paths, prefix+name)
+    }
+    return paths
+}
+
+// mutateAt copies the seed with the value at the dotted path replaced,
+// or removed, leaving the seed untouched.
+func mutateAt(seed Payload, path string, value interface{}, remove bool) Payload {
+    names := strings.Split(path, ".")
+    var replace func(document map[string]interface{}, depth int) map[string]interface{}
+    replace = func(document map[string]interface{}, depth int) map[string]interface{} {
+        copied := make(map[string]interface{}, len(document))
+        for name, item := range document {
+            copied[name] = item
+        }
+        name := names[depth]
+        switch {
+        case depth < len(names)-1:
+            nested, _ := document[name].(map[string]interface{})
+            copied[name] = replace(nested, depth+1)
+        case remove:
+            delete(copied, name)
+        default:
+            copied[name] = value
+        }
+        return copied
+    }
+    return Payload(replace(map[string]interface{}(seed), 0))
+}
@@ -0,0 +1,426 @@
+package app
+
+import (
+    "fmt"
+    "net"
+    "sync"
+    "time"
+    "bytes"
+    "errors"
+    "regexp"
+    "strings"
+    "strconv"
+    "net/http"
+    "crypto/rand"
+    "encoding/hex"
+    "encoding/json"
+    "net/http/httputil"
+)
+
+const (
+    TagOOBInteraction = "oob-interaction"
+
+    oobPlaceholder     = "{{oob}}"
+    oobHostPlaceholder = "{{oob_host}}"
+    // tokens start with it, to be told apart from the rest of a request
+    oobTokenPrefix = "oob"
+
+    defaultOOBWait = 5
+    // what is kept of each http interaction
+    maxInteractionDump = 4096
+)
+
+var (
+    oobToken = regexp.MustCompile(oobTokenPrefix + `[0-9a-f]{16}`)
+)
+
+// OOBListener receives the callbacks of blind vulnerabilities. Payloads
+// carry {{oob}}, a callback url, or {{oob_host}}, a host name to look
+// up, both unique to the request. Domain is how the targets reach the
+// listener: a host and port forwarding to HTTPPort or, with DNSPort, a
+// domain delegated to it, whose lookups are answered with Address.
+type OOBListener struct {
+    Domain   string `json:"domain"`
+    Address  string `json:"address,omitempty"`
+    HTTPPort int    `json:"http_port"`
+    DNSPort  int    `json:"dns_port,omitempty"`
+    Wait     int    `json:"wait_seconds,omitempty"`
+}
+
+// Interaction is a callback the listener got.
+type Interaction struct {
+    Token    string
+    Protocol string
+    Remote   string
+    Detail   string
+    Time     time.Time
+}
+
+// Interactions hands out the callback tokens of a run and correlates
+// the callbacks back to the requests that carried them.
+type Interactions struct {
+    mutex    sync.Mutex
+    listener *OOBListener
+    origins  map[string]Potential
+    tokens   []string
+    received map[string][]Interaction
+    server   *http.Server
+    dns      net.PacketConn
+}
+
+// StartInteractions starts listening for callbacks, nil when the config
+// sets no listener.
+func (config *Config) StartInteractions() (*Interactions, error) {
+    const (
+        errListening = "error listening for interactions: %v"
+    )
+    listener := config.OOB
+    if listener == nil {
+        return nil, nil
+    }
+    interactions := &Interactions{
+        listener: listener,
+        origins:  make(map[string]Potential),
+        tokens:   make([]string, 0),
+        received: make(map[string][]Interaction),
+    }
+    socket, err := net.Listen("tcp", ":"+strconv.Itoa(listener.HTTPPort))
+    if err != nil {
+        return nil, fmt.Errorf(errListening, err)
+    }
+    interactions.server = &http.Server{Handler: interactions}
+    go interactions.server.Serve(socket)
+
+    if listener.DNSPort > 0 {
+        interactions.dns, err = net.ListenPacket("udp", ":"+strconv.Itoa(listener.DNSPort))
+        if err != nil {
+            interactions.server.Close()
+            return nil, fmt.Errorf(errListening, err)
+        }
+        go interactions.serveDNS()
+    }
+    return interactions, nil
+}
+
+// Close stops listening.
+func (interactions *Interactions) Close() {
+    if interactions == nil {
+        return
+    }
+    interactions.server.Close()
+    if interactions.dns != nil {
+        interactions.dns.Close()
+    }
+}
+
+// Await gives the targets the configured time to call back once every
+// request is done, as blind payloads often run in the background.
+func (interactions *Interactions) Await() {
+    if interactions == nil || len(interactions.tokens) == 0 {
+        return
+    }
+    wait := interactions.listener.Wait
+    if wait == 0 {
+        wait = defaultOOBWait
+    }
+    time.Sleep(time.Duration(wait) * time.Second)
+}
+
+// Inject replaces the placeholders of the request with a new token,
+// returning a copy so the exploit fields stay shared untouched. Requests
+// without placeholders come back as they are, with no token.
+func (interactions *Interactions) Inject(request *Request) (*Request, string) {
+    if interactions == nil || !request.HasPlaceholder() {
+        return request, ""
+    }
+    token := newToken()
+    callback, host := interactions.listener.Callback(token)
+    replacer := strings.NewReplacer(oobPlaceholder, callback, oobHostPlaceholder, host)
+
+    injected := *request
+    injected.URL = replacer.Replace(request.URL)
+    if request.Headers != nil {
+        injected.Headers = make(http.Header, len(request.Headers))
+        for name, values := range request.Headers {
+            for _, value := range values {
+                injected.Headers.Add(name, replacer.Replace(value))
+            }
+        }
+    }
+    if request.Payload != nil {
+        injected.Payload = injectValue(map[string]interface{}(request.Payload), replacer).(map[string]interface{})
+    }
+    if request.Body != nil {
+        injected.Body = []byte(replacer.Replace(string(request.Body)))
+    }
+
+    interactions.mutex.Lock()
+    defer interactions.mutex.Unlock()
+    interactions.tokens = append(interactions.tokens, token)
+    headers, target := Redact(injected.Headers, injected.URL, injected.Auth, injected.Signing)
+    interactions.origins[token] = Potential{
+        Identity:       injected.Identity,
+        RequestMethod:  injected.Method,
+        RequestURL:     target,
+        RequestHeaders: headers,
+        RequestPayload: injected.Payload,
+        RequestBody:    injected.Body,
+    }
+    return &injected, token
+}
+
+// Track records the exchange that carried the token, which callbacks
+// are reported with.
+func (interactions *Interactions) Track(token string, potential Potential) {
+    if interactions == nil || token == "" {
+        return
+    }
+    interactions.mutex.Lock()
+    defer interactions.mutex.Unlock()
+    interactions.origins[token] = potential
+}
+
+// HasPlaceholder tells whether any part of the request expects a
+// callback token.
+func (request *Request) HasPlaceholder() bool {
+    contains := func(value string) bool {
+        return strings.Contains(value, oobPlaceholder) || strings.Contains(value, oobHostPlaceholder)
+    }
+    if contains(request.URL) || contains(string(request.Body)) {
+        return true
+    }
+    for _, values := range request.Headers {
+        for _, value := range values {
+            if contains(value) {
+                return true
+            }
+        }
+    }
+    if request.Payload != nil {
+        // payloads are plain json values
+        payload, _ := json.Marshal(request.Payload)
+        return contains(string(payload))
+    }
+    return false
+}
+
+func injectValue(value interface{}, replacer *strings.Replacer) interface{} {
+    switch typed := value.(type) {
+    case string:
+        return replacer.Replace(typed)
+    case map[string]interface{}:
+        injected := make(map[string]interface{}, len(typed))
+        for key, item := range typed {
+            injected[key] = injectValue(item, replacer)
+        }
+        return injected
+    case []interface{}:
+        injected := make([]interface{}, len(typed))
+        for i, item := range typed {
+            injected[i] = injectValue(item, replacer)
+        }
+        return injected
+    }
+    return value
+}
+
+// Callback builds the url and host name carrying the token. With a
+// DNS listener the token goes in the host too, so a lookup alone
+// confirms the interaction.
+func (listener *OOBListener) Callback(token string) (string, string) {
+    host := listener.Domain
+    if name, _, err := net.SplitHostPort(listener.Domain); err == nil {
+        host = name
+    }
+    if listener.DNSPort > 0 {
+        return "http://" + token + "." + listener.Domain + "/" + token, token + "." + host
+    }
+    return "http://" + listener.Domain + "/" + token, host
+}
+
+func newToken() string {
+    bytes := make([]byte, 8)
+    rand.Read(bytes)
+    return oobTokenPrefix + hex.EncodeToString(bytes)
+}
+
+// stripTokens blanks the callback tokens, which change on every run.
+func stripTokens(value []byte) []byte {
+    return oobToken.ReplaceAll(value, []byte(oobTokenPrefix))
+}
+
+// ServeHTTP records the callback, finding the token in the host or the
+// path.
+func (interactions *Interactions) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+    dump, _ := httputil.DumpRequest(request, true)
+    if len(dump) > maxInteractionDump {
+        dump = dump[:maxInteractionDump]
+    }
+    candidates := []string{strings.SplitN(strings.ToLower(request.Host), ".", 2)[0]}
+    candidates = append(candidates, strings.Split(request.URL.Path, "/")...)
+    for _, candidate := range candidates {
+        if interactions.receive(Interaction{
+            Token:    candidate,
+            Protocol: "http",
+            Remote:   request.RemoteAddr,
+            Detail:   string(bytes.TrimSpace(dump)),
+            Time:     time.Now(),
+        }) {
+            break
+        }
+    }
+    writer.WriteHeader(http.StatusOK)
+}
+
+// receive keeps the interaction when its token was handed out, which
+// filters out scanners and crawlers hitting the listener.
+func (interactions *Interactions) receive(interaction Interaction) bool {
+    interactions.mutex.Lock()
+    defer interactions.mutex.Unlock()
+    if _, ok := interactions.origins[interaction.Token]; !ok {
+        return false
+    }
+    interactions.received[interaction.Token] = append(interactions.received[interaction.Token], interaction)
+    return true
+}
+
+// serveDNS answers every query, recording those for a handed out token,
+// with the configured address so http callbacks follow the lookup.
+func (interactions *Interactions) serveDNS() {
+    const (
+        lookupFormat = "lookup %s type %d"
+    )
+    buffer := make([]byte, 512)
+    for {
+        length, remote, err := interactions.dns.ReadFrom(buffer)
+        if err != nil {
+            return
+        }
+        query, err := parseDNSQuery(buffer[:length])
+        if err != nil {
+            continue
+        }
+        interactions.receive(Interaction{
+            Token:    strings.SplitN(query.name, ".", 2)[0],
+            Protocol: "dns",
+            Remote:   remote.String(),
+            Detail:   fmt.Sprintf(lookupFormat, query.name, query.kind),
+            Time:     time.Now(),
+        })
+        interactions.dns.WriteTo(query.Answer(net.ParseIP(interactions.listener.Address)), remote)
+    }
+}
+
+// dnsQuery is the single question of a DNS query, enough to answer it.
+type dnsQuery struct {
+    packet   []byte
+    question []byte
+    name     string
+    kind     uint16
+}
+
+func parseDNSQuery(packet []byte) (*dnsQuery, error) {
+    const (
+        errMalformed = "malformed dns query"
+        headerLength = 12
+    )
+    if len(packet) < headerLength || packet[4] != 0 || packet[5] != 1 {
+        return nil, errors.New(errMalformed)
+    }
+    labels := make([]string, 0)
+    offset := headerLength
+    for {
+        if offset >= len(packet) {
+            return nil, errors.New(errMalformed)
+        }
+        length := int(packet[offset])
+        offset++
+        if length == 0 {
+            break
+        }
+        if length > 63 || offset+length > len(packet) {
+            return nil, errors.New(errMalformed)
+        }
+        labels = append(labels, string(packet[offset:offset+length]))
+        offset += length
+    }
+    if offset+4 > len(packet) {
+        return nil, errors.New(errMalformed)
+    }
+    return &dnsQuery{
+        packet:   packet,
+        question: packet[headerLength : offset+4],
+        name:     strings.ToLower(strings.Join(labels, ".")),
+        kind:     uint16(packet[offset])<<8 | uint16(packet[offset+1]),
+    }, nil
+}
+
+// Answer builds the authoritative response: an A record with the
+// address for A queries, an empty answer otherwise.
+func (query *dnsQuery) Answer(address net.IP) []byte {
+    const (
+        typeA   = 1
+        classIN = 1
+    )
+    answer := address.To4()
+    if query.kind != typeA {
+        answer = nil
+    }
+    response := make([]byte, 0, 12+len(query.question)+16)
+    // same id, a response with the recursion desired bit echoed
+    response = append(response, query.packet[0], query.packet[1], 0x84|query.packet[2]&0x01, 0x00)
+    response = append(response, 0, 1, 0, 0, 0, 0, 0, 0)
+    response = append(response, query.question...)
+    if answer != nil {
+        response[7] = 1
+        response = append(response, 0xc0, 0x0c, 0, typeA, 0, classIN, 0, 0, 0, 0, 0, 4)
+        response = append(response, answer...)
+    }
+    return response
+}
+
+// Result reports the requests that got called back, each with the
+// interactions they caused.
+func (interactions *Interactions) Result() ExploitResult {
+    const (
+        interactionFormat = "%s interaction from %s: %s"
+    )
+    result := ExploitResult{
+        Potentials: make(ExploitPotentials, 0),
+        Passed:     make(ExploitPotentials, 0),
+        Failed:     make([]FailedRequest, 0),
+    }
+    interactions.mutex.Lock()
+    defer interactions.mutex.Unlock()
+    for _, token := range interactions.tokens {
+        received := interactions.received[token]
+        if len(received) == 0 {
+            continue
+        }
+        potential := interactions.origins[token]
+        potential.Tag, potential.Severity = TagOOBInteraction, SeverityHigh
+        potential.Failures = nil
+        for _, interaction := range received {
+            potential.Failures = append(potential.Failures, fmt.Sprintf(interactionFormat, interaction.Protocol, interaction.Remote, interaction.Detail))
+        }
+        result.Potentials = append(result.Potentials, potential)
+    }
+    return result
+}
+
+// Print sums up the callbacks of the run.
+func (interactions *Interactions) Print() {
+    const (
+        summaryFormat     = "Interactions: %d of %d callback tokens called back\n"
+        interactionFormat = "  %s %s <- %s %s\n"
+    )
+    interactions.mutex.Lock()
+    defer interactions.mutex.Unlock()
+    fmt.Printf(summaryFormat, len(interactions.received), len(interactions.tokens))
+    for _, token := range interactions.tokens {
+        origin := interactions.origins[token]
+        for _, interaction := range interactions.received[token] {
+            fmt.Printf(interactionFormat, origin.RequestMethod, origin.RequestURL, interaction.Protocol, interaction.Remote)
+        }
+    }
+}
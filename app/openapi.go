@@ -0,0 +1,468 @@
+package app
+
+import (
+    "fmt"
+    "sort"
+    "strings"
+    "net/url"
+    "io/ioutil"
+    "encoding/json"
+    "gopkg.in/yaml.v2"
+)
+
+const (
+    maxExampleDepth = 8
+)
+
+var (
+    openAPIMethods = []string{"GET", "PUT", "POST", "DELETE", "OPTIONS", "HEAD", "PATCH", "TRACE"}
+)
+
+type OpenAPI struct {
+    Swagger     string                       `json:"swagger"`
+    OpenAPI     string                       `json:"openapi"`
+    Host        string                       `json:"host"`
+    BasePath    string                       `json:"basePath"`
+    Schemes     []string                     `json:"schemes"`
+    Servers     []OpenAPIServer              `json:"servers"`
+    Paths       map[string]OpenAPIPathItem   `json:"paths"`
+    Definitions map[string]*Schema           `json:"definitions"`
+    Parameters  map[string]*OpenAPIParameter `json:"parameters"`
+    Components  OpenAPIComponents            `json:"components"`
+}
+
+type OpenAPIServer struct {
+    URL string `json:"url"`
+}
+
+type OpenAPIComponents struct {
+    Schemas       map[string]*Schema             `json:"schemas"`
+    Parameters    map[string]*OpenAPIParameter   `json:"parameters"`
+    RequestBodies map[string]*OpenAPIRequestBody `json:"requestBodies"`
+}
+
+type OpenAPIPathItem struct {
+    Parameters []*OpenAPIParameter `json:"parameters"`
+    Get        *OpenAPIOperation   `json:"get"`
+    Put        *OpenAPIOperation   `json:"put"`
+    Post       *OpenAPIOperation   `json:"post"`
+    Delete     *OpenAPIOperation   `json:"delete"`
+    Options    *OpenAPIOperation   `json:"options"`
+    Head       *OpenAPIOperation   `json:"head"`
+    Patch      *OpenAPIOperation   `json:"patch"`
+    Trace      *OpenAPIOperation   `json:"trace"`
+}
+
+type OpenAPIOperation struct {
+    OperationID string              `json:"operationId"`
+    Parameters  []*OpenAPIParameter `json:"parameters"`
+    RequestBody *OpenAPIRequestBody `json:"requestBody"`
+}
+
+type OpenAPIParameter struct {
+    Ref      string        `json:"$ref"`
+    Name     string        `json:"name"`
+    In       string        `json:"in"`
+    Required bool          `json:"required"`
+    Schema   *Schema       `json:"schema"`
+    Type     SchemaType    `json:"type"`
+    Format   string        `json:"format"`
+    Enum     []interface{} `json:"enum"`
+    Default  interface{}   `json:"default"`
+    Example  interface{}   `json:"example"`
+    Items    *Schema       `json:"items"`
+}
+
+type OpenAPIRequestBody struct {
+    Ref     string                      `json:"$ref"`
+    Content map[string]OpenAPIMediaType `json:"content"`
+}
+
+type OpenAPIMediaType struct {
+    Schema  *Schema     `json:"schema"`
+    Example interface{} `json:"example"`
+}
+
+type Schema struct {
+    Ref        string             `json:"$ref,omitempty"`
+    Type       SchemaType         `json:"type,omitempty"`
+    Format     string             `json:"format,omitempty"`
+    Example    interface{}        `json:"example,omitempty"`
+    Default    interface{}        `json:"default,omitempty"`
+    Enum       []interface{}      `json:"enum,omitempty"`
+    Properties map[string]*Schema `json:"properties,omitempty"`
+    Items      *Schema            `json:"items,omitempty"`
+    AllOf      []*Schema          `json:"allOf,omitempty"`
+    OneOf      []*Schema          `json:"oneOf,omitempty"`
+    AnyOf      []*Schema          `json:"anyOf,omitempty"`
+    Required   []string           `json:"required,omitempty"`
+}
+
+// SchemaType accepts both the single type of OpenAPI 2/3.0 and the
+// type arrays of 3.1, keeping the first non null entry.
+type SchemaType string
+
+func (schemaType *SchemaType) UnmarshalJSON(bytes []byte) error {
+    var single string
+    if err := json.Unmarshal(bytes, &single); err == nil {
+        *schemaType = SchemaType(single)
+        return nil
+    }
+    var multiple []string
+    if err := json.Unmarshal(bytes, &multiple); err != nil {
+        return err
+    }
+    for _, value := range multiple {
+        if value != "null" {
+            *schemaType = SchemaType(value)
+            return nil
+        }
+    }
+    return nil
+}
+
+func LoadOpenAPI(filename string) (*OpenAPI, error) {
+    bytes, err := ioutil.ReadFile(filename)
+    if err != nil {
+        return nil, err
+    }
+    var document interface{}
+    if err := yaml.Unmarshal(bytes, &document); err != nil {
+        return nil, err
+    }
+    if bytes, err = json.Marshal(normalizeYAML(document)); err != nil {
+        return nil, err
+    }
+    var spec OpenAPI
+    if err := json.Unmarshal(bytes, &spec); err != nil {
+        return nil, err
+    }
+    return &spec, nil
+}
+
+// normalizeYAML turns the map[interface{}]interface{} values produced by
+// yaml into their JSON equivalents. JSON documents are valid YAML, so
+// both formats go through the same path.
+func normalizeYAML(value interface{}) interface{} {
+    switch typed := value.(type) {
+    case map[interface{}]interface{}:
+        result := make(map[string]interface{}, len(typed))
+        for key, item := range typed {
+            result[fmt.Sprint(key)] = normalizeYAML(item)
+        }
+        return result
+    case []interface{}:
+        for i, item := range typed {
+            typed[i] = normalizeYAML(item)
+        }
+        return typed
+    default:
+        return typed
+    }
+}
+
+func (spec *OpenAPI) BaseURL() string {
+    if len(spec.Servers) > 0 {
+        return strings.TrimSuffix(spec.Servers[0].URL, "/")
+    }
+    if spec.Host == "" {
+        return strings.TrimSuffix(spec.BasePath, "/")
+    }
+    scheme := "https"
+    if len(spec.Schemes) > 0 {
+        scheme = spec.Schemes[0]
+    }
+    return strings.TrimSuffix(scheme+"://"+spec.Host+spec.BasePath, "/")
+}
+
+func (spec *OpenAPI) Config() *Config {
+    config := ImportedConfig(spec.Operations())
+    config.BaseURL = spec.BaseURL()
+    return config
+}
+
+func (spec *OpenAPI) Operations() []Operation {
+    paths := make([]string, 0, len(spec.Paths))
+    for path := range spec.Paths {
+        paths = append(paths, path)
+    }
+    sort.Strings(paths)
+
+    operations := make([]Operation, 0)
+    for _, path := range paths {
+        item := spec.Paths[path]
+        for _, method := range openAPIMethods {
+            operation := item.Operation(method)
+            if operation == nil {
+                continue
+            }
+            operations = append(operations, spec.BuildOperation(path, method, item.Parameters, operation))
+        }
+    }
+    return operations
+}
+
+func (item OpenAPIPathItem) Operation(method string) *OpenAPIOperation {
+    switch method {
+    case "GET":
+        return item.Get
+    case "PUT":
+        return item.Put
+    case "POST":
+        return item.Post
+    case "DELETE":
+        return item.Delete
+    case "OPTIONS":
+        return item.Options
+    case "HEAD":
+        return item.Head
+    case "PATCH":
+        return item.Patch
+    case "TRACE":
+        return item.Trace
+    }
+    return nil
+}
+
+func (spec *OpenAPI) BuildOperation(path string, method string, common []*OpenAPIParameter, operation *OpenAPIOperation) Operation {
+    result := Operation{
+        ID:     fmt.Sprintf("%s %s", method, path),
+        Method: method,
+        URL:    path,
+    }
+
+    cookies := make([]string, 0)
+    for _, parameter := range spec.MergeParameters(common, operation.Parameters) {
+        if parameter.In == "body" {
+            spec.BuildBody(&result, "application/json", spec.Example(parameter.Schema, 0))
+            continue
+        }
+        value := fmt.Sprint(spec.ParameterExample(parameter))
+        switch parameter.In {
+        case "path":
+            result.URL = strings.Replace(result.URL, "{"+parameter.Name+"}", url.PathEscape(value), -1)
+        case "query":
+            if result.Query == nil {
+                result.Query = make(map[string]string)
+            }
+            result.Query[parameter.Name] = value
+        case "header":
+            if result.Headers == nil {
+                result.Headers = make(map[string]string)
+            }
+            result.Headers[parameter.Name] = value
+        case "cookie":
+            cookies = append(cookies, parameter.Name+"="+value)
+        }
+    }
+    if len(cookies) > 0 {
+        if result.Headers == nil {
+            result.Headers = make(map[string]string)
+        }
+        result.Headers["Cookie"] = strings.Join(cookies, "; ")
+    }
+
+    if body := spec.ResolveRequestBody(operation.RequestBody); body != nil {
+        if contentType, media, ok := body.Media(); ok {
+            example := media.Example
+            if example == nil {
+                example = spec.Example(media.Schema, 0)
+            }
+            spec.BuildBody(&result, contentType, example)
+        }
+    }
+
+    return result
+}
+
+// MergeParameters applies the operation parameters over the path item
+// ones, as both levels may define the same name and location.
+func (spec *OpenAPI) MergeParameters(common []*OpenAPIParameter, specific []*OpenAPIParameter) []*OpenAPIParameter {
+    merged := make([]*OpenAPIParameter, 0, len(common)+len(specific))
+    positions := make(map[string]int)
+    for _, parameter := range append(append([]*OpenAPIParameter{}, common...), specific...) {
+        parameter = spec.ResolveParameter(parameter)
+        if parameter == nil {
+            continue
+        }
+        key := parameter.In + ":" + parameter.Name
+        if position, ok := positions[key]; ok {
+            merged[position] = parameter
+            continue
+        }
+        positions[key] = len(merged)
+        merged = append(merged, parameter)
+    }
+    return merged
+}
+
+func (body *OpenAPIRequestBody) Media() (string, OpenAPIMediaType, bool) {
+    const (
+        jsonContentType = "application/json"
+    )
+    if media, ok := body.Content[jsonContentType]; ok {
+        return jsonContentType, media, true
+    }
+    types := make([]string, 0, len(body.Content))
+    for contentType := range body.Content {
+        types = append(types, contentType)
+    }
+    sort.Strings(types)
+    for _, contentType := range types {
+        if strings.Contains(contentType, "json") {
+            return contentType, body.Content[contentType], true
+        }
+    }
+    if len(types) > 0 {
+        return types[0], body.Content[types[0]], true
+    }
+    return "", OpenAPIMediaType{}, false
+}
+
+// BuildBody sends object examples as the payload, which fuzzing mutates.
+// Arrays and primitives go as a raw body with the documented content
+// type, written as JSON unless a text example is documented for another
+// media type.
+func (spec *OpenAPI) BuildBody(operation *Operation, contentType string, example interface{}) {
+    if example == nil {
+        return
+    }
+    if object, ok := example.(map[string]interface{}); ok {
+        operation.Payload = Payload(object)
+        return
+    }
+    text, isText := example.(string)
+    if !isText || strings.Contains(contentType, "json") {
+        body, err := json.Marshal(example)
+        if err != nil {
+            return
+        }
+        text = string(body)
+    }
+    if operation.Headers == nil {
+        operation.Headers = make(map[string]string)
+    }
+    operation.Headers["Content-Type"] = contentType
+    operation.Body, operation.Encoding = text, EncodingText
+}
+
+func (spec *OpenAPI) ParameterExample(parameter *OpenAPIParameter) interface{} {
+    switch {
+    case parameter.Example != nil:
+        return parameter.Example
+    case parameter.Schema != nil:
+        return spec.Example(parameter.Schema, 0)
+    }
+    return spec.Example(&Schema{
+        Type:    parameter.Type,
+        Format:  parameter.Format,
+        Enum:    parameter.Enum,
+        Default: parameter.Default,
+        Items:   parameter.Items,
+    }, 0)
+}
+
+// Example builds a representative value for schema, preferring the
+// values documented by the spec over generated ones.
+func (spec *OpenAPI) Example(schema *Schema, depth int) interface{} {
+    schema = spec.ResolveSchema(schema)
+    if schema == nil || depth > maxExampleDepth {
+        return nil
+    }
+    switch {
+    case schema.Example != nil:
+        return schema.Example
+    case schema.Default != nil:
+        return schema.Default
+    case len(schema.Enum) > 0:
+        return schema.Enum[0]
+    case len(schema.AllOf) > 0:
+        merged := make(map[string]interface{})
+        for _, part := range schema.AllOf {
+            if object, ok := spec.Example(part, depth+1).(map[string]interface{}); ok {
+                for key, value := range object {
+                    merged[key] = value
+                }
+            }
+        }
+        return merged
+    case len(schema.OneOf) > 0:
+        return spec.Example(schema.OneOf[0], depth+1)
+    case len(schema.AnyOf) > 0:
+        return spec.Example(schema.AnyOf[0], depth+1)
+    }
+
+    switch schema.Type {
+    case "array":
+        return []interface{}{spec.Example(schema.Items, depth+1)}
+    case "integer":
+        return 1
+    case "number":
+        return 1.5
+    case "boolean":
+        return true
+    case "string":
+        return stringExample(schema.Format)
+    }
+
+    object := make(map[string]interface{})
+    for name, property := range schema.Properties {
+        object[name] = spec.Example(property, depth+1)
+    }
+    return object
+}
+
+func stringExample(format string) string {
+    switch format {
+    case "date":
+        return "2019-01-01"
+    case "date-time":
+        return "2019-01-01T00:00:00Z"
+    case "email":
+        return "test@example.com"
+    case "uuid":
+        return "00000000-0000-0000-0000-000000000000"
+    case "uri", "url":
+        return "http://example.com"
+    case "ipv4":
+        return "127.0.0.1"
+    case "byte":
+        return "dGVzdA=="
+    }
+    return "test"
+}
+
+func (spec *OpenAPI) ResolveSchema(schema *Schema) *Schema {
+    for i := 0; schema != nil && schema.Ref != "" && i < maxExampleDepth; i++ {
+        name := refName(schema.Ref)
+        if resolved, ok := spec.Components.Schemas[name]; ok {
+            schema = resolved
+            continue
+        }
+        schema = spec.Definitions[name]
+    }
+    return schema
+}
+
+func (spec *OpenAPI) ResolveParameter(parameter *OpenAPIParameter) *OpenAPIParameter {
+    for i := 0; parameter != nil && parameter.Ref != "" && i < maxExampleDepth; i++ {
+        name := refName(parameter.Ref)
+        if resolved, ok := spec.Components.Parameters[name]; ok {
+            parameter = resolved
+            continue
+        }
+        parameter = spec.Parameters[name]
+    }
+    return parameter
+}
+
+func (spec *OpenAPI) ResolveRequestBody(body *OpenAPIRequestBody) *OpenAPIRequestBody {
+    for i := 0; body != nil && body.Ref != "" && i < maxExampleDepth; i++ {
+        body = spec.Components.RequestBodies[refName(body.Ref)]
+    }
+    return body
+}
+
+func refName(ref string) string {
+    return ref[strings.LastIndex(ref, "/")+1:]
+}
@@ -0,0 +1,305 @@
+package app
+
+import (
+    "fmt"
+    "bytes"
+    "strings"
+    "net/url"
+    "io/ioutil"
+    "encoding/json"
+    "encoding/base64"
+    "mime/multipart"
+)
+
+type PostmanCollection struct {
+    Info     PostmanInfo       `json:"info"`
+    Items    []PostmanItem     `json:"item"`
+    Variable []PostmanKeyValue `json:"variable"`
+    Auth     *PostmanAuth      `json:"auth"`
+}
+
+type PostmanInfo struct {
+    Name   string `json:"name"`
+    Schema string `json:"schema"`
+}
+
+type PostmanItem struct {
+    Name    string          `json:"name"`
+    Items   []PostmanItem   `json:"item"`
+    Request json.RawMessage `json:"request"`
+    Auth    *PostmanAuth    `json:"auth"`
+}
+
+type PostmanRequest struct {
+    Method string            `json:"method"`
+    Header []PostmanKeyValue `json:"header"`
+    Body   *PostmanBody      `json:"body"`
+    URL    json.RawMessage   `json:"url"`
+    Auth   *PostmanAuth      `json:"auth"`
+}
+
+type PostmanURL struct {
+    Raw string `json:"raw"`
+}
+
+type PostmanBody struct {
+    Mode       string            `json:"mode"`
+    Raw        string            `json:"raw"`
+    URLEncoded []PostmanKeyValue `json:"urlencoded"`
+    FormData   []PostmanKeyValue `json:"formdata"`
+    GraphQL    json.RawMessage   `json:"graphql"`
+    Disabled   bool              `json:"disabled"`
+    Options    struct {
+        Raw struct {
+            Language string `json:"language"`
+        } `json:"raw"`
+    } `json:"options"`
+}
+
+type PostmanKeyValue struct {
+    Key      string `json:"key"`
+    Value    string `json:"value"`
+    Type     string `json:"type"`
+    Disabled bool   `json:"disabled"`
+}
+
+type PostmanAuth struct {
+    Type   string            `json:"type"`
+    Bearer []PostmanKeyValue `json:"bearer"`
+    Basic  []PostmanKeyValue `json:"basic"`
+    APIKey []PostmanKeyValue `json:"apikey"`
+}
+
+func LoadPostman(filename string) (*PostmanCollection, error) {
+    bytes, err := ioutil.ReadFile(filename)
+    if err != nil {
+        return nil, err
+    }
+    var collection PostmanCollection
+    if err := json.Unmarshal(bytes, &collection); err != nil {
+        return nil, err
+    }
+    return &collection, nil
+}
+
+func (collection *PostmanCollection) Config() (*Config, error) {
+    operations, err := collection.Operations(collection.Items, "", collection.Auth)
+    if err != nil {
+        return nil, err
+    }
+    return ImportedConfig(operations), nil
+}
+
+// Operations flattens the folder tree, naming every request after the
+// folders it belongs to and its position in each, as names may repeat.
+// Auth is inherited from the closest parent.
+func (collection *PostmanCollection) Operations(items []PostmanItem, prefix string, auth *PostmanAuth) ([]Operation, error) {
+    const (
+        errInvalidRequest = "invalid request %s: %v"
+        itemFormat        = "%d %s"
+    )
+    operations := make([]Operation, 0)
+    for i, item := range items {
+        name := prefix + fmt.Sprintf(itemFormat, i+1, item.Name)
+        itemAuth := auth
+        if item.Auth != nil {
+            itemAuth = item.Auth
+        }
+        if len(item.Items) > 0 {
+            children, err := collection.Operations(item.Items, name+"/", itemAuth)
+            if err != nil {
+                return nil, err
+            }
+            operations = append(operations, children...)
+            continue
+        }
+        if len(item.Request) == 0 {
+            continue
+        }
+        operation, err := collection.BuildOperation(name, item.Request, itemAuth)
+        if err != nil {
+            return nil, fmt.Errorf(errInvalidRequest, name, err)
+        }
+        operations = append(operations, operation)
+    }
+    return operations, nil
+}
+
+func (collection *PostmanCollection) BuildOperation(name string, raw json.RawMessage, auth *PostmanAuth) (Operation, error) {
+    var request PostmanRequest
+    var target string
+    if err := json.Unmarshal(raw, &target); err != nil {
+        if err := json.Unmarshal(raw, &request); err != nil {
+            return Operation{}, err
+        }
+        if target, err = request.RawURL(); err != nil {
+            return Operation{}, err
+        }
+    }
+    if request.Method == "" {
+        request.Method = "GET"
+    }
+    if request.Auth != nil {
+        auth = request.Auth
+    }
+
+    operation := Operation{
+        ID:      name,
+        Method:  strings.ToUpper(request.Method),
+        URL:     collection.Resolve(target),
+        Headers: make(map[string]string),
+    }
+    for _, header := range request.Header {
+        if header.Disabled {
+            continue
+        }
+        operation.Headers[header.Key] = collection.Resolve(header.Value)
+    }
+    if err := collection.ApplyAuth(&operation, auth); err != nil {
+        return Operation{}, err
+    }
+    if err := collection.ApplyBody(&operation, request.Body); err != nil {
+        return Operation{}, err
+    }
+    if len(operation.Headers) == 0 {
+        operation.Headers = nil
+    }
+    return operation, nil
+}
+
+func (request *PostmanRequest) RawURL() (string, error) {
+    if len(request.URL) == 0 {
+        return "", nil
+    }
+    var target string
+    if err := json.Unmarshal(request.URL, &target); err == nil {
+        return target, nil
+    }
+    var structured PostmanURL
+    if err := json.Unmarshal(request.URL, &structured); err != nil {
+        return "", err
+    }
+    return structured.Raw, nil
+}
+
+func (collection *PostmanCollection) ApplyAuth(operation *Operation, auth *PostmanAuth) error {
+    if auth == nil {
+        return nil
+    }
+    switch auth.Type {
+    case "bearer":
+        operation.Headers["Authorization"] = "Bearer " + collection.Resolve(postmanValue(auth.Bearer, "token"))
+    case "basic":
+        credentials := collection.Resolve(postmanValue(auth.Basic, "username")) + ":" + collection.Resolve(postmanValue(auth.Basic, "password"))
+        operation.Headers["Authorization"] = "Basic " + base64.StdEncoding.EncodeToString([]byte(credentials))
+    case "apikey":
+        key := collection.Resolve(postmanValue(auth.APIKey, "key"))
+        value := collection.Resolve(postmanValue(auth.APIKey, "value"))
+        if postmanValue(auth.APIKey, "in") != "query" {
+            operation.Headers[key] = value
+            return nil
+        }
+        target, err := url.Parse(operation.URL)
+        if err != nil {
+            return err
+        }
+        query := target.Query()
+        query.Set(key, value)
+        target.RawQuery = query.Encode()
+        operation.URL = target.String()
+    }
+    return nil
+}
+
+// ApplyBody keeps the body as captured: JSON objects as payloads, other
+// raw bodies as text, url encoded
+// and multipart forms rendered with their content type, and GraphQL as
+// its JSON envelope.
+func (collection *PostmanCollection) ApplyBody(operation *Operation, body *PostmanBody) error {
+    if body == nil || body.Disabled {
+        return nil
+    }
+    switch body.Mode {
+    case "raw":
+        operation.Body = collection.Resolve(body.Raw)
+        operation.Encoding = EncodingText
+        if body.Options.Raw.Language == "json" {
+            setDefaultHeader(operation.Headers, "Content-Type", "application/json")
+        }
+        ImportJSONBody(operation)
+    case "urlencoded":
+        values := make(url.Values)
+        for _, field := range body.URLEncoded {
+            if field.Disabled {
+                continue
+            }
+            values.Add(collection.Resolve(field.Key), collection.Resolve(field.Value))
+        }
+        operation.Body = values.Encode()
+        operation.Encoding = EncodingText
+        setDefaultHeader(operation.Headers, "Content-Type", "application/x-www-form-urlencoded")
+    case "formdata":
+        fields := make([][2]string, 0, len(body.FormData))
+        for _, field := range body.FormData {
+            if field.Disabled {
+                continue
+            }
+            fields = append(fields, [2]string{collection.Resolve(field.Key), collection.Resolve(field.Value)})
+        }
+        data, contentType, err := MultipartBody(fields)
+        if err != nil {
+            return err
+        }
+        operation.Body = base64.StdEncoding.EncodeToString(data)
+        operation.Encoding = EncodingBase64
+        operation.Headers["Content-Type"] = contentType
+    case "graphql":
+        operation.Body = collection.Resolve(string(body.GraphQL))
+        operation.Encoding = EncodingText
+        setDefaultHeader(operation.Headers, "Content-Type", "application/json")
+    }
+    return nil
+}
+
+// Resolve replaces the collection variables. Unknown ones are kept as
+// they are so they can still be filled in by hand.
+func (collection *PostmanCollection) Resolve(value string) string {
+    for _, variable := range collection.Variable {
+        value = strings.Replace(value, "{{"+variable.Key+"}}", variable.Value, -1)
+    }
+    return value
+}
+
+func postmanValue(values []PostmanKeyValue, key string) string {
+    for _, value := range values {
+        if value.Key == key {
+            return value.Value
+        }
+    }
+    return ""
+}
+
+func setDefaultHeader(headers map[string]string, name string, value string) {
+    for key := range headers {
+        if strings.EqualFold(key, name) {
+            return
+        }
+    }
+    headers[name] = value
+}
+
+// MultipartBody renders name/value pairs as a multipart form, returning
+// the body and its content type.
+func MultipartBody(fields [][2]string) ([]byte, string, error) {
+    var buffer bytes.Buffer
+    writer := multipart.NewWriter(&buffer)
+    for _, field := range fields {
+        if err := writer.WriteField(field[0], field[1]); err != nil {
+            return nil, "", err
+        }
+    }
+    if err := writer.Close(); err != nil {
+        return nil, "", err
+    }
+    return buffer.Bytes(), writer.FormDataContentType(), nil
+}
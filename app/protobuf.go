@@ -0,0 +1,606 @@
+package app
+
+import (
+    "fmt"
+    "math"
+    "errors"
+    "strconv"
+    "strings"
+    "unicode/utf8"
+    "encoding/base64"
+    "encoding/binary"
+)
+
+// field types, numbered as in descriptor.proto
+const (
+    protoDouble   = 1
+    protoFloat    = 2
+    protoInt64    = 3
+    protoUint64   = 4
+    protoInt32    = 5
+    protoFixed64  = 6
+    protoFixed32  = 7
+    protoBool     = 8
+    protoString   = 9
+    protoGroup    = 10
+    protoMessage  = 11
+    protoBytes    = 12
+    protoUint32   = 13
+    protoEnum     = 14
+    protoSfixed32 = 15
+    protoSfixed64 = 16
+    protoSint32   = 17
+    protoSint64   = 18
+)
+
+// wire types
+const (
+    wireVarint  = 0
+    wireFixed64 = 1
+    wireBytes   = 2
+    wireStart   = 3
+    wireEnd     = 4
+    wireFixed32 = 5
+)
+
+var (
+    protoScalars = map[string]int{
+        "double":   protoDouble,
+        "float":    protoFloat,
+        "int64":    protoInt64,
+        "uint64":   protoUint64,
+        "int32":    protoInt32,
+        "fixed64":  protoFixed64,
+        "fixed32":  protoFixed32,
+        "bool":     protoBool,
+        "string":   protoString,
+        "bytes":    protoBytes,
+        "uint32":   protoUint32,
+        "sfixed32": protoSfixed32,
+        "sfixed64": protoSfixed64,
+        "sint32":   protoSint32,
+        "sint64":   protoSint64,
+    }
+)
+
+// ProtoSchema holds the messages, enums and services of a set of proto
+// files, by full name without the leading dot, whether they were parsed
+// or got through server reflection.
+type ProtoSchema struct {
+    Messages map[string]*ProtoMessage
+    Enums    map[string]*ProtoEnum
+    Services []ProtoService
+
+    files map[string]bool
+}
+
+type ProtoMessage struct {
+    Name     string
+    Fields   []ProtoField
+    MapEntry bool
+}
+
+// ProtoField is a field of a message. TypeName names the message or enum
+// of those types.
+type ProtoField struct {
+    Name     string
+    JSONName string
+    Number   int
+    Type     int
+    TypeName string
+    Repeated bool
+}
+
+type ProtoEnum struct {
+    Name   string
+    Values []ProtoEnumValue
+}
+
+type ProtoEnumValue struct {
+    Name   string
+    Number int32
+}
+
+type ProtoService struct {
+    Name    string
+    Methods []ProtoMethod
+}
+
+type ProtoMethod struct {
+    Name            string
+    Input           string
+    Output          string
+    ClientStreaming bool
+    ServerStreaming bool
+}
+
+// protoRaw is a field as read off the wire.
+type protoRaw struct {
+    number int
+    wire   int
+    value  uint64
+    bytes  []byte
+}
+
+func NewProtoSchema() *ProtoSchema {
+    return &ProtoSchema{
+        Messages: make(map[string]*ProtoMessage),
+        Enums:    make(map[string]*ProtoEnum),
+        Services: make([]ProtoService, 0),
+        files:    make(map[string]bool),
+    }
+}
+
+// Field finds the field of the message by its name or JSON name.
+func (message *ProtoMessage) Field(name string) *ProtoField {
+    for i := range message.Fields {
+        if message.Fields[i].Name == name || message.Fields[i].JSONName == name {
+            return &message.Fields[i]
+        }
+    }
+    return nil
+}
+
+func (message *ProtoMessage) FieldByNumber(number int) *ProtoField {
+    for i := range message.Fields {
+        if message.Fields[i].Number == number {
+            return &message.Fields[i]
+        }
+    }
+    return nil
+}
+
+// Encode writes the payload as the named message. Values that don't fit
+// the field type go on the wire as their own type, which is what type
+// confusion mutations are after; names the message lacks are left out.
+func (schema *ProtoSchema) Encode(name string, payload map[string]interface{}) []byte {
+    message := schema.Messages[name]
+    if message == nil {
+        return []byte{}
+    }
+    buffer := make([]byte, 0)
+    for _, key := range sortedKeys(payload) {
+        if field := message.Field(key); field != nil {
+            buffer = schema.encodeField(buffer, field, payload[key])
+        }
+    }
+    return buffer
+}
+
+func (schema *ProtoSchema) encodeField(buffer []byte, field *ProtoField, value interface{}) []byte {
+    switch typed := value.(type) {
+    case nil:
+        return buffer
+    case []interface{}:
+        for _, item := range typed {
+            buffer = schema.encodeField(buffer, field, item)
+        }
+        return buffer
+    case map[string]interface{}:
+        entry := schema.Messages[field.TypeName]
+        if field.Type == protoMessage && entry != nil && entry.MapEntry {
+            keyField, valueField := entry.FieldByNumber(1), entry.FieldByNumber(2)
+            for _, key := range sortedKeys(typed) {
+                encoded := make([]byte, 0)
+                if keyField != nil {
+                    encoded = schema.encodeField(encoded, keyField, protoMapKey(keyField, key))
+                }
+                if valueField != nil {
+                    encoded = schema.encodeField(encoded, valueField, typed[key])
+                }
+                buffer = appendBytes(appendTag(buffer, field.Number, wireBytes), encoded)
+            }
+            return buffer
+        }
+        if field.Type == protoMessage {
+            return appendBytes(appendTag(buffer, field.Number, wireBytes), schema.Encode(field.TypeName, typed))
+        }
+        return appendBytes(appendTag(buffer, field.Number, wireBytes), []byte(jsonText(typed)))
+    }
+
+    switch field.Type {
+    case protoString:
+        if text, ok := value.(string); ok {
+            return appendBytes(appendTag(buffer, field.Number, wireBytes), []byte(text))
+        }
+    case protoBytes:
+        if text, ok := value.(string); ok {
+            decoded, err := base64.StdEncoding.DecodeString(text)
+            if err != nil {
+                decoded = []byte(text)
+            }
+            return appendBytes(appendTag(buffer, field.Number, wireBytes), decoded)
+        }
+    case protoBool:
+        if flag, ok := value.(bool); ok {
+            bit := uint64(0)
+            if flag {
+                bit = 1
+            }
+            return appendVarint(appendTag(buffer, field.Number, wireVarint), bit)
+        }
+    case protoEnum:
+        if text, ok := value.(string); ok {
+            if enum := schema.Enums[field.TypeName]; enum != nil {
+                for _, enumValue := range enum.Values {
+                    if enumValue.Name == text {
+                        return appendVarint(appendTag(buffer, field.Number, wireVarint), uint64(int64(enumValue.Number)))
+                    }
+                }
+            }
+        }
+        if number, ok := protoInteger(value); ok {
+            return appendVarint(appendTag(buffer, field.Number, wireVarint), uint64(number))
+        }
+    case protoInt32, protoInt64, protoUint32, protoUint64:
+        if number, ok := protoInteger(value); ok {
+            return appendVarint(appendTag(buffer, field.Number, wireVarint), uint64(number))
+        }
+    case protoSint32, protoSint64:
+        if number, ok := protoInteger(value); ok {
+            return appendVarint(appendTag(buffer, field.Number, wireVarint), uint64(number<<1)^uint64(number>>63))
+        }
+    case protoFixed32, protoSfixed32:
+        if number, ok := protoInteger(value); ok {
+            return binary.LittleEndian.AppendUint32(appendTag(buffer, field.Number, wireFixed32), uint32(number))
+        }
+    case protoFixed64, protoSfixed64:
+        if number, ok := protoInteger(value); ok {
+            return binary.LittleEndian.AppendUint64(appendTag(buffer, field.Number, wireFixed64), uint64(number))
+        }
+    case protoFloat:
+        if number, ok := protoFloat64(value); ok {
+            return binary.LittleEndian.AppendUint32(appendTag(buffer, field.Number, wireFixed32), math.Float32bits(float32(number)))
+        }
+    case protoDouble:
+        if number, ok := protoFloat64(value); ok {
+            return binary.LittleEndian.AppendUint64(appendTag(buffer, field.Number, wireFixed64), math.Float64bits(number))
+        }
+    }
+    return appendLoose(buffer, field.Number, value)
+}
+
+// appendLoose writes the value with the wire type of its JSON type.
+func appendLoose(buffer []byte, number int, value interface{}) []byte {
+    switch typed := value.(type) {
+    case bool:
+        bit := uint64(0)
+        if typed {
+            bit = 1
+        }
+        return appendVarint(appendTag(buffer, number, wireVarint), bit)
+    case float64:
+        if integer, ok := protoInteger(typed); ok {
+            return appendVarint(appendTag(buffer, number, wireVarint), uint64(integer))
+        }
+        return binary.LittleEndian.AppendUint64(appendTag(buffer, number, wireFixed64), math.Float64bits(typed))
+    case string:
+        return appendBytes(appendTag(buffer, number, wireBytes), []byte(typed))
+    }
+    return appendBytes(appendTag(buffer, number, wireBytes), []byte(jsonText(value)))
+}
+
+// protoInteger reads integral numbers, as JSON numbers or in strings as
+// protojson writes 64 bit integers.
+func protoInteger(value interface{}) (int64, bool) {
+    switch typed := value.(type) {
+    case float64:
+        if typed == math.Trunc(typed) && math.Abs(typed) < math.MaxInt64 {
+            return int64(typed), true
+        }
+    case string:
+        if number, err := strconv.ParseInt(typed, 10, 64); err == nil {
+            return number, true
+        }
+        if number, err := strconv.ParseUint(typed, 10, 64); err == nil {
+            return int64(number), true
+        }
+    }
+    return 0, false
+}
+
+func protoFloat64(value interface{}) (float64, bool) {
+    switch typed := value.(type) {
+    case float64:
+        return typed, true
+    case string:
+        if number, err := strconv.ParseFloat(typed, 64); err == nil {
+            return number, true
+        }
+    }
+    return 0, false
+}
+
+// protoMapKey turns the JSON object key back into the type of the map
+// keys.
+func protoMapKey(field *ProtoField, key string) interface{} {
+    switch field.Type {
+    case protoString:
+        return key
+    case protoBool:
+        return key == "true"
+    }
+    if number, err := strconv.ParseFloat(key, 64); err == nil {
+        return number
+    }
+    return key
+}
+
+func appendTag(buffer []byte, number int, wire int) []byte {
+    return appendVarint(buffer, uint64(number)<<3|uint64(wire))
+}
+
+func appendVarint(buffer []byte, value uint64) []byte {
+    for value >= 0x80 {
+        buffer = append(buffer, byte(value)|0x80)
+        value >>= 7
+    }
+    return append(buffer, byte(value))
+}
+
+func appendBytes(buffer []byte, bytes []byte) []byte {
+    return append(appendVarint(buffer, uint64(len(bytes))), bytes...)
+}
+
+// readProto splits the message into its fields, groups read past.
+func readProto(data []byte) ([]protoRaw, error) {
+    const (
+        errTruncated = "truncated protobuf message"
+        errWireType  = "invalid wire type %d"
+    )
+    fields := make([]protoRaw, 0)
+    for len(data) > 0 {
+        key, size := binary.Uvarint(data)
+        if size <= 0 {
+            return fields, errors.New(errTruncated)
+        }
+        data = data[size:]
+        field := protoRaw{number: int(key >> 3), wire: int(key & 7)}
+        switch field.wire {
+        case wireVarint:
+            value, size := binary.Uvarint(data)
+            if size <= 0 {
+                return fields, errors.New(errTruncated)
+            }
+            field.value, data = value, data[size:]
+        case wireFixed64:
+            if len(data) < 8 {
+                return fields, errors.New(errTruncated)
+            }
+            field.value, data = binary.LittleEndian.Uint64(data), data[8:]
+        case wireFixed32:
+            if len(data) < 4 {
+                return fields, errors.New(errTruncated)
+            }
+            field.value, data = uint64(binary.LittleEndian.Uint32(data)), data[4:]
+        case wireBytes:
+            length, size := binary.Uvarint(data)
+            if size <= 0 || uint64(len(data)-size) < length {
+                return fields, errors.New(errTruncated)
+            }
+            field.bytes, data = data[size:size+int(length)], data[size+int(length):]
+        case wireStart, wireEnd:
+            continue
+        default:
+            return fields, fmt.Errorf(errWireType, field.wire)
+        }
+        fields = append(fields, field)
+    }
+    return fields, nil
+}
+
+// Decode reads the named message into JSON values the way protojson
+// writes them: JSON names, enum names, bytes in base64 and 64 bit
+// integers in strings. Fields the schema doesn't know are kept under
+// their numbers.
+func (schema *ProtoSchema) Decode(name string, data []byte) (map[string]interface{}, error) {
+    raws, err := readProto(data)
+    document := make(map[string]interface{})
+    message := schema.Messages[name]
+    for _, raw := range raws {
+        var field *ProtoField
+        if message != nil {
+            field = message.FieldByNumber(raw.number)
+        }
+        if field == nil {
+            document[strconv.Itoa(raw.number)] = looseValue(raw)
+            continue
+        }
+        key := orDefault(field.JSONName, field.Name)
+        entry := schema.Messages[field.TypeName]
+        switch {
+        case field.Type == protoMessage && entry != nil && entry.MapEntry:
+            values, _ := document[key].(map[string]interface{})
+            if values == nil {
+                values = make(map[string]interface{})
+            }
+            decoded, _ := schema.Decode(field.TypeName, raw.bytes)
+            var entryKey, entryValue interface{}
+            if keyField := entry.FieldByNumber(1); keyField != nil {
+                entryKey = decoded[orDefault(keyField.JSONName, keyField.Name)]
+            }
+            if valueField := entry.FieldByNumber(2); valueField != nil {
+                entryValue = decoded[orDefault(valueField.JSONName, valueField.Name)]
+            }
+            values[strings.Trim(jsonText(entryKey), `"`)] = entryValue
+            document[key] = values
+        case field.Repeated:
+            values, _ := document[key].([]interface{})
+            if raw.wire == wireBytes && field.Type != protoString && field.Type != protoBytes && field.Type != protoMessage {
+                // packed scalars
+                values = append(values, schema.unpack(field, raw.bytes)...)
+            } else {
+                values = append(values, schema.decodeValue(field, raw))
+            }
+            document[key] = values
+        default:
+            document[key] = schema.decodeValue(field, raw)
+        }
+    }
+    return document, err
+}
+
+func (schema *ProtoSchema) unpack(field *ProtoField, data []byte) []interface{} {
+    values := make([]interface{}, 0)
+    for len(data) > 0 {
+        raw := protoRaw{number: field.Number}
+        switch field.Type {
+        case protoFixed64, protoSfixed64, protoDouble:
+            if len(data) < 8 {
+                return values
+            }
+            raw.wire, raw.value, data = wireFixed64, binary.LittleEndian.Uint64(data), data[8:]
+        case protoFixed32, protoSfixed32, protoFloat:
+            if len(data) < 4 {
+                return values
+            }
+            raw.wire, raw.value, data = wireFixed32, uint64(binary.LittleEndian.Uint32(data)), data[4:]
+        default:
+            value, size := binary.Uvarint(data)
+            if size <= 0 {
+                return values
+            }
+            raw.wire, raw.value, data = wireVarint, value, data[size:]
+        }
+        values = append(values, schema.decodeValue(field, raw))
+    }
+    return values
+}
+
+// decodeValue reads the field value, as its wire type says when it does
+// not match the field type.
+func (schema *ProtoSchema) decodeValue(field *ProtoField, raw protoRaw) interface{} {
+    if raw.wire != protoWireType(field.Type) {
+        return looseValue(raw)
+    }
+    switch field.Type {
+    case protoMessage:
+        decoded, _ := schema.Decode(field.TypeName, raw.bytes)
+        return decoded
+    case protoString:
+        return string(raw.bytes)
+    case protoBytes:
+        return base64.StdEncoding.EncodeToString(raw.bytes)
+    case protoBool:
+        return raw.value != 0
+    case protoEnum:
+        if enum := schema.Enums[field.TypeName]; enum != nil {
+            for _, enumValue := range enum.Values {
+                if enumValue.Number == int32(raw.value) {
+                    return enumValue.Name
+                }
+            }
+        }
+        return float64(int32(raw.value))
+    case protoInt32:
+        return float64(int32(raw.value))
+    case protoUint32, protoFixed32:
+        return float64(uint32(raw.value))
+    case protoSfixed32:
+        return float64(int32(uint32(raw.value)))
+    case protoSint32:
+        return float64(int32(uint32(raw.value>>1) ^ -uint32(raw.value&1)))
+    case protoInt64, protoSfixed64:
+        return strconv.FormatInt(int64(raw.value), 10)
+    case protoUint64, protoFixed64:
+        return strconv.FormatUint(raw.value, 10)
+    case protoSint64:
+        return strconv.FormatInt(int64(raw.value>>1)^-int64(raw.value&1), 10)
+    case protoFloat:
+        return float64(math.Float32frombits(uint32(raw.value)))
+    case protoDouble:
+        return math.Float64frombits(raw.value)
+    }
+    return looseValue(raw)
+}
+
+func protoWireType(fieldType int) int {
+    switch fieldType {
+    case protoDouble, protoFixed64, protoSfixed64:
+        return wireFixed64
+    case protoFloat, protoFixed32, protoSfixed32:
+        return wireFixed32
+    case protoString, protoBytes, protoMessage:
+        return wireBytes
+    }
+    return wireVarint
+}
+
+// looseValue reads a field without schema: numbers as they are, bytes
+// as text when they read as such and in base64 otherwise.
+func looseValue(raw protoRaw) interface{} {
+    switch raw.wire {
+    case wireBytes:
+        if utf8.Valid(raw.bytes) {
+            return string(raw.bytes)
+        }
+        return base64.StdEncoding.EncodeToString(raw.bytes)
+    case wireFixed64:
+        return math.Float64frombits(raw.value)
+    }
+    return float64(raw.value)
+}
+
+// Sample writes a plain valid payload of the named message: every field
+// set, messages below filled down to a few levels.
+func (schema *ProtoSchema) Sample(name string, depth int) Payload {
+    message := schema.Messages[name]
+    payload := make(Payload)
+    if message == nil || depth > 3 {
+        return payload
+    }
+    for _, field := range message.Fields {
+        var value interface{}
+        entry := schema.Messages[field.TypeName]
+        switch field.Type {
+        case protoMessage:
+            if entry != nil && entry.MapEntry {
+                keyField, valueField := entry.FieldByNumber(1), entry.FieldByNumber(2)
+                if keyField == nil || valueField == nil {
+                    continue
+                }
+                key := strings.Trim(jsonText(schema.sampleScalar(keyField)), `"`)
+                mapValue := schema.sampleScalar(valueField)
+                if valueField.Type == protoMessage {
+                    mapValue = map[string]interface{}(schema.Sample(valueField.TypeName, depth+1))
+                }
+                payload[orDefault(field.JSONName, field.Name)] = map[string]interface{}{key: mapValue}
+                continue
+            }
+            value = map[string]interface{}(schema.Sample(field.TypeName, depth+1))
+        default:
+            value = schema.sampleScalar(&field)
+        }
+        if field.Repeated {
+            value = []interface{}{value}
+        }
+        payload[orDefault(field.JSONName, field.Name)] = value
+    }
+    return payload
+}
+
+func (schema *ProtoSchema) sampleScalar(field *ProtoField) interface{} {
+    switch field.Type {
+    case protoString:
+        return "test"
+    case protoBytes:
+        return base64.StdEncoding.EncodeToString([]byte("test"))
+    case protoBool:
+        return true
+    case protoEnum:
+        // the zero value is mostly left unspecified, so the first other
+        enum := schema.Enums[field.TypeName]
+        if enum == nil || len(enum.Values) == 0 {
+            return float64(0)
+        }
+        for _, value := range enum.Values {
+            if value.Number != 0 {
+                return value.Name
+            }
+        }
+        return enum.Values[0].Name
+    case protoDouble, protoFloat:
+        return 1.5
+    }
+    return float64(1)
+}
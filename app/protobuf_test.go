@@ -0,0 +1,148 @@
+package app
+
+import (
+    "bytes"
+    "testing"
+    "reflect"
+    _ "github.com/emikohmann/go-tester/app/internal/testflags"
+)
+
+// testProtoSchema is the schema of
+//
+//     enum Role { UNKNOWN = 0; ADMIN = 1; GUEST = -1; }
+//     message Item {
+//         message Child { string note = 1; }
+//         int32 id = 1; string name = 2; repeated int32 tags = 3;
+//         Role role = 4; sint32 delta = 5; sint64 offset = 6;
+//         map<string, int32> labels = 7; Child child = 8;
+//         uint64 size = 9; bytes data = 10; bool done = 11;
+//         double ratio = 12; fixed32 hash = 13; sfixed64 mark = 14;
+//     }
+func testProtoSchema() *ProtoSchema {
+    schema := NewProtoSchema()
+    schema.Enums["test.Role"] = &ProtoEnum{Name: "test.Role", Values: []ProtoEnumValue{
+        {Name: "UNKNOWN", Number: 0}, {Name: "ADMIN", Number: 1}, {Name: "GUEST", Number: -1},
+    }}
+    schema.Messages["test.Item.Child"] = &ProtoMessage{Name: "test.Item.Child", Fields: []ProtoField{
+        {Name: "note", JSONName: "note", Number: 1, Type: protoString},
+    }}
+    schema.Messages["test.Item.LabelsEntry"] = &ProtoMessage{Name: "test.Item.LabelsEntry", MapEntry: true, Fields: []ProtoField{
+        {Name: "key", JSONName: "key", Number: 1, Type: protoString},
+        {Name: "value", JSONName: "value", Number: 2, Type: protoInt32},
+    }}
+    schema.Messages["test.Item"] = &ProtoMessage{Name: "test.Item", Fields: []ProtoField{
+        {Name: "id", JSONName: "id", Number: 1, Type: protoInt32},
+        {Name: "name", JSONName: "name", Number: 2, Type: protoString},
+        {Name: "tags", JSONName: "tags", Number: 3, Type: protoInt32, Repeated: true},
+        {Name: "role", JSONName: "role", Number: 4, Type: protoEnum, TypeName: "test.Role"},
+        {Name: "delta", JSONName: "delta", Number: 5, Type: protoSint32},
+        {Name: "offset", JSONName: "offset", Number: 6, Type: protoSint64},
+        {Name: "labels", JSONName: "labels", Number: 7, Type: protoMessage, TypeName: "test.Item.LabelsEntry", Repeated: true},
+        {Name: "child", JSONName: "child", Number: 8, Type: protoMessage, TypeName: "test.Item.Child"},
+        {Name: "size", JSONName: "size", Number: 9, Type: protoUint64},
+        {Name: "data", JSONName: "data", Number: 10, Type: protoBytes},
+        {Name: "done", JSONName: "done", Number: 11, Type: protoBool},
+        {Name: "ratio", JSONName: "ratio", Number: 12, Type: protoDouble},
+        {Name: "hash", JSONName: "hash", Number: 13, Type: protoFixed32},
+        {Name: "mark", JSONName: "mark", Number: 14, Type: protoSfixed64},
+    }}
+    return schema
+}
+
+func TestProtoScalars(t *testing.T) {
+    cases := []struct {
+        name  string
+        value interface{}
+        wire  []byte
+    }{
+        {"id", float64(150), []byte{0x08, 0x96, 0x01}},
+        {"id", float64(-1), []byte{0x08, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01}},
+        {"name", "ab", []byte{0x12, 0x02, 'a', 'b'}},
+        {"role", "ADMIN", []byte{0x20, 0x01}},
+        {"role", "GUEST", []byte{0x20, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01}},
+        {"role", float64(7), []byte{0x20, 0x07}},
+        {"delta", float64(-2), []byte{0x28, 0x03}},
+        {"delta", float64(2), []byte{0x28, 0x04}},
+        {"delta", float64(-2147483648), []byte{0x28, 0xff, 0xff, 0xff, 0xff, 0x0f}},
+        {"offset", "-3", []byte{0x30, 0x05}},
+        {"offset", "9223372036854775807", []byte{0x30, 0xfe, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01}},
+        {"offset", "-9223372036854775808", []byte{0x30, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01}},
+        {"size", "18446744073709551615", []byte{0x48, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01}},
+        {"data", "AAH/", []byte{0x52, 0x03, 0x00, 0x01, 0xff}},
+        {"done", true, []byte{0x58, 0x01}},
+        {"ratio", 1.5, []byte{0x61, 0, 0, 0, 0, 0, 0, 0xf8, 0x3f}},
+        {"hash", float64(4294967295), []byte{0x6d, 0xff, 0xff, 0xff, 0xff}},
+        {"mark", "-2", []byte{0x71, 0xfe, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}},
+    }
+    schema := testProtoSchema()
+    for _, c := range cases {
+        encoded := schema.Encode("test.Item", map[string]interface{}{c.name: c.value})
+        if !bytes.Equal(encoded, c.wire) {
+            t.Errorf("encoding %s %v: got % x, want % x", c.name, c.value, encoded, c.wire)
+        }
+        decoded, err := schema.Decode("test.Item", c.wire)
+        if err != nil {
+            t.Errorf("decoding %s % x: %v", c.name, c.wire, err)
+            continue
+        }
+        if !reflect.DeepEqual(decoded[c.name], c.value) {
+            t.Errorf("decoding %s % x: got %#v, want %#v", c.name, c.wire, decoded[c.name], c.value)
+        }
+    }
+}
+
+func TestProtoMessage(t *testing.T) {
+    schema := testProtoSchema()
+    payload := map[string]interface{}{
+        "id":     float64(150),
+        "tags":   []interface{}{float64(1), float64(2), float64(300)},
+        "labels": map[string]interface{}{"a": float64(1), "b": float64(2)},
+        "child":  map[string]interface{}{"note": "n"},
+    }
+    // fields in the order of the payload keys, repeated scalars one by one
+    wire := []byte{
+        0x42, 0x03, 0x0a, 0x01, 'n',
+        0x08, 0x96, 0x01,
+        0x3a, 0x05, 0x0a, 0x01, 'a', 0x10, 0x01,
+        0x3a, 0x05, 0x0a, 0x01, 'b', 0x10, 0x02,
+        0x18, 0x01, 0x18, 0x02, 0x18, 0xac, 0x02,
+    }
+    if encoded := schema.Encode("test.Item", payload); !bytes.Equal(encoded, wire) {
+        t.Errorf("encoding: got % x, want % x", encoded, wire)
+    }
+
+    // as protoc writes it: field order, repeated scalars packed
+    packed := []byte{
+        0x08, 0x96, 0x01,
+        0x1a, 0x04, 0x01, 0x02, 0xac, 0x02,
+        0x3a, 0x05, 0x0a, 0x01, 'a', 0x10, 0x01,
+        0x3a, 0x05, 0x0a, 0x01, 'b', 0x10, 0x02,
+        0x42, 0x03, 0x0a, 0x01, 'n',
+    }
+    for _, data := range [][]byte{wire, packed} {
+        decoded, err := schema.Decode("test.Item", data)
+        if err != nil {
+            t.Fatalf("decoding % x: %v", data, err)
+        }
+        if !reflect.DeepEqual(decoded, payload) {
+            t.Errorf("decoding % x: got %#v, want %#v", data, decoded, payload)
+        }
+    }
+}
+
+func TestProtoUnknownFields(t *testing.T) {
+    schema := testProtoSchema()
+    // a string where the id goes, and a field the schema lacks
+    data := []byte{0x0a, 0x02, 'h', 'i', 0xa8, 0x01, 0x05}
+    decoded, err := schema.Decode("test.Item", data)
+    if err != nil {
+        t.Fatal(err)
+    }
+    want := map[string]interface{}{"id": "hi", "21": float64(5)}
+    if !reflect.DeepEqual(decoded, want) {
+        t.Errorf("got %#v, want %#v", decoded, want)
+    }
+    if _, err := schema.Decode("test.Item", []byte{0x12, 0x05, 'a'}); err == nil {
+        t.Error("truncated message decoded without error")
+    }
+}
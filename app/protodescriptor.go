@@ -0,0 +1,171 @@
+package app
+
+import (
+    "strings"
+)
+
+// AddDescriptor reads a serialized FileDescriptorProto, as server
+// reflection hands them over, into the schema. Files already read are
+// skipped.
+func (schema *ProtoSchema) AddDescriptor(data []byte) error {
+    raws, err := readProto(data)
+    if err != nil {
+        return err
+    }
+    name, pkg := descriptorString(raws, 1), descriptorString(raws, 2)
+    if schema.files[name] {
+        return nil
+    }
+    schema.files[name] = true
+    for _, raw := range raws {
+        switch raw.number {
+        case 4:
+            err = schema.addMessageDescriptor(pkg, raw.bytes)
+        case 5:
+            err = schema.addEnumDescriptor(pkg, raw.bytes)
+        case 6:
+            err = schema.addServiceDescriptor(pkg, raw.bytes)
+        }
+        if err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// addMessageDescriptor reads a DescriptorProto, and the messages and
+// enums nested in it.
+func (schema *ProtoSchema) addMessageDescriptor(scope string, data []byte) error {
+    raws, err := readProto(data)
+    if err != nil {
+        return err
+    }
+    message := &ProtoMessage{Name: joinProtoName(scope, descriptorString(raws, 1)), Fields: make([]ProtoField, 0)}
+    schema.Messages[message.Name] = message
+    for _, raw := range raws {
+        switch raw.number {
+        case 2:
+            field, err := readFieldDescriptor(raw.bytes)
+            if err != nil {
+                return err
+            }
+            message.Fields = append(message.Fields, field)
+        case 3:
+            err = schema.addMessageDescriptor(message.Name, raw.bytes)
+        case 4:
+            err = schema.addEnumDescriptor(message.Name, raw.bytes)
+        case 7:
+            options, _ := readProto(raw.bytes)
+            for _, option := range options {
+                if option.number == 7 && option.wire == wireVarint {
+                    message.MapEntry = option.value != 0
+                }
+            }
+        }
+        if err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// readFieldDescriptor reads a FieldDescriptorProto.
+func readFieldDescriptor(data []byte) (ProtoField, error) {
+    const (
+        labelRepeated = 3
+    )
+    field := ProtoField{}
+    raws, err := readProto(data)
+    if err != nil {
+        return field, err
+    }
+    for _, raw := range raws {
+        switch raw.number {
+        case 1:
+            field.Name = string(raw.bytes)
+        case 3:
+            field.Number = int(raw.value)
+        case 4:
+            field.Repeated = raw.value == labelRepeated
+        case 5:
+            field.Type = int(raw.value)
+        case 6:
+            field.TypeName = strings.TrimPrefix(string(raw.bytes), ".")
+        case 10:
+            field.JSONName = string(raw.bytes)
+        }
+    }
+    if field.JSONName == "" {
+        field.JSONName = protoJSONName(field.Name)
+    }
+    return field, nil
+}
+
+func (schema *ProtoSchema) addEnumDescriptor(scope string, data []byte) error {
+    raws, err := readProto(data)
+    if err != nil {
+        return err
+    }
+    enum := &ProtoEnum{Name: joinProtoName(scope, descriptorString(raws, 1)), Values: make([]ProtoEnumValue, 0)}
+    for _, raw := range raws {
+        if raw.number != 2 {
+            continue
+        }
+        values, err := readProto(raw.bytes)
+        if err != nil {
+            return err
+        }
+        value := ProtoEnumValue{Name: descriptorString(values, 1)}
+        for _, field := range values {
+            if field.number == 2 {
+                value.Number = int32(field.value)
+            }
+        }
+        enum.Values = append(enum.Values, value)
+    }
+    schema.Enums[enum.Name] = enum
+    return nil
+}
+
+func (schema *ProtoSchema) addServiceDescriptor(scope string, data []byte) error {
+    raws, err := readProto(data)
+    if err != nil {
+        return err
+    }
+    service := ProtoService{Name: joinProtoName(scope, descriptorString(raws, 1)), Methods: make([]ProtoMethod, 0)}
+    for _, raw := range raws {
+        if raw.number != 2 {
+            continue
+        }
+        fields, err := readProto(raw.bytes)
+        if err != nil {
+            return err
+        }
+        method := ProtoMethod{
+            Name:   descriptorString(fields, 1),
+            Input:  strings.TrimPrefix(descriptorString(fields, 2), "."),
+            Output: strings.TrimPrefix(descriptorString(fields, 3), "."),
+        }
+        for _, field := range fields {
+            switch field.number {
+            case 5:
+                method.ClientStreaming = field.value != 0
+            case 6:
+                method.ServerStreaming = field.value != 0
+            }
+        }
+        service.Methods = append(service.Methods, method)
+    }
+    schema.Services = append(schema.Services, service)
+    return nil
+}
+
+// descriptorString finds the string field of the descriptor.
+func descriptorString(raws []protoRaw, number int) string {
+    for _, raw := range raws {
+        if raw.number == number && raw.wire == wireBytes {
+            return string(raw.bytes)
+        }
+    }
+    return ""
+}
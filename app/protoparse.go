@@ -0,0 +1,412 @@
+package app
+
+import (
+    "fmt"
+    "os"
+    "strconv"
+    "strings"
+    "io/ioutil"
+    "path/filepath"
+)
+
+// protoParser reads the messages, enums and services of a proto file,
+// the parts requests are built from. Options, reserved ranges and
+// extensions are read past.
+type protoParser struct {
+    sdlParser
+    schema  *ProtoSchema
+    pkg     string
+    imports []string
+}
+
+// LoadProtoFiles parses the proto files and those they import, looked up
+// next to the importing file, then in the import paths. Imports found
+// nowhere, as the well known types mostly are, are skipped.
+func LoadProtoFiles(paths []string, importPaths []string) (*ProtoSchema, error) {
+    const (
+        errParsing = "error parsing %s: %v"
+    )
+    schema := NewProtoSchema()
+    queue := append([]string{}, paths...)
+    for len(queue) > 0 {
+        path := filepath.Clean(queue[0])
+        queue = queue[1:]
+        if schema.files[path] {
+            continue
+        }
+        schema.files[path] = true
+        bytes, err := ioutil.ReadFile(path)
+        if err != nil {
+            return nil, err
+        }
+        imports, err := ParseProto(string(bytes), schema)
+        if err != nil {
+            return nil, fmt.Errorf(errParsing, path, err)
+        }
+        for _, imported := range imports {
+            candidates := append([]string{filepath.Join(filepath.Dir(path), imported)}, importPaths...)
+            for i := 1; i < len(candidates); i++ {
+                candidates[i] = filepath.Join(candidates[i], imported)
+            }
+            for _, candidate := range candidates {
+                if _, err := os.Stat(candidate); err == nil {
+                    queue = append(queue, candidate)
+                    break
+                }
+            }
+        }
+    }
+    schema.resolveAll()
+    return schema, nil
+}
+
+// ParseProto reads a proto file into the schema, returning its imports.
+// Type references are left as written until the schema resolves them.
+func ParseProto(text string, schema *ProtoSchema) ([]string, error) {
+    const (
+        errUnexpected = "unexpected %q in proto file at token %d"
+    )
+    parser := &protoParser{sdlParser: sdlParser{tokens: protoTokens(text)}, schema: schema, imports: make([]string, 0)}
+    for !parser.done() {
+        switch keyword := parser.next(); keyword {
+        case "syntax", "edition", "option":
+            parser.skipStatement()
+        case "package":
+            parser.pkg = parser.next()
+            parser.expect(";")
+        case "import":
+            if parser.peek() == "public" || parser.peek() == "weak" {
+                parser.next()
+            }
+            parser.imports = append(parser.imports, unquoteProto(parser.next()))
+            parser.expect(";")
+        case "message":
+            parser.message(parser.pkg)
+        case "enum":
+            parser.enum(parser.pkg)
+        case "service":
+            parser.service()
+        case "extend":
+            parser.next()
+            parser.skipBalanced()
+        case ";":
+        default:
+            return nil, fmt.Errorf(errUnexpected, keyword, parser.position)
+        }
+    }
+    return parser.imports, nil
+}
+
+func (parser *protoParser) message(scope string) {
+    message := &ProtoMessage{Name: joinProtoName(scope, parser.next()), Fields: make([]ProtoField, 0)}
+    parser.schema.Messages[message.Name] = message
+    parser.expect("{")
+    for !parser.done() && parser.peek() != "}" {
+        switch parser.peek() {
+        case "message":
+            parser.next()
+            parser.message(message.Name)
+        case "enum":
+            parser.next()
+            parser.enum(message.Name)
+        case "oneof":
+            parser.next()
+            parser.next()
+            parser.expect("{")
+            for !parser.done() && parser.peek() != "}" {
+                if parser.peek() == "option" {
+                    parser.skipStatement()
+                    continue
+                }
+                parser.field(message)
+            }
+            parser.expect("}")
+        case "option", "reserved", "extensions":
+            parser.skipStatement()
+        case "extend":
+            parser.next()
+            parser.next()
+            parser.skipBalanced()
+        case ";":
+            parser.next()
+        default:
+            parser.field(message)
+        }
+    }
+    parser.expect("}")
+}
+
+// field reads a field, map fields getting the entry message protoc
+// would generate.
+func (parser *protoParser) field(message *ProtoMessage) {
+    field := ProtoField{}
+    switch parser.peek() {
+    case "repeated":
+        field.Repeated = true
+        parser.next()
+    case "optional", "required":
+        parser.next()
+    }
+    typeName := parser.next()
+    switch {
+    case typeName == "map" && parser.peek() == "<":
+        parser.next()
+        key := protoFieldType(parser.next())
+        parser.expect(",")
+        value := protoFieldType(parser.next())
+        parser.expect(">")
+        field.Name = parser.next()
+        key.Name, key.JSONName, key.Number = "key", "key", 1
+        value.Name, value.JSONName, value.Number = "value", "value", 2
+        entry := &ProtoMessage{
+            Name:     message.Name + "." + protoTypeName(field.Name) + "Entry",
+            Fields:   []ProtoField{key, value},
+            MapEntry: true,
+        }
+        parser.schema.Messages[entry.Name] = entry
+        field.Type, field.TypeName, field.Repeated = protoMessage, entry.Name, true
+    case typeName == "group":
+        // long deprecated, and gone with proto3
+        for !parser.done() && parser.peek() != "{" {
+            parser.next()
+        }
+        parser.skipBalanced()
+        return
+    default:
+        typed := protoFieldType(typeName)
+        field.Type, field.TypeName = typed.Type, typed.TypeName
+        field.Name = parser.next()
+    }
+    field.JSONName = protoJSONName(field.Name)
+    parser.expect("=")
+    field.Number, _ = strconv.Atoi(parser.next())
+    if parser.peek() == "[" {
+        parser.skipBalanced()
+    }
+    parser.expect(";")
+    message.Fields = append(message.Fields, field)
+}
+
+func (parser *protoParser) enum(scope string) {
+    enum := &ProtoEnum{Name: joinProtoName(scope, parser.next()), Values: make([]ProtoEnumValue, 0)}
+    parser.schema.Enums[enum.Name] = enum
+    parser.expect("{")
+    for !parser.done() && parser.peek() != "}" {
+        switch parser.peek() {
+        case "option", "reserved":
+            parser.skipStatement()
+        case ";":
+            parser.next()
+        default:
+            value := ProtoEnumValue{Name: parser.next()}
+            parser.expect("=")
+            number, _ := strconv.ParseInt(parser.next(), 0, 32)
+            value.Number = int32(number)
+            if parser.peek() == "[" {
+                parser.skipBalanced()
+            }
+            parser.expect(";")
+            enum.Values = append(enum.Values, value)
+        }
+    }
+    parser.expect("}")
+}
+
+func (parser *protoParser) service() {
+    service := ProtoService{Name: joinProtoName(parser.pkg, parser.next()), Methods: make([]ProtoMethod, 0)}
+    parser.expect("{")
+    for !parser.done() && parser.peek() != "}" {
+        switch parser.next() {
+        case "option":
+            parser.skipStatement()
+        case "rpc":
+            method := ProtoMethod{Name: parser.next()}
+            parser.expect("(")
+            if parser.peek() == "stream" {
+                parser.next()
+                method.ClientStreaming = true
+            }
+            method.Input = parser.next()
+            parser.expect(")")
+            parser.expect("returns")
+            parser.expect("(")
+            if parser.peek() == "stream" {
+                parser.next()
+                method.ServerStreaming = true
+            }
+            method.Output = parser.next()
+            parser.expect(")")
+            if parser.peek() == "{" {
+                parser.skipBalanced()
+            } else {
+                parser.expect(";")
+            }
+            service.Methods = append(service.Methods, method)
+        }
+    }
+    parser.expect("}")
+    parser.schema.Services = append(parser.schema.Services, service)
+}
+
+// skipStatement reads past the next semicolon, and past any aggregate
+// value the statement holds.
+func (parser *protoParser) skipStatement() {
+    for !parser.done() {
+        switch parser.peek() {
+        case "{", "[", "(":
+            parser.skipBalanced()
+            continue
+        }
+        if parser.next() == ";" {
+            return
+        }
+    }
+}
+
+// resolveAll replaces the type references as written in the files with
+// the full name of what they refer to.
+func (schema *ProtoSchema) resolveAll() {
+    for _, message := range schema.Messages {
+        for i := range message.Fields {
+            field := &message.Fields[i]
+            if field.Type != 0 {
+                continue
+            }
+            field.TypeName, field.Type = schema.resolve(message.Name, field.TypeName)
+        }
+    }
+    for i := range schema.Services {
+        service := &schema.Services[i]
+        for j := range service.Methods {
+            method := &service.Methods[j]
+            method.Input, _ = schema.resolve(service.Name, method.Input)
+            method.Output, _ = schema.resolve(service.Name, method.Output)
+        }
+    }
+}
+
+// resolve finds the type the name refers to from within the scope the
+// way protoc does: in the scope, then in each one enclosing it. Names
+// found nowhere are taken for messages of files that were not loaded.
+func (schema *ProtoSchema) resolve(scope string, name string) (string, int) {
+    if strings.HasPrefix(name, ".") {
+        scope, name = "", strings.TrimPrefix(name, ".")
+    }
+    for {
+        candidate := joinProtoName(scope, name)
+        if _, ok := schema.Messages[candidate]; ok {
+            return candidate, protoMessage
+        }
+        if _, ok := schema.Enums[candidate]; ok {
+            return candidate, protoEnum
+        }
+        if scope == "" {
+            return name, protoMessage
+        }
+        if dot := strings.LastIndex(scope, "."); dot >= 0 {
+            scope = scope[:dot]
+        } else {
+            scope = ""
+        }
+    }
+}
+
+// protoFieldType reads a field type, scalar or a reference to resolve.
+func protoFieldType(name string) ProtoField {
+    if scalar, ok := protoScalars[name]; ok {
+        return ProtoField{Type: scalar}
+    }
+    return ProtoField{TypeName: name}
+}
+
+// protoTypeName writes the field name in upper camel case, as protoc
+// names map entries after their field.
+func protoTypeName(name string) string {
+    camel := protoJSONName(name)
+    if camel == "" {
+        return camel
+    }
+    return strings.ToUpper(camel[:1]) + camel[1:]
+}
+
+func joinProtoName(scope string, name string) string {
+    if scope == "" {
+        return name
+    }
+    return scope + "." + name
+}
+
+// protoJSONName writes the field name in lower camel case, as protoc
+// does for JSON names.
+func protoJSONName(name string) string {
+    var builder strings.Builder
+    upper := false
+    for i := 0; i < len(name); i++ {
+        switch character := name[i]; {
+        case character == '_':
+            upper = true
+        case upper && 'a' <= character && character <= 'z':
+            builder.WriteByte(character - 'a' + 'A')
+            upper = false
+        default:
+            builder.WriteByte(character)
+            upper = false
+        }
+    }
+    return builder.String()
+}
+
+func unquoteProto(token string) string {
+    if unquoted, err := strconv.Unquote(token); err == nil {
+        return unquoted
+    }
+    return strings.Trim(token, `"'`)
+}
+
+// protoTokens splits the file into names, numbers, punctuation and
+// strings, dropping comments and white space.
+func protoTokens(text string) []string {
+    tokens := make([]string, 0)
+    text = strings.TrimPrefix(text, "\uFEFF")
+    for i := 0; i < len(text); {
+        character := text[i]
+        switch {
+        case character == ' ' || character == '\t' || character == '\n' || character == '\r':
+            i++
+        case strings.HasPrefix(text[i:], "//"):
+            for i < len(text) && text[i] != '\n' {
+                i++
+            }
+        case strings.HasPrefix(text[i:], "/*"):
+            end := strings.Index(text[i+2:], "*/")
+            if end < 0 {
+                return tokens
+            }
+            i += 2 + end + 2
+        case character == '"' || character == '\'':
+            start := i
+            for i++; i < len(text) && text[i] != character && text[i] != '\n'; i++ {
+                if text[i] == '\\' {
+                    i++
+                }
+            }
+            if i < len(text) {
+                i++
+            }
+            tokens = append(tokens, text[start:i])
+        case strings.IndexByte("{}()[];=<>,:", character) >= 0:
+            tokens = append(tokens, string(character))
+            i++
+        default:
+            start := i
+            for i < len(text) && isSDLNameByte(text[i]) {
+                i++
+            }
+            if i == start {
+                i++
+            }
+            tokens = append(tokens, text[start:i])
+        }
+    }
+    return tokens
+}
@@ -0,0 +1,142 @@
+package app
+
+import (
+    "os"
+    "testing"
+    "reflect"
+    "path/filepath"
+    _ "github.com/emikohmann/go-tester/app/internal/testflags"
+)
+
+const (
+    testAPIProto = `syntax = "proto3";
+package shop.v1;
+
+import "google/protobuf/empty.proto";
+import public "common/money.proto";
+
+option go_package = "example.com/shop";
+
+// an order with its lines
+message Order {
+    message Line {
+        enum Kind { KIND_UNSPECIFIED = 0; GOOD = 1; SERVICE = 2; }
+        string sku = 1;
+        Kind kind = 2;
+        common.Money price = 3 [deprecated = true];
+    }
+    reserved 4, 5;
+    string order_id = 1;
+    repeated Line lines = 2;
+    map<string, Line> by_sku = 3;
+    oneof paid_with {
+        string card_token = 6;
+        common.Money credit = 7;
+    }
+    Status status = 8;
+}
+
+enum Status { STATUS_UNSPECIFIED = 0; OPEN = 1; }
+
+service Orders {
+    option (google.api.default_host) = "shop.example.com";
+    rpc Get(Order) returns (Order);
+    rpc Watch(.shop.v1.Order) returns (stream Order.Line) {}
+}
+`
+    testMoneyProto = `syntax = "proto3";
+package common;
+
+message Money {
+    string currency = 1;
+    sint64 units = 2;
+}
+`
+)
+
+func TestLoadProtoFiles(t *testing.T) {
+    dir := t.TempDir()
+    files := map[string]string{
+        filepath.Join(dir, "api", "shop.proto"):                testAPIProto,
+        filepath.Join(dir, "include", "common", "money.proto"): testMoneyProto,
+    }
+    for path, text := range files {
+        if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+            t.Fatal(err)
+        }
+        if err := os.WriteFile(path, []byte(text), 0644); err != nil {
+            t.Fatal(err)
+        }
+    }
+    schema, err := LoadProtoFiles([]string{filepath.Join(dir, "api", "shop.proto")}, []string{filepath.Join(dir, "include")})
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    fields := func(name string) []ProtoField {
+        message := schema.Messages[name]
+        if message == nil {
+            t.Fatalf("message %s missing, got %v", name, sortedMessageNames(schema))
+        }
+        return message.Fields
+    }
+    want := []ProtoField{
+        {Name: "order_id", JSONName: "orderId", Number: 1, Type: protoString},
+        {Name: "lines", JSONName: "lines", Number: 2, Type: protoMessage, TypeName: "shop.v1.Order.Line", Repeated: true},
+        {Name: "by_sku", JSONName: "bySku", Number: 3, Type: protoMessage, TypeName: "shop.v1.Order.BySkuEntry", Repeated: true},
+        {Name: "card_token", JSONName: "cardToken", Number: 6, Type: protoString},
+        {Name: "credit", JSONName: "credit", Number: 7, Type: protoMessage, TypeName: "common.Money"},
+        {Name: "status", JSONName: "status", Number: 8, Type: protoEnum, TypeName: "shop.v1.Status"},
+    }
+    if got := fields("shop.v1.Order"); !reflect.DeepEqual(got, want) {
+        t.Errorf("Order fields:\n got %+v\nwant %+v", got, want)
+    }
+    want = []ProtoField{
+        {Name: "sku", JSONName: "sku", Number: 1, Type: protoString},
+        {Name: "kind", JSONName: "kind", Number: 2, Type: protoEnum, TypeName: "shop.v1.Order.Line.Kind"},
+        {Name: "price", JSONName: "price", Number: 3, Type: protoMessage, TypeName: "common.Money"},
+    }
+    if got := fields("shop.v1.Order.Line"); !reflect.DeepEqual(got, want) {
+        t.Errorf("Order.Line fields:\n got %+v\nwant %+v", got, want)
+    }
+    entry := schema.Messages["shop.v1.Order.BySkuEntry"]
+    if entry == nil || !entry.MapEntry || entry.Fields[1].TypeName != "shop.v1.Order.Line" {
+        t.Errorf("by_sku entry: got %+v", entry)
+    }
+    want = []ProtoField{
+        {Name: "currency", JSONName: "currency", Number: 1, Type: protoString},
+        {Name: "units", JSONName: "units", Number: 2, Type: protoSint64},
+    }
+    if got := fields("common.Money"); !reflect.DeepEqual(got, want) {
+        t.Errorf("imported Money fields:\n got %+v\nwant %+v", got, want)
+    }
+    if kind := schema.Enums["shop.v1.Order.Line.Kind"]; kind == nil || len(kind.Values) != 3 || kind.Values[2].Name != "SERVICE" {
+        t.Errorf("nested enum: got %+v", kind)
+    }
+
+    services := []ProtoService{{Name: "shop.v1.Orders", Methods: []ProtoMethod{
+        {Name: "Get", Input: "shop.v1.Order", Output: "shop.v1.Order"},
+        {Name: "Watch", Input: "shop.v1.Order", Output: "shop.v1.Order.Line", ServerStreaming: true},
+    }}}
+    if !reflect.DeepEqual(schema.Services, services) {
+        t.Errorf("services:\n got %+v\nwant %+v", schema.Services, services)
+    }
+}
+
+func TestParseProtoErrors(t *testing.T) {
+    if _, err := ParseProto("message A { string a = 1; }\n}", NewProtoSchema()); err == nil {
+        t.Error("stray brace parsed without error")
+    }
+    imports, err := ParseProto(`import "a.proto"; import weak "b.proto";`, NewProtoSchema())
+    if err != nil || !reflect.DeepEqual(imports, []string{"a.proto", "b.proto"}) {
+        t.Errorf("imports: got %v, %v", imports, err)
+    }
+}
+
+func sortedMessageNames(schema *ProtoSchema) []string {
+    names := make(map[string]interface{}, len(schema.Messages))
+    for name := range schema.Messages {
+        names[name] = nil
+    }
+    return sortedKeys(names)
+}
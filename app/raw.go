@@ -0,0 +1,413 @@
+package app
+
+import (
+    "fmt"
+    "net"
+    "sync"
+    "time"
+    "bytes"
+    "sort"
+    "regexp"
+    "strconv"
+    "strings"
+    "net/url"
+    "net/http"
+    "crypto/tls"
+)
+
+const (
+    TagDesync = "http-desync"
+
+    // what raw writes are recorded with as request method, the request
+    // lines being in the body
+    rawMethod = "RAW"
+
+    defaultRawTimeout = 5000
+    oversizedHeader   = 65536
+)
+
+var (
+    rawRequestLine = regexp.MustCompile(`(?m)^[A-Za-z]+ \S+ HTTP/\d\.\d\r?$`)
+
+    // the malformations, named for the attacks setting of the test
+    rawAttacks = []rawAttack{
+        {"cl-te", true, "POST {{path}} HTTP/1.1\r\nHost: {{host}}\r\n{{headers}}Content-Type: application/x-www-form-urlencoded\r\nTransfer-Encoding: chunked\r\nContent-Length: 4\r\nConnection: close\r\n\r\n1\r\nZ\r\nQ"},
+        {"te-cl", true, "POST {{path}} HTTP/1.1\r\nHost: {{host}}\r\n{{headers}}Content-Type: application/x-www-form-urlencoded\r\nContent-Length: 6\r\nTransfer-Encoding: chunked\r\nConnection: close\r\n\r\n0\r\n\r\nX"},
+        {"te-duplicate", true, "POST {{path}} HTTP/1.1\r\nHost: {{host}}\r\n{{headers}}Transfer-Encoding: chunked\r\nTransfer-Encoding: identity\r\nContent-Length: 4\r\nConnection: close\r\n\r\n1\r\nZ\r\nQ"},
+        {"te-space", true, "POST {{path}} HTTP/1.1\r\nHost: {{host}}\r\n{{headers}}Transfer-Encoding : chunked\r\nContent-Length: 4\r\nConnection: close\r\n\r\n1\r\nZ\r\nQ"},
+        {"te-tab", true, "POST {{path}} HTTP/1.1\r\nHost: {{host}}\r\n{{headers}}Transfer-Encoding:\tchunked\r\nContent-Length: 4\r\nConnection: close\r\n\r\n1\r\nZ\r\nQ"},
+        {"te-xchunked", true, "POST {{path}} HTTP/1.1\r\nHost: {{host}}\r\n{{headers}}Transfer-Encoding: xchunked\r\nContent-Length: 4\r\nConnection: close\r\n\r\n1\r\nZ\r\nQ"},
+        {"cl-duplicate", true, "POST {{path}} HTTP/1.1\r\nHost: {{host}}\r\n{{headers}}Content-Length: 3\r\nContent-Length: 8\r\nConnection: close\r\n\r\nabc"},
+        {"obs-fold", false, "GET {{path}} HTTP/1.1\r\nHost: {{host}}\r\n{{headers}}X-Folded: a\r\n b\r\nConnection: close\r\n\r\n"},
+        {"bare-lf", false, "GET {{path}} HTTP/1.1\nHost: {{host}}\n{{headers}}Connection: close\n\n"},
+        {"invalid-header-name", false, "GET {{path}} HTTP/1.1\r\nHost: {{host}}\r\n{{headers}}Bad Header: 1\r\n[Bad]: 1\r\nConnection: close\r\n\r\n"},
+        {"oversize-header", false, "GET {{path}} HTTP/1.1\r\nHost: {{host}}\r\n{{headers}}X-Oversized: " + strings.Repeat("A", oversizedHeader) + "\r\nConnection: close\r\n\r\n"},
+        {"pipelining", false, "GET {{path}} HTTP/1.1\r\nHost: {{host}}\r\n{{headers}}\r\nGET {{path}} HTTP/1.1\r\nHost: {{host}}\r\n{{headers}}Connection: close\r\n\r\n"},
+    }
+)
+
+// RawTest writes requests byte for byte over TCP, or TLS for https urls,
+// with the malformations net/http would never send: the Attacks, all of
+// them by default, and the raw Requests, where {{host}}, {{path}} and
+// {{headers}} stand for the target and the config headers. Responses are
+// read within Timeout milliseconds and parsed leniently. A request the
+// server doesn't answer while it answers a plain one, and more responses
+// than requests sent, are flagged as desync.
+type RawTest struct {
+    URL      string   `json:"url"`
+    Attacks  []string `json:"attacks,omitempty"`
+    Requests []string `json:"requests,omitempty"`
+    Timeout  int      `json:"timeout_ms,omitempty"`
+}
+
+type rawAttack struct {
+    name     string
+    probe    bool
+    template string
+}
+
+// RawCase is a raw write and how long the plain request took to answer.
+// Probes are requests a server out of sync with the one in front of it
+// would hang on. Recorded is the request with its credentials redacted.
+type RawCase struct {
+    Exploit  *Exploit
+    Name     string
+    Request  []byte
+    Recorded []byte
+    Probe    bool
+    Timeout  time.Duration
+    Baseline time.Duration
+}
+
+// RawResponse is a response as read leniently off the connection.
+type RawResponse struct {
+    Proto   string
+    Status  int
+    Headers http.Header
+    Body    []byte
+}
+
+// BuildRawCases writes the requests of every test. A plain request goes
+// first, timing how the target answers, and is a result of its own.
+func (config *Config) BuildRawCases() ([]*RawCase, []ExploitResult, error) {
+    const (
+        errAttack = "unknown raw attack %s"
+        baseline  = "GET {{path}} HTTP/1.1\r\nHost: {{host}}\r\n{{headers}}Connection: close\r\n\r\n"
+    )
+    cases := make([]*RawCase, 0)
+    results := make([]ExploitResult, 0)
+    for _, test := range config.Raw {
+        target := test.URL
+        if !strings.Contains(target, "://") {
+            target = config.BaseURL + target
+        }
+        exploit := config.BuildExploit(Endpoint{Path: test.URL}, target)
+        timeout := time.Duration(orDefaultInt(test.Timeout, defaultRawTimeout)) * time.Millisecond
+
+        for _, name := range test.Attacks {
+            found := false
+            for _, attack := range rawAttacks {
+                found = found || attack.name == name
+            }
+            if !found {
+                return nil, nil, fmt.Errorf(errAttack, name)
+            }
+        }
+
+        plain, recorded, err := exploit.RawRequest(baseline)
+        if err != nil {
+            return nil, nil, err
+        }
+        control := &RawCase{Exploit: exploit, Name: "baseline", Request: plain, Recorded: recorded, Timeout: timeout}
+        result := control.Run()
+        results = append(results, result)
+        if responded := append(append(ExploitPotentials{}, result.Potentials...), result.Passed...); len(responded) > 0 && responded[0].ResponseStatus != 0 {
+            control.Baseline = responded[0].Latency
+        }
+
+        add := func(name string, template string, probe bool) error {
+            request, recorded, err := exploit.RawRequest(template)
+            if err != nil {
+                return err
+            }
+            cases = append(cases, &RawCase{Exploit: exploit, Name: name, Request: request, Recorded: recorded, Probe: probe, Timeout: timeout, Baseline: control.Baseline})
+            return nil
+        }
+        for _, attack := range rawAttacks {
+            if len(test.Attacks) > 0 && !containsString(test.Attacks, attack.name) {
+                continue
+            }
+            if err := add(attack.name, attack.template, attack.probe); err != nil {
+                return nil, nil, err
+            }
+        }
+        // raw requests are written to probe, whatever else they do
+        for i, template := range test.Requests {
+            if err := add(fmt.Sprintf("request %d", i+1), template, true); err != nil {
+                return nil, nil, err
+            }
+        }
+    }
+    return cases, results, nil
+}
+
+// RawRequest fills the template with the target host and path, and the
+// exploit headers with its credentials. It returns the bytes to write
+// and the same with the credentials redacted, to record.
+func (exploit *Exploit) RawRequest(template string) ([]byte, []byte, error) {
+    const (
+        errAuthenticating = "error authenticating raw request: %v"
+    )
+    headers := CloneHeaders(exploit.Headers)
+    if headers == nil {
+        headers = make(http.Header)
+    }
+    target, err := exploit.Auth.Apply(headers, exploit.URL)
+    if err != nil {
+        return nil, nil, fmt.Errorf(errAuthenticating, err)
+    }
+    headers.Del("Host")
+    request, err := fillRawTemplate(template, target, headers)
+    if err != nil {
+        return nil, nil, err
+    }
+    redactedHeaders, redactedTarget := Redact(headers, target, exploit.Auth, exploit.Signing)
+    recorded, err := fillRawTemplate(template, redactedTarget, redactedHeaders)
+    if err != nil {
+        return nil, nil, err
+    }
+    return request, recorded, nil
+}
+
+func fillRawTemplate(template string, target string, headers http.Header) ([]byte, error) {
+    endpoint, err := url.Parse(target)
+    if err != nil {
+        return nil, err
+    }
+    // the headers end their lines as the template does
+    ending := "\r\n"
+    if !strings.Contains(template, ending) {
+        ending = "\n"
+    }
+    var lines strings.Builder
+    for _, name := range sortedHeaderNames(headers) {
+        for _, value := range headers[name] {
+            lines.WriteString(name + ": " + value + ending)
+        }
+    }
+    replacer := strings.NewReplacer("{{host}}", endpoint.Host, "{{path}}", endpoint.RequestURI(), "{{headers}}", lines.String())
+    return []byte(replacer.Replace(template)), nil
+}
+
+func sortedHeaderNames(headers http.Header) []string {
+    names := make([]string, 0, len(headers))
+    for name := range headers {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+    return names
+}
+
+func (rawCase *RawCase) AsyncExecute(group *sync.WaitGroup, limiter chan bool, out chan ExploitResult) {
+    defer group.Done()
+    out <- rawCase.Run()
+    <-limiter
+}
+
+// Run writes the request and reads until the server closes the
+// connection or the timeout, flagging a desync when the server hung on
+// the request or answered more requests than were sent.
+func (rawCase *RawCase) Run() ExploitResult {
+    const (
+        errHung  = "%s: no response within %v while a plain request is answered in %v"
+        errExtra = "%s: %d responses to %d requests, the last %d %s"
+    )
+    exploit := rawCase.Exploit
+    result := ExploitResult{
+        Potentials: make(ExploitPotentials, 0),
+        Passed:     make(ExploitPotentials, 0),
+        Failed:     make([]FailedRequest, 0),
+        Asserted:   len(exploit.Expectations) > 0,
+    }
+    potential := Potential{RequestMethod: rawMethod, RequestURL: exploit.URL, RequestBody: rawCase.Recorded}
+
+    data, latency, hung, err := rawCase.exchange()
+    potential.Latency = latency
+    if err != nil {
+        result.Failed = append(result.Failed, FailedRequest{Potential: potential, Err: err.Error()})
+        return result
+    }
+    responses := ParseRawResponses(data)
+    if len(responses) > 0 {
+        potential.ResponseStatus = responses[0].Status
+        potential.ResponseHeaders = responses[0].Headers
+        potential.ResponsePayload = responses[0].Body
+    } else {
+        // whatever came back, when nothing reads as a response
+        potential.ResponsePayload = data
+    }
+
+    if hung && rawCase.Probe && len(responses) == 0 && rawCase.Baseline > 0 {
+        potential.Failures = append(potential.Failures, fmt.Sprintf(errHung, rawCase.Name, rawCase.Timeout, rawCase.Baseline.Round(time.Microsecond)))
+    }
+    if sent := len(rawRequestLine.FindAll(rawCase.Request, -1)); len(responses) > sent && sent > 0 {
+        last := responses[len(responses)-1]
+        potential.Failures = append(potential.Failures, fmt.Sprintf(errExtra, rawCase.Name, len(responses), sent, last.Status, http.StatusText(last.Status)))
+    }
+    if len(potential.Failures) > 0 {
+        potential.Tag, potential.Severity = TagDesync, SeverityHigh
+        result.Flag(potential)
+        return result
+    }
+    exploit.Classify(potential, -1, &result)
+    return result
+}
+
+// exchange writes the request and reads what comes back, returning the
+// time to its first byte and whether the timeout cut the read short.
+func (rawCase *RawCase) exchange() ([]byte, time.Duration, bool, error) {
+    endpoint, err := url.Parse(rawCase.Exploit.URL)
+    if err != nil {
+        return nil, 0, false, err
+    }
+    address := endpoint.Host
+    if endpoint.Port() == "" {
+        port := "80"
+        if endpoint.Scheme == "https" {
+            port = "443"
+        }
+        address = net.JoinHostPort(endpoint.Hostname(), port)
+    }
+    dialer := &net.Dialer{Timeout: rawCase.Timeout}
+    var conn net.Conn
+    if endpoint.Scheme == "https" {
+        conn, err = tls.DialWithDialer(dialer, "tcp", address, &tls.Config{ServerName: endpoint.Hostname(), NextProtos: []string{"http/1.1"}})
+    } else {
+        conn, err = dialer.Dial("tcp", address)
+    }
+    if err != nil {
+        return nil, 0, false, err
+    }
+    defer conn.Close()
+
+    start := time.Now()
+    conn.SetDeadline(start.Add(rawCase.Timeout))
+    if _, err := conn.Write(rawCase.Request); err != nil {
+        return nil, time.Since(start), false, err
+    }
+    var received bytes.Buffer
+    var latency time.Duration
+    buffer := make([]byte, 32*1024)
+    for {
+        read, err := conn.Read(buffer)
+        if read > 0 && latency == 0 {
+            latency = time.Since(start)
+        }
+        received.Write(buffer[:read])
+        if err != nil {
+            if latency == 0 {
+                latency = time.Since(start)
+            }
+            timeout, ok := err.(net.Error)
+            return received.Bytes(), latency, ok && timeout.Timeout(), nil
+        }
+    }
+}
+
+// ParseRawResponses reads the responses in what the server sent back,
+// forgiving what a strict client would not: bare LF line endings,
+// missing reason phrases, folded headers and bodies cut short. Interim
+// 1xx responses are left out.
+func ParseRawResponses(data []byte) []RawResponse {
+    responses := make([]RawResponse, 0)
+    for {
+        data = bytes.TrimLeft(data, "\r\n")
+        if !bytes.HasPrefix(data, []byte("HTTP/")) {
+            return responses
+        }
+        line, rest := rawLine(data)
+        fields := strings.Fields(line)
+        response := RawResponse{Proto: fields[0], Headers: make(http.Header)}
+        if len(fields) > 1 {
+            response.Status, _ = strconv.Atoi(fields[1])
+        }
+        last := ""
+        for len(rest) > 0 {
+            line, rest = rawLine(rest)
+            if line == "" {
+                break
+            }
+            if (line[0] == ' ' || line[0] == '\t') && last != "" {
+                values := response.Headers[last]
+                values[len(values)-1] += " " + strings.TrimSpace(line)
+                continue
+            }
+            colon := strings.IndexByte(line, ':')
+            if colon <= 0 {
+                continue
+            }
+            last = http.CanonicalHeaderKey(strings.TrimSpace(line[:colon]))
+            response.Headers.Add(last, strings.TrimSpace(line[colon+1:]))
+        }
+
+        switch {
+        case response.Status/100 == 1 || response.Status == http.StatusNoContent || response.Status == http.StatusNotModified:
+        case strings.Contains(strings.ToLower(response.Headers.Get("Transfer-Encoding")), "chunked"):
+            response.Body, rest = rawChunks(rest)
+        case response.Headers.Get("Content-Length") != "":
+            length, err := strconv.Atoi(response.Headers.Get("Content-Length"))
+            if err != nil || length > len(rest) || length < 0 {
+                length = len(rest)
+            }
+            response.Body, rest = rest[:length], rest[length:]
+        default:
+            response.Body, rest = rest, nil
+        }
+        data = rest
+        if response.Status/100 != 1 {
+            responses = append(responses, response)
+        }
+    }
+}
+
+// rawLine splits off the next line, ended by CRLF or a bare LF.
+func rawLine(data []byte) (string, []byte) {
+    end := bytes.IndexByte(data, '\n')
+    if end < 0 {
+        return string(bytes.TrimRight(data, "\r")), nil
+    }
+    return string(bytes.TrimRight(data[:end], "\r")), data[end+1:]
+}
+
+// rawChunks decodes a chunked body, up to where it was cut short.
+func rawChunks(data []byte) ([]byte, []byte) {
+    var body bytes.Buffer
+    for len(data) > 0 {
+        line, rest := rawLine(data)
+        if semicolon := strings.IndexByte(line, ';'); semicolon >= 0 {
+            line = line[:semicolon]
+        }
+        size, err := strconv.ParseInt(strings.TrimSpace(line), 16, 64)
+        if err != nil || size < 0 {
+            return body.Bytes(), data
+        }
+        data = rest
+        if size == 0 {
+            // trailers, up to the empty line
+            for len(data) > 0 {
+                line, data = rawLine(data)
+                if line == "" {
+                    break
+                }
+            }
+            return body.Bytes(), data
+        }
+        if int64(len(data)) < size {
+            body.Write(data)
+            return body.Bytes(), nil
+        }
+        body.Write(data[:size])
+        data = bytes.TrimPrefix(bytes.TrimPrefix(data[size:], []byte("\r")), []byte("\n"))
+    }
+    return body.Bytes(), data
+}
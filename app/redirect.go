@@ -0,0 +1,245 @@
+package app
+
+import (
+    "fmt"
+    "strings"
+    "net/url"
+    "net/http"
+)
+
+const (
+    TagOpenRedirect  = "open-redirect"
+    TagHostInjection = "host-header-injection"
+
+    defaultRedirectHost = "evil.example"
+)
+
+var (
+    defaultRedirectParameters = []string{"url", "next", "redirect", "redirect_uri", "redirect_url", "return", "return_to", "returnTo", "continue", "dest", "destination", "goto", "target"}
+)
+
+// RedirectTest injects an external host into the redirect parameters of
+// the query and the payloads, and into the headers proxies and
+// frameworks build absolute urls from.
+type RedirectTest struct {
+    Host       string   `json:"host,omitempty"`
+    Parameters []string `json:"parameters,omitempty"`
+}
+
+// hostTampering is a set of headers claiming the request came for
+// another host or scheme.
+type hostTampering struct {
+    kind    string
+    headers map[string]string
+}
+
+func (test *RedirectTest) Run(exploit *Exploit) ExploitResult {
+    result := ExploitResult{
+        Potentials: make(ExploitPotentials, 0),
+        Passed:     make(ExploitPotentials, 0),
+        Failed:     make([]FailedRequest, 0),
+    }
+    send := func(request *Request, analyze func(*Potential)) {
+        potential, failure := request.Send()
+        if failure != nil {
+            result.Failed = append(result.Failed, *failure)
+            return
+        }
+        analyze(&potential)
+        result.Flag(potential)
+    }
+    host := orDefault(test.Host, defaultRedirectHost)
+
+    for _, parameter := range test.QueryParameters(exploit.URL) {
+        for _, value := range RedirectValues(host) {
+            for _, method := range exploit.Methods {
+                request := exploit.Request(method)
+                request.URL = withQuery(request.URL, parameter, value)
+                send(request, func(potential *Potential) {
+                    AnalyzeRedirect(potential, parameter, value, host)
+                    potential.Check = redirectCheck(parameter, value, host)
+                })
+            }
+        }
+    }
+
+    for _, method := range exploit.Methods {
+        if !AcceptsPayload(method) {
+            continue
+        }
+        for _, payload := range exploit.Payloads {
+            for _, parameter := range test.PayloadParameters(payload) {
+                for _, value := range RedirectValues(host) {
+                    request := exploit.Request(method)
+                    request.Payload = withField(payload, parameter, value)
+                    send(request, func(potential *Potential) {
+                        AnalyzeRedirect(potential, parameter, value, host)
+                        potential.Check = redirectCheck(parameter, value, host)
+                    })
+                }
+            }
+        }
+    }
+
+    for _, tampering := range HostTamperings(host, exploit.URL) {
+        for _, method := range exploit.Methods {
+            request := exploit.Request(method)
+            if request.Headers == nil {
+                request.Headers = make(http.Header)
+            }
+            for name, value := range tampering.headers {
+                request.Headers.Set(name, value)
+            }
+            send(request, func(potential *Potential) {
+                tampering.Analyze(potential, host)
+                potential.Check = &Check{Kind: CheckHost, Args: map[string]string{"kind": tampering.kind, "host": host}}
+            })
+        }
+    }
+    return result
+}
+
+// RedirectValues are the ways of pointing a redirect at the host: an
+// absolute url, a protocol relative one and a backslash one, which
+// browsers read as protocol relative.
+func RedirectValues(host string) []string {
+    return []string{
+        "https://" + host + "/",
+        "//" + host + "/",
+        "/\\" + host + "/",
+    }
+}
+
+// QueryParameters lists the redirect parameters in the url query.
+func (test *RedirectTest) QueryParameters(target string) []string {
+    found := make([]string, 0)
+    parsed, err := url.Parse(target)
+    if err != nil {
+        return found
+    }
+    for name := range parsed.Query() {
+        if test.isRedirectParameter(name) {
+            found = append(found, name)
+        }
+    }
+    return found
+}
+
+// PayloadParameters lists the redirect fields at the top of the payload.
+func (test *RedirectTest) PayloadParameters(payload Payload) []string {
+    found := make([]string, 0)
+    for name := range payload {
+        if test.isRedirectParameter(name) {
+            found = append(found, name)
+        }
+    }
+    return found
+}
+
+func (test *RedirectTest) isRedirectParameter(name string) bool {
+    parameters := test.Parameters
+    if len(parameters) == 0 {
+        parameters = defaultRedirectParameters
+    }
+    for _, parameter := range parameters {
+        if strings.EqualFold(name, parameter) {
+            return true
+        }
+    }
+    return false
+}
+
+func withField(payload Payload, name string, value interface{}) Payload {
+    copied := make(Payload, len(payload))
+    for key, item := range payload {
+        copied[key] = item
+    }
+    copied[name] = value
+    return copied
+}
+
+// AnalyzeRedirect flags the response sending the browser to the
+// injected host, through the Location header or a link in the body.
+func AnalyzeRedirect(potential *Potential, parameter string, value string, host string) {
+    const (
+        errLocation = "%s=%s redirects to %s"
+        errLink     = "%s=%s is linked from the body"
+    )
+    if location := potential.ResponseHeaders.Get("Location"); pointsTo(location, host) {
+        potential.Tag, potential.Severity = TagOpenRedirect, SeverityMedium
+        potential.Failures = append(potential.Failures, fmt.Sprintf(errLocation, parameter, value, location))
+        return
+    }
+    if linksTo(potential.ResponsePayload, value) {
+        potential.Tag, potential.Severity = TagOpenRedirect, SeverityLow
+        potential.Failures = append(potential.Failures, fmt.Sprintf(errLink, parameter, value))
+    }
+}
+
+func redirectCheck(parameter string, value string, host string) *Check {
+    return &Check{Kind: CheckRedirect, Args: map[string]string{"parameter": parameter, "value": value, "host": host}}
+}
+
+// HostTamperings are the header sets sent to the target: another Host,
+// another forwarded host, and a forwarded plain http scheme for https
+// targets.
+func HostTamperings(host string, target string) []hostTampering {
+    tamperings := []hostTampering{
+        {"Host", map[string]string{"Host": host}},
+        {"X-Forwarded-Host", map[string]string{"X-Forwarded-Host": host}},
+        {"X-Forwarded-Host and X-Forwarded-Proto", map[string]string{"X-Forwarded-Host": host, "X-Forwarded-Proto": "http"}},
+    }
+    if strings.HasPrefix(target, "https://") {
+        tamperings = append(tamperings, hostTampering{"X-Forwarded-Proto", map[string]string{"X-Forwarded-Proto": "http"}})
+    }
+    return tamperings
+}
+
+// Analyze flags the response building urls from the tampered headers:
+// a redirect or a link to the injected host, or a redirect downgraded
+// to plain http.
+func (tampering hostTampering) Analyze(potential *Potential, host string) {
+    const (
+        errLocation  = "%s %s: redirects to %s"
+        errLink      = "%s %s: reflected in the body"
+        errDowngrade = "%s: redirects to plain http %s"
+    )
+    location := potential.ResponseHeaders.Get("Location")
+    switch {
+    case pointsTo(location, host):
+        potential.Tag, potential.Severity = TagHostInjection, SeverityHigh
+        potential.Failures = append(potential.Failures, fmt.Sprintf(errLocation, tampering.kind, host, location))
+    case strings.Contains(strings.ToLower(string(potential.ResponsePayload)), host):
+        potential.Tag, potential.Severity = TagHostInjection, SeverityMedium
+        potential.Failures = append(potential.Failures, fmt.Sprintf(errLink, tampering.kind, host))
+    case tampering.kind == "X-Forwarded-Proto" && strings.HasPrefix(location, "http://"):
+        potential.Tag, potential.Severity = TagHostInjection, SeverityLow
+        potential.Failures = append(potential.Failures, fmt.Sprintf(errDowngrade, tampering.kind, location))
+    }
+}
+
+// pointsTo tells whether a browser following the location ends up on
+// the host.
+func pointsTo(location string, host string) bool {
+    if location == "" {
+        return false
+    }
+    parsed, err := url.Parse(strings.Replace(strings.TrimSpace(location), "\\", "/", -1))
+    if err != nil {
+        return false
+    }
+    return strings.EqualFold(parsed.Hostname(), host)
+}
+
+// linksTo tells whether the body uses the value as a link: an attribute,
+// a meta refresh or a script assigning the location.
+func linksTo(body []byte, value string) bool {
+    text := strings.ToLower(string(body))
+    value = strings.ToLower(value)
+    for _, prefix := range []string{`="`, `='`, `url=`, `location = "`, `location="`, `location.href = "`, `location.href="`} {
+        if strings.Contains(text, prefix+value) {
+            return true
+        }
+    }
+    return false
+}
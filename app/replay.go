@@ -0,0 +1,147 @@
+package app
+
+import (
+    "fmt"
+    "strings"
+    "net/url"
+    "net/http"
+)
+
+const (
+    ReplayReproduces = "reproduces"
+    ReplayChanged    = "changed"
+    ReplayFixed      = "fixed"
+    ReplayFailed     = "failed"
+)
+
+type ReplayResult struct {
+    Potential Potential
+    Outcome   string
+    Status    int
+    Err       error
+}
+
+// Rebase points the URL at target. The part of the URL under base, the
+// base url of the config when known, goes under target. Otherwise the
+// target scheme and host replace the recorded ones, its path prefixing
+// the recorded path.
+func Rebase(rawURL string, target string, base string) (string, error) {
+    if target == "" {
+        return rawURL, nil
+    }
+    if base != "" && strings.HasPrefix(rawURL, base) {
+        return strings.TrimSuffix(target, "/") + strings.TrimPrefix(rawURL, base), nil
+    }
+    original, err := url.Parse(rawURL)
+    if err != nil {
+        return "", err
+    }
+    rebased, err := url.Parse(target)
+    if err != nil {
+        return "", err
+    }
+    original.Scheme = rebased.Scheme
+    original.Host = rebased.Host
+    if prefix := strings.TrimSuffix(rebased.Path, "/"); prefix != "" {
+        original.Path = prefix + original.Path
+        original.RawPath = ""
+    }
+    return original.String(), nil
+}
+
+// Reauthenticate gives the request the credentials redacted from its
+// recording: the auth of the identity that sent it or else the config
+// auth, the config signing, and the config headers that were redacted.
+// Identities the config doesn't know, as the forged tokens of the JWT
+// tests, get no auth: the recording keeps the forged credentials, real
+// ones would turn the replay into a valid request. Only the valid token
+// of the JWT tests is taken from the config again.
+func (config *Config) Reauthenticate(request *Request, potential *Potential) {
+    request.Auth, request.Signing = config.Auth, config.Signing
+    if potential.Identity != "" {
+        identity, _ := config.Identity(potential.Identity)
+        request.Auth = identity.Auth
+    }
+    if potential.Identity == jwtValid && config.JWT != nil && config.JWT.Token != "" {
+        request.Auth = config.JWT.Auth(config.JWT.Token)
+    }
+    for name, value := range config.Headers {
+        if potential.RequestHeaders.Get(name) != redactedValue {
+            continue
+        }
+        if request.Headers == nil {
+            request.Headers = make(http.Header)
+        }
+        request.Headers.Set(name, value)
+    }
+}
+
+// Replay sends the stored request again, authenticated from the config.
+// Potentials recorded with their check are judged by it: fixed once the
+// finding no longer holds, changed when it holds under another tag, and
+// reproduces otherwise. The others are fixed once the config filters
+// would drop the response, reproduce while the response keeps its
+// signature, and changed otherwise.
+func (potential *Potential) Replay(target string, config *Config) ReplayResult {
+    result := ReplayResult{
+        Potential: *potential,
+    }
+    request, err := potential.Request()
+    if err != nil {
+        result.Outcome, result.Err = ReplayFailed, err
+        return result
+    }
+    config.Reauthenticate(request, potential)
+    if request.URL, err = Rebase(request.URL, target, config.BaseURL); err != nil {
+        result.Outcome, result.Err = ReplayFailed, err
+        return result
+    }
+    response, apiErr := request.Do()
+    if apiErr != nil {
+        result.Outcome, result.Err = ReplayFailed, apiErr
+        return result
+    }
+    replayed := Potential{
+        RequestMethod:   request.Method,
+        RequestURL:      request.URL,
+        ResponseStatus:  response.StatusCode,
+        ResponseHeaders: response.Headers,
+        ResponsePayload: response.Payload,
+    }
+    result.Status = response.StatusCode
+    if potential.Check != nil {
+        holds, err := potential.Check.Judge(&replayed, request, config)
+        switch {
+        case err != nil:
+            result.Outcome, result.Err = ReplayFailed, err
+        case !holds:
+            result.Outcome = ReplayFixed
+        case replayed.Tag != "" && replayed.Tag != potential.Tag:
+            result.Outcome = ReplayChanged
+        default:
+            result.Outcome = ReplayReproduces
+        }
+        return result
+    }
+    switch {
+    case !replayed.Match(config.FilterResponseCodes):
+        result.Outcome = ReplayFixed
+    case replayed.Signature() == potential.Signature():
+        result.Outcome = ReplayReproduces
+    default:
+        result.Outcome = ReplayChanged
+    }
+    return result
+}
+
+func (result ReplayResult) String() string {
+    const (
+        resultFormat = "[%s] #%d %s %s %d -> %d"
+        failedFormat = "[%s] #%d %s %s %v"
+    )
+    potential := result.Potential
+    if result.Err != nil {
+        return fmt.Sprintf(failedFormat, result.Outcome, potential.ID, potential.RequestMethod, potential.RequestURL, result.Err)
+    }
+    return fmt.Sprintf(resultFormat, result.Outcome, potential.ID, potential.RequestMethod, potential.RequestURL, potential.ResponseStatus, result.Status)
+}
@@ -0,0 +1,323 @@
+package app
+
+import (
+    "fmt"
+    "strings"
+    "net/url"
+    "encoding/xml"
+    "encoding/json"
+)
+
+const (
+    ExportJUnit = "junit"
+    ExportSARIF = "sarif"
+
+    // RuleUnexpectedStatus is the finding of potentials nothing tagged,
+    // answered with a status the filters don't expect.
+    RuleUnexpectedStatus = "unexpected-status"
+
+    sarifVersion = "2.1.0"
+    sarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+    toolName     = "go-tester"
+)
+
+var (
+    sarifLevels = map[string]string{
+        SeverityCritical: "error",
+        SeverityHigh:     "error",
+        SeverityMedium:   "warning",
+        SeverityLow:      "note",
+        SeverityInfo:     "note",
+    }
+)
+
+// Report holds everything a run sent, grouped the way the report formats
+// need it.
+type Report struct {
+    Potentials ExploitPotentials
+    Passed     ExploitPotentials
+    Failed     []FailedRequest
+}
+
+type junitSuites struct {
+    XMLName xml.Name      `xml:"testsuites"`
+    Suites  []*junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+    Name     string      `xml:"name,attr"`
+    Tests    int         `xml:"tests,attr"`
+    Failures int         `xml:"failures,attr"`
+    Errors   int         `xml:"errors,attr"`
+    Cases    []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+    Name      string        `xml:"name,attr"`
+    Classname string        `xml:"classname,attr"`
+    Failure   *junitProblem `xml:"failure,omitempty"`
+    Error     *junitProblem `xml:"error,omitempty"`
+}
+
+type junitProblem struct {
+    Message string `xml:"message,attr"`
+    Type    string `xml:"type,attr"`
+    Text    string `xml:",chardata"`
+}
+
+type sarifLog struct {
+    Version string     `json:"version"`
+    Schema  string     `json:"$schema"`
+    Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+    Tool              sarifTool         `json:"tool"`
+    AutomationDetails sarifAutomation   `json:"automationDetails"`
+    Invocations       []sarifInvocation `json:"invocations"`
+    Results           []sarifResult     `json:"results"`
+}
+
+type sarifTool struct {
+    Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+    Name  string      `json:"name"`
+    Rules []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+    ID               string       `json:"id"`
+    ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifAutomation struct {
+    ID string `json:"id"`
+}
+
+type sarifInvocation struct {
+    ExecutionSuccessful bool                `json:"executionSuccessful"`
+    Notifications       []sarifNotification `json:"toolExecutionNotifications,omitempty"`
+}
+
+type sarifNotification struct {
+    Level     string          `json:"level"`
+    Message   sarifMessage    `json:"message"`
+    Locations []sarifLocation `json:"locations"`
+}
+
+type sarifResult struct {
+    RuleID     string                 `json:"ruleId"`
+    Level      string                 `json:"level"`
+    Message    sarifMessage           `json:"message"`
+    Locations  []sarifLocation        `json:"locations"`
+    Properties map[string]interface{} `json:"properties"`
+}
+
+type sarifMessage struct {
+    Text string `json:"text"`
+}
+
+type sarifLocation struct {
+    PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+    ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+}
+
+type sarifArtifactLocation struct {
+    URI string `json:"uri"`
+}
+
+func (report *Report) Add(result ExploitResult) {
+    report.Potentials = append(report.Potentials, result.Potentials...)
+    report.Passed = append(report.Passed, result.Passed...)
+    report.Failed = append(report.Failed, result.Failed...)
+}
+
+// Message says why the potential was reported: the broken expectations,
+// or the unexpected status.
+func (potential *Potential) Message() string {
+    const (
+        statusFormat = "%s %s answered %d"
+    )
+    if len(potential.Failures) > 0 {
+        return strings.Join(potential.Failures, "; ")
+    }
+    return fmt.Sprintf(statusFormat, potential.RequestMethod, potential.RequestURL, potential.ResponseStatus)
+}
+
+func (report *Report) Render(format string) ([]byte, error) {
+    const (
+        errUnknownReport = "unknown report format %s"
+    )
+    switch format {
+    case ExportJUnit:
+        return report.JUnit()
+    case ExportSARIF:
+        return report.SARIF()
+    case ExportHTML:
+        return report.HTML()
+    }
+    return nil, fmt.Errorf(errUnknownReport, format)
+}
+
+// Rule names the finding behind the potential, its tag when whoever
+// found it set one.
+func (potential *Potential) Rule() string {
+    if potential.Tag != "" {
+        return potential.Tag
+    }
+    return RuleUnexpectedStatus
+}
+
+// CaseName tells requests apart the way JUnit test cases are: by method,
+// URL, payload and identity.
+func (potential *Potential) CaseName() string {
+    name := potential.RequestMethod + " " + potential.RequestURL
+    if body := potential.BodyText(); body != "" {
+        name += " " + body
+    }
+    if potential.Identity != "" {
+        name += " as " + potential.Identity
+    }
+    return name
+}
+
+func (potential *Potential) CaseClass() string {
+    target, err := url.Parse(potential.RequestURL)
+    if err != nil {
+        return potential.RequestURL
+    }
+    return target.Host + target.Path
+}
+
+// JUnit writes one suite per run and one test case per request: passed
+// when filtered out, failed for potentials and errored when unanswered.
+func (report *Report) JUnit() ([]byte, error) {
+    const (
+        failureText = "%s\n\n%s"
+    )
+    suites := &junitSuites{}
+    index := make(map[string]*junitSuite)
+    suite := func(runID string) *junitSuite {
+        if _, ok := index[runID]; !ok {
+            index[runID] = &junitSuite{Name: toolName + " " + runID}
+            suites.Suites = append(suites.Suites, index[runID])
+        }
+        return index[runID]
+    }
+    for _, potential := range report.Passed {
+        current := suite(potential.RunID)
+        current.Tests++
+        current.Cases = append(current.Cases, junitCase{
+            Name:      potential.CaseName(),
+            Classname: potential.CaseClass(),
+        })
+    }
+    for _, potential := range report.Potentials {
+        current := suite(potential.RunID)
+        current.Tests++
+        current.Failures++
+        current.Cases = append(current.Cases, junitCase{
+            Name:      potential.CaseName(),
+            Classname: potential.CaseClass(),
+            Failure: &junitProblem{
+                Message: potential.Rule() + ": " + potential.Message(),
+                Type:    potential.Classify(),
+                Text:    fmt.Sprintf(failureText, potential.Sent(), potential.ResponsePayload),
+            },
+        })
+    }
+    for _, failed := range report.Failed {
+        current := suite(failed.Potential.RunID)
+        current.Tests++
+        current.Errors++
+        current.Cases = append(current.Cases, junitCase{
+            Name:      failed.Potential.CaseName(),
+            Classname: failed.Potential.CaseClass(),
+            Error: &junitProblem{
+                Message: failed.Err,
+                Type:    "request",
+                Text:    failed.Potential.Sent(),
+            },
+        })
+    }
+    bytes, err := xml.MarshalIndent(suites, "", "    ")
+    if err != nil {
+        return nil, err
+    }
+    return append([]byte(xml.Header), append(bytes, '\n')...), nil
+}
+
+// SARIF writes one run per run ID with a result per potential, the
+// failed requests going in as execution notifications.
+func (report *Report) SARIF() ([]byte, error) {
+    log := sarifLog{
+        Version: sarifVersion,
+        Schema:  sarifSchema,
+        Runs:    make([]sarifRun, 0),
+    }
+    index := make(map[string]int)
+    rules := make(map[string]map[string]bool)
+    run := func(runID string) *sarifRun {
+        if _, ok := index[runID]; !ok {
+            index[runID] = len(log.Runs)
+            rules[runID] = make(map[string]bool)
+            log.Runs = append(log.Runs, sarifRun{
+                Tool: sarifTool{
+                    Driver: sarifDriver{Name: toolName, Rules: make([]sarifRule, 0)},
+                },
+                AutomationDetails: sarifAutomation{ID: runID},
+                Invocations:       []sarifInvocation{{ExecutionSuccessful: true}},
+                Results:           make([]sarifResult, 0),
+            })
+        }
+        return &log.Runs[index[runID]]
+    }
+    for _, potential := range report.Potentials {
+        current := run(potential.RunID)
+        rule := potential.Rule()
+        if !rules[potential.RunID][rule] {
+            rules[potential.RunID][rule] = true
+            current.Tool.Driver.Rules = append(current.Tool.Driver.Rules, sarifRule{
+                ID:               rule,
+                ShortDescription: sarifMessage{Text: strings.Replace(rule, "-", " ", -1)},
+            })
+        }
+        current.Results = append(current.Results, sarifResult{
+            RuleID:    rule,
+            Level:     sarifLevels[potential.Classify()],
+            Message:   sarifMessage{Text: potential.Message()},
+            Locations: []sarifLocation{location(potential.RequestURL)},
+            Properties: map[string]interface{}{
+                "severity": potential.Classify(),
+                "method":   potential.RequestMethod,
+                "status":   potential.ResponseStatus,
+            },
+        })
+    }
+    for _, failed := range report.Failed {
+        invocation := &run(failed.Potential.RunID).Invocations[0]
+        invocation.Notifications = append(invocation.Notifications, sarifNotification{
+            Level:     "error",
+            Message:   sarifMessage{Text: failed.Potential.RequestMethod + " " + failed.Potential.RequestURL + ": " + failed.Err},
+            Locations: []sarifLocation{location(failed.Potential.RequestURL)},
+        })
+    }
+    bytes, err := json.MarshalIndent(log, "", "    ")
+    if err != nil {
+        return nil, err
+    }
+    return append(bytes, '\n'), nil
+}
+
+func location(uri string) sarifLocation {
+    return sarifLocation{
+        PhysicalLocation: sarifPhysicalLocation{
+            ArtifactLocation: sarifArtifactLocation{URI: uri},
+        },
+    }
+}
@@ -2,56 +2,190 @@ package app
 
 import (
     "fmt"
+    "time"
     "errors"
     "net/http"
+    "encoding/json"
     "github.com/mercadolibre/go-meli-toolkit/restful/rest"
     "github.com/mercadolibre/go-meli-toolkit/goutils/apierrors"
 )
 
+// Request is what gets sent, and the identity sending it when the
+// exploit has identities.
 type Request struct {
-    Method  string
-    URL     string
-    Payload map[string]interface{}
+    Method   string
+    URL      string
+    Headers  http.Header
+    Auth     *Auth
+    Signing  *Signing
+    Payload  map[string]interface{}
+    Body     []byte
+    Identity string
+
+    Interactions *Interactions
 }
 
+// Response is what a request got back. The URL and headers sent are
+// recorded with their credentials redacted.
 type Response struct {
-    StatusCode int
-    Headers    http.Header
-    Payload    []byte
+    StatusCode     int
+    Headers        http.Header
+    Payload        []byte
+    URL            string
+    RequestHeaders http.Header
+    Latency        time.Duration
+
+    // the headers as sent, credentials included
+    sent http.Header
 }
 
+// transport hides the shared http.Transport from rest, which would
+// otherwise rewrite its timeouts every time a new builder uses the pool.
+type transport struct {
+    http.RoundTripper
+}
+
+const (
+    // where the transport keeps the Location of redirects from rest
+    heldLocationHeader = "X-Go-Tester-Location"
+    // where the request keeps the headers rest sets its own value for
+    heldHeaderPrefix = "X-Go-Tester-Held-"
+)
+
+var (
+    // restHeaders are overwritten by rest on every request
+    restHeaders = []string{"User-Agent", "Connection", "Cache-Control"}
+)
+
+// RoundTrip sends the Host header the request sets, which the client
+// would otherwise replace with the url host, and the headers rest
+// overwrites, held aside by send. Redirects come back with their
+// Location held aside: rest refuses to follow them with an error that
+// drops the response, while without a Location the client hands it over
+// as is.
+func (transport *transport) RoundTrip(request *http.Request) (*http.Response, error) {
+    held := false
+    for _, name := range restHeaders {
+        held = held || len(request.Header.Values(heldHeaderPrefix+name)) > 0
+    }
+    if host := request.Header.Get("Host"); host != "" || held {
+        request = request.Clone(request.Context())
+        if host != "" {
+            request.Host = host
+            request.Header.Del("Host")
+        }
+        for _, name := range restHeaders {
+            if values := request.Header.Values(heldHeaderPrefix + name); len(values) > 0 {
+                request.Header[name] = values
+                request.Header.Del(heldHeaderPrefix + name)
+            }
+        }
+    }
+    response, err := transport.RoundTripper.RoundTrip(request)
+    if err != nil || response.StatusCode/100 != 3 {
+        return response, err
+    }
+    if location := response.Header.Get("Location"); location != "" {
+        response.Header.Del("Location")
+        response.Header.Set(heldLocationHeader, location)
+    }
+    return response, nil
+}
+
+var (
+    pool = &rest.CustomPool{
+        Transport: &transport{
+            RoundTripper: &http.Transport{
+                Proxy:               http.ProxyFromEnvironment,
+                MaxIdleConnsPerHost: rest.DefaultMaxIdleConnsPerHost,
+            },
+        },
+    }
+)
+
+// Do sends the request, once more with fresh credentials when the auth
+// can renew them and the first attempt is refused with 401.
 func (request *Request) Do() (*Response, apierrors.ApiError) {
+    response, apiErr := request.send()
+    if apiErr == nil && response.StatusCode == http.StatusUnauthorized && request.Auth.Refresh(response.sent) {
+        return request.send()
+    }
+    return response, apiErr
+}
+
+func (request *Request) send() (*Response, apierrors.ApiError) {
     const (
         errNilResponse      = "nil response received from %s"
-        errInvalidMethod    = "invalid method"
         errExecutingRequest = "error executing request"
+        errAuthenticating   = "error authenticating request"
+        errSigning          = "error signing request"
     )
 
     var response *rest.Response
 
     // Change timeout
 
+    builder := &rest.RequestBuilder{
+        Headers:    CloneHeaders(request.Headers),
+        CustomPool: pool,
+    }
+    if builder.Headers == nil {
+        builder.Headers = make(http.Header)
+    }
+    target, err := request.Auth.Apply(builder.Headers, request.URL)
+    if err != nil {
+        return nil, apierrors.NewInternalServerApiError(errAuthenticating, err)
+    }
+
+    var payload interface{}
+    switch {
+    case request.Body != nil:
+        builder.ContentType = rest.BYTES
+        payload = request.Body
+    case request.Payload != nil:
+        payload = request.Payload
+    }
+
+    // rest sends no body with these, whatever other method may carry one
     switch request.Method {
-    case http.MethodGet:
-        response = rest.Get(request.URL)
-    case http.MethodHead:
-        response = rest.Head(request.URL)
-    case http.MethodPost:
-        response = rest.Post(request.URL, request.Payload)
-    case http.MethodPut:
-        response = rest.Put(request.URL, request.Payload)
-    case http.MethodPatch:
-        response = rest.Patch(request.URL, request.Payload)
-    case http.MethodDelete:
-        response = rest.Delete(request.URL)
-    case http.MethodOptions:
-        response = rest.Options(request.URL)
-    default:
-        return nil, apierrors.NewBadRequestApiError(errInvalidMethod)
+    case http.MethodGet, http.MethodHead, http.MethodDelete, http.MethodOptions:
+        payload = nil
+    }
+
+    // sign exactly what rest writes: the body or the payload it marshals
+    // to JSON, nothing for the methods above
+    if request.Signing != nil {
+        var signed []byte
+        switch payload := payload.(type) {
+        case []byte:
+            signed = payload
+        case nil:
+        default:
+            if signed, err = json.Marshal(payload); err != nil {
+                return nil, apierrors.NewInternalServerApiError(errSigning, err)
+            }
+            // rest sets this content type on its own, SigV4 signs it
+            builder.Headers.Set("Content-Type", "application/json")
+        }
+        if err := request.Signing.Sign(request.Method, target, builder.Headers, signed); err != nil {
+            return nil, apierrors.NewInternalServerApiError(errSigning, err)
+        }
+    }
+
+    for _, name := range restHeaders {
+        if values := builder.Headers.Values(name); len(values) > 0 {
+            builder.Headers[heldHeaderPrefix+name] = values
+        }
+    }
+
+    start := time.Now()
+    response = builder.DoRequest(request.Method, target, payload)
+    for _, name := range restHeaders {
+        builder.Headers.Del(heldHeaderPrefix + name)
     }
 
     if response == nil {
-        err := errors.New(fmt.Sprintf(errNilResponse, request.URL))
+        err = errors.New(fmt.Sprintf(errNilResponse, target))
         return nil, apierrors.NewInternalServerApiError(errExecutingRequest, err)
     }
 
@@ -59,9 +193,30 @@ func (request *Request) Do() (*Response, apierrors.ApiError) {
         return nil, apierrors.NewInternalServerApiError(errExecutingRequest, response.Err)
     }
 
+    if location := response.Header.Get(heldLocationHeader); location != "" {
+        response.Header.Del(heldLocationHeader)
+        response.Header.Set("Location", location)
+    }
+
+    recordedHeaders, recordedURL := Redact(builder.Headers, target, request.Auth, request.Signing)
     return &Response{
-        StatusCode: response.StatusCode,
-        Headers:    response.Header,
-        Payload:    response.Bytes(),
+        StatusCode:     response.StatusCode,
+        Headers:        response.Header,
+        Payload:        response.Bytes(),
+        URL:            recordedURL,
+        RequestHeaders: recordedHeaders,
+        Latency:        time.Since(start),
+        sent:           builder.Headers,
     }, nil
 }
+
+func CloneHeaders(headers http.Header) http.Header {
+    if headers == nil {
+        return nil
+    }
+    clone := make(http.Header, len(headers))
+    for name, values := range headers {
+        clone[name] = append([]string(nil), values...)
+    }
+    return clone
+}
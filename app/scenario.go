@@ -0,0 +1,207 @@
+package app
+
+import (
+    "fmt"
+    "sync"
+    "regexp"
+    "encoding/json"
+)
+
+var (
+    // variablePlaceholder references a scenario variable, as in {{token}}.
+    variablePlaceholder = regexp.MustCompile(`\{\{(\w+)\}\}`)
+)
+
+// Scenario is a flow of requests sharing state: each step may extract
+// values from its response into variables the later steps reference.
+type Scenario struct {
+    ID        string            `json:"id"`
+    Variables map[string]string `json:"variables,omitempty"`
+    Steps     []Step            `json:"steps"`
+}
+
+type Step struct {
+    Operation
+    Extract map[string]Extractor `json:"extract,omitempty"`
+}
+
+// Extractor reads a variable from a response: a JSONPath into the body,
+// the first group of a regex over it, or a header.
+type Extractor struct {
+    JSON   string `json:"json,omitempty"`
+    Regex  string `json:"regex,omitempty"`
+    Header string `json:"header,omitempty"`
+}
+
+// Chain is one pass through a scenario, with every step resolved to the
+// variant it sends.
+type Chain struct {
+    Scenario  string
+    Variables map[string]string
+    Steps     []Step
+}
+
+// BuildChains runs each scenario once with the defaults, then once per
+// fuzz variant of every step, the other steps keeping their defaults.
+func (config *Config) BuildChains() []*Chain {
+    chains := make([]*Chain, 0)
+    for _, scenario := range config.Scenarios {
+        defaults := make([]Step, len(scenario.Steps))
+        variants := make([][]Operation, len(scenario.Steps))
+        for i, step := range scenario.Steps {
+            variants[i] = step.Operation.Variants(config.FuzzValuesOrDefault())
+            defaults[i] = Step{Operation: variants[i][0], Extract: step.Extract}
+        }
+        chains = append(chains, scenario.Chain(defaults))
+        for i := range scenario.Steps {
+            for _, variant := range variants[i][1:] {
+                steps := append([]Step(nil), defaults...)
+                steps[i] = Step{Operation: variant, Extract: scenario.Steps[i].Extract}
+                chains = append(chains, scenario.Chain(steps))
+            }
+        }
+    }
+    return chains
+}
+
+func (scenario *Scenario) Chain(steps []Step) *Chain {
+    return &Chain{
+        Scenario:  scenario.ID,
+        Variables: scenario.Variables,
+        Steps:     steps,
+    }
+}
+
+func (chain *Chain) AsyncExecute(config *Config, group *sync.WaitGroup, limiter chan bool, coverage *Coverage, out chan ExploitResult) {
+    defer group.Done()
+    results, _ := chain.Run(config, coverage)
+    for _, result := range results {
+        out <- result
+    }
+    <-limiter
+}
+
+// Run sends the steps in order, stopping at the first one that gets no
+// response or misses a value the later steps need. It returns the
+// variables as the last step left them.
+func (chain *Chain) Run(config *Config, coverage *Coverage) ([]ExploitResult, map[string]string) {
+    const (
+        errStep = "scenario %s step %s: %v"
+    )
+    variables := make(map[string]string)
+    for name, value := range chain.Variables {
+        variables[name] = value
+    }
+    results := make([]ExploitResult, 0, len(chain.Steps))
+    for _, step := range chain.Steps {
+        operation, err := step.Operation.Resolve(variables)
+        if err != nil {
+            results = append(results, ExploitResult{
+                Failed: []FailedRequest{{
+                    Potential: Potential{RequestMethod: step.Method, RequestURL: step.URL},
+                    Err:       fmt.Sprintf(errStep, chain.Scenario, step.ID, err),
+                }},
+            })
+            break
+        }
+        exploit := config.BuildOperationExploit(operation)
+        result := exploit.Run(coverage)
+        results = append(results, result)
+        responses := append(append(ExploitPotentials{}, result.Potentials...), result.Passed...)
+        if len(responses) == 0 {
+            break
+        }
+        if err := step.ExtractInto(&responses[0], variables); err != nil {
+            result.Failed = append(result.Failed, FailedRequest{
+                Potential: responses[0],
+                Err:       fmt.Sprintf(errStep, chain.Scenario, step.ID, err),
+            })
+            results[len(results)-1] = result
+            break
+        }
+    }
+    return results, variables
+}
+
+// Resolve replaces the placeholders of known variables in every field of
+// the operation. Unknown ones are left for whoever fills them later.
+func (operation Operation) Resolve(variables map[string]string) (Operation, error) {
+    if len(variables) == 0 {
+        return operation, nil
+    }
+    bytes, err := json.Marshal(operation)
+    if err != nil {
+        return Operation{}, err
+    }
+    resolved := variablePlaceholder.ReplaceAllFunc(bytes, func(placeholder []byte) []byte {
+        name := string(placeholder[2 : len(placeholder)-2])
+        value, ok := variables[name]
+        if !ok {
+            return placeholder
+        }
+        escaped, err := json.Marshal(value)
+        if err != nil {
+            return placeholder
+        }
+        return escaped[1 : len(escaped)-1]
+    })
+    var result Operation
+    if err := json.Unmarshal(resolved, &result); err != nil {
+        return Operation{}, err
+    }
+    return result, nil
+}
+
+func (step *Step) ExtractInto(potential *Potential, variables map[string]string) error {
+    const (
+        errExtract = "extracting %s: %v"
+    )
+    for name, extractor := range step.Extract {
+        value, err := extractor.Extract(potential)
+        if err != nil {
+            return fmt.Errorf(errExtract, name, err)
+        }
+        variables[name] = value
+    }
+    return nil
+}
+
+func (extractor *Extractor) Extract(potential *Potential) (string, error) {
+    const (
+        errNoHeader = "no header %s"
+        errNoMatch  = "no match for %s"
+    )
+    switch {
+    case extractor.Header != "":
+        value := potential.ResponseHeaders.Get(extractor.Header)
+        if value == "" {
+            return "", fmt.Errorf(errNoHeader, extractor.Header)
+        }
+        return value, nil
+    case extractor.Regex != "":
+        expression, err := regexp.Compile(extractor.Regex)
+        if err != nil {
+            return "", err
+        }
+        match := expression.FindSubmatch(potential.ResponsePayload)
+        if match == nil {
+            return "", fmt.Errorf(errNoMatch, extractor.Regex)
+        }
+        if len(match) > 1 {
+            return string(match[1]), nil
+        }
+        return string(match[0]), nil
+    }
+    var document interface{}
+    if err := json.Unmarshal(potential.ResponsePayload, &document); err != nil {
+        return "", err
+    }
+    value, err := LookupJSON(document, extractor.JSON)
+    if err != nil {
+        return "", err
+    }
+    if text, ok := value.(string); ok {
+        return text, nil
+    }
+    return jsonText(value), nil
+}
@@ -0,0 +1,111 @@
+package app
+
+import (
+    "fmt"
+    "math"
+    "reflect"
+)
+
+// Validate checks a decoded JSON value against the schema, returning a
+// message per violation prefixed with the path where it was found.
+// Schemas in configs are written inline, a reference is reported as a
+// violation rather than passing whatever it points to.
+func (schema *Schema) Validate(value interface{}, path string) []string {
+    const (
+        errType     = "%s is %s, expected %s"
+        errEnum     = "%s is %v, expected one of %v"
+        errRequired = "%s.%s is required"
+        errAnyOf    = "%s matches none of the schemas"
+        errOneOf    = "%s matches %d schemas, expected exactly one"
+        errRef      = "unsupported $ref %s at %s"
+    )
+    if schema == nil {
+        return nil
+    }
+    violations := make([]string, 0)
+    if schema.Ref != "" {
+        return append(violations, fmt.Sprintf(errRef, schema.Ref, path))
+    }
+    if schema.Type != "" && !matchesType(string(schema.Type), value) {
+        return append(violations, fmt.Sprintf(errType, path, jsonType(value), schema.Type))
+    }
+    if len(schema.Enum) > 0 {
+        found := false
+        for _, option := range schema.Enum {
+            if reflect.DeepEqual(option, value) {
+                found = true
+                break
+            }
+        }
+        if !found {
+            violations = append(violations, fmt.Sprintf(errEnum, path, value, schema.Enum))
+        }
+    }
+    switch value := value.(type) {
+    case map[string]interface{}:
+        for _, name := range schema.Required {
+            if _, ok := value[name]; !ok {
+                violations = append(violations, fmt.Sprintf(errRequired, path, name))
+            }
+        }
+        for name, property := range schema.Properties {
+            if field, ok := value[name]; ok {
+                violations = append(violations, property.Validate(field, path+"."+name)...)
+            }
+        }
+    case []interface{}:
+        for i, item := range value {
+            violations = append(violations, schema.Items.Validate(item, fmt.Sprintf("%s[%d]", path, i))...)
+        }
+    }
+    for _, part := range schema.AllOf {
+        violations = append(violations, part.Validate(value, path)...)
+    }
+    if len(schema.AnyOf) > 0 && countMatches(schema.AnyOf, value, path) == 0 {
+        violations = append(violations, fmt.Sprintf(errAnyOf, path))
+    }
+    if len(schema.OneOf) > 0 {
+        if matches := countMatches(schema.OneOf, value, path); matches != 1 {
+            violations = append(violations, fmt.Sprintf(errOneOf, path, matches))
+        }
+    }
+    return violations
+}
+
+func countMatches(schemas []*Schema, value interface{}, path string) int {
+    matches := 0
+    for _, schema := range schemas {
+        if len(schema.Validate(value, path)) == 0 {
+            matches++
+        }
+    }
+    return matches
+}
+
+func matchesType(schemaType string, value interface{}) bool {
+    switch schemaType {
+    case "integer":
+        number, ok := value.(float64)
+        return ok && number == math.Trunc(number)
+    case "number":
+        _, ok := value.(float64)
+        return ok
+    }
+    return jsonType(value) == schemaType
+}
+
+func jsonType(value interface{}) string {
+    switch value.(type) {
+    case map[string]interface{}:
+        return "object"
+    case []interface{}:
+        return "array"
+    case string:
+        return "string"
+    case float64:
+        return "number"
+    case bool:
+        return "boolean"
+    }
+    return "null"
+}
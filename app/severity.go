@@ -0,0 +1,72 @@
+package app
+
+import (
+    "fmt"
+    "strings"
+    "strconv"
+)
+
+const (
+    SeverityInfo     = "info"
+    SeverityLow      = "low"
+    SeverityMedium   = "medium"
+    SeverityHigh     = "high"
+    SeverityCritical = "critical"
+)
+
+var (
+    severityRanks = map[string]int{
+        SeverityInfo:     0,
+        SeverityLow:      1,
+        SeverityMedium:   2,
+        SeverityHigh:     3,
+        SeverityCritical: 4,
+    }
+)
+
+// Classify returns the severity set by whoever found the potential or,
+// for plain responses, one derived from the status class.
+func (potential *Potential) Classify() string {
+    if potential.Severity != "" {
+        return potential.Severity
+    }
+    switch potential.ResponseStatus / 100 {
+    case 5:
+        return SeverityHigh
+    case 4:
+        return SeverityLow
+    }
+    return SeverityMedium
+}
+
+func SeverityAtLeast(severity string, minimum string) bool {
+    return severityRanks[severity] >= severityRanks[minimum]
+}
+
+// ParseThresholds reads a list such as "high=0,medium=10": the maximum
+// number of potentials allowed at each severity or above.
+func ParseThresholds(value string) (map[string]int, error) {
+    const (
+        errInvalidThreshold = "invalid threshold %q"
+    )
+    thresholds := make(map[string]int)
+    for _, part := range strings.Split(value, ",") {
+        part = strings.TrimSpace(part)
+        if part == "" {
+            continue
+        }
+        pair := strings.SplitN(part, "=", 2)
+        if len(pair) != 2 {
+            return nil, fmt.Errorf(errInvalidThreshold, part)
+        }
+        if _, ok := severityRanks[pair[0]]; !ok {
+            return nil, fmt.Errorf(errInvalidThreshold, part)
+        }
+        limit, err := strconv.Atoi(pair[1])
+        if err != nil {
+            return nil, fmt.Errorf(errInvalidThreshold, part)
+        }
+        thresholds[pair[0]] = limit
+    }
+    return thresholds, nil
+}
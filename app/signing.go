@@ -0,0 +1,261 @@
+package app
+
+import (
+    "fmt"
+    "sort"
+    "time"
+    "errors"
+    "strings"
+    "net/url"
+    "net/http"
+    "crypto/hmac"
+    "crypto/rand"
+    "crypto/sha256"
+    "encoding/hex"
+)
+
+const (
+    SignerHMAC  = "hmac"
+    SignerSigV4 = "sigv4"
+
+    defaultSignatureHeader = "X-Signature"
+    defaultTimestampHeader = "X-Timestamp"
+    defaultNonceHeader     = "X-Nonce"
+    defaultKeyIDHeader     = "X-Key-Id"
+
+    sigV4Algorithm  = "AWS4-HMAC-SHA256"
+    sigV4TimeFormat = "20060102T150405Z"
+    sigV4DateFormat = "20060102"
+)
+
+var (
+    signers = map[string]func(signing *Signing) Signer{
+        SignerHMAC: func(signing *Signing) Signer {
+            return &hmacSigner{signing: signing}
+        },
+        SignerSigV4: func(signing *Signing) Signer {
+            return &sigV4Signer{signing: signing}
+        },
+    }
+)
+
+// Signing configures how a scan or an endpoint signs its requests. The
+// fields used depend on the type. SignedHeaders are added in order to
+// the HMAC canonical string.
+type Signing struct {
+    Type            string   `json:"type"`
+    Secret          string   `json:"secret,omitempty"`
+    KeyID           string   `json:"key_id,omitempty"`
+    SignatureHeader string   `json:"signature_header,omitempty"`
+    TimestampHeader string   `json:"timestamp_header,omitempty"`
+    NonceHeader     string   `json:"nonce_header,omitempty"`
+    SignedHeaders   []string `json:"signed_headers,omitempty"`
+    AccessKey       string   `json:"access_key,omitempty"`
+    SecretKey       string   `json:"secret_key,omitempty"`
+    SessionToken    string   `json:"session_token,omitempty"`
+    Region          string   `json:"region,omitempty"`
+    Service         string   `json:"service,omitempty"`
+}
+
+// Signer adds a signature computed over the request exactly as it is
+// sent, after payloads are mutated and credentials applied.
+type Signer interface {
+    Sign(method string, target *url.URL, headers http.Header, body []byte) error
+}
+
+type hmacSigner struct {
+    signing *Signing
+}
+
+type sigV4Signer struct {
+    signing *Signing
+}
+
+// RegisterSigner makes a custom signer available to configs under the
+// given type.
+func RegisterSigner(name string, build func(signing *Signing) Signer) {
+    signers[name] = build
+}
+
+func (signing *Signing) Sign(method string, target string, headers http.Header, body []byte) error {
+    const (
+        errUnknownSigner = "unknown signing type %s"
+    )
+    if signing == nil {
+        return nil
+    }
+    build, ok := signers[signing.Type]
+    if !ok {
+        return fmt.Errorf(errUnknownSigner, signing.Type)
+    }
+    parsed, err := url.Parse(target)
+    if err != nil {
+        return err
+    }
+    return build(signing).Sign(method, parsed, headers, body)
+}
+
+// Headers names the headers the signing sets, which only hold for the
+// request they were computed over.
+func (signing *Signing) Headers() []string {
+    if signing == nil {
+        return nil
+    }
+    switch signing.Type {
+    case SignerHMAC:
+        return []string{
+            orDefault(signing.SignatureHeader, defaultSignatureHeader),
+            orDefault(signing.TimestampHeader, defaultTimestampHeader),
+            orDefault(signing.NonceHeader, defaultNonceHeader),
+            defaultKeyIDHeader,
+        }
+    case SignerSigV4:
+        return []string{"Authorization", "X-Amz-Date", "X-Amz-Content-Sha256", "X-Amz-Security-Token"}
+    }
+    return nil
+}
+
+// Sign adds a timestamp, a nonce and the hex HMAC-SHA256 of the method,
+// request URI, timestamp, nonce, body hash and then each signed header
+// as lowercase name:value, one per line.
+func (signer *hmacSigner) Sign(method string, target *url.URL, headers http.Header, body []byte) error {
+    signing := signer.signing
+    timestamp := fmt.Sprint(time.Now().Unix())
+    nonce, err := randomHex(16)
+    if err != nil {
+        return err
+    }
+    lines := []string{
+        method,
+        target.RequestURI(),
+        timestamp,
+        nonce,
+        hashHex(body),
+    }
+    for _, name := range signing.SignedHeaders {
+        value := headers.Get(name)
+        if value == "" && strings.EqualFold(name, "Host") {
+            value = target.Host
+        }
+        lines = append(lines, strings.ToLower(name)+":"+strings.TrimSpace(value))
+    }
+    canonical := strings.Join(lines, "\n")
+    headers.Set(orDefault(signing.TimestampHeader, defaultTimestampHeader), timestamp)
+    headers.Set(orDefault(signing.NonceHeader, defaultNonceHeader), nonce)
+    if signing.KeyID != "" {
+        headers.Set(defaultKeyIDHeader, signing.KeyID)
+    }
+    signature := hmacSHA256([]byte(signing.Secret), canonical)
+    headers.Set(orDefault(signing.SignatureHeader, defaultSignatureHeader), hex.EncodeToString(signature))
+    return nil
+}
+
+// Sign follows AWS Signature Version 4, signing the host, the date, the
+// payload hash, the session token and the content type when present.
+func (signer *sigV4Signer) Sign(method string, target *url.URL, headers http.Header, body []byte) error {
+    const (
+        errScope = "sigv4 signing needs a region and a service"
+    )
+    signing := signer.signing
+    if signing.Region == "" || signing.Service == "" {
+        return errors.New(errScope)
+    }
+    now := time.Now().UTC()
+    amzDate := now.Format(sigV4TimeFormat)
+    date := now.Format(sigV4DateFormat)
+    payloadHash := hashHex(body)
+
+    headers.Set("X-Amz-Date", amzDate)
+    headers.Set("X-Amz-Content-Sha256", payloadHash)
+    if signing.SessionToken != "" {
+        headers.Set("X-Amz-Security-Token", signing.SessionToken)
+    }
+
+    signed := map[string]string{
+        "host": target.Host,
+    }
+    for _, name := range []string{"Content-Type", "X-Amz-Date", "X-Amz-Content-Sha256", "X-Amz-Security-Token"} {
+        if value := headers.Get(name); value != "" {
+            signed[strings.ToLower(name)] = strings.TrimSpace(value)
+        }
+    }
+    names := make([]string, 0, len(signed))
+    for name := range signed {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+    canonicalHeaders := ""
+    for _, name := range names {
+        canonicalHeaders += name + ":" + signed[name] + "\n"
+    }
+    signedHeaders := strings.Join(names, ";")
+
+    path := target.EscapedPath()
+    if path == "" {
+        path = "/"
+    }
+    canonicalRequest := strings.Join([]string{
+        method,
+        path,
+        canonicalQuery(target.Query()),
+        canonicalHeaders,
+        signedHeaders,
+        payloadHash,
+    }, "\n")
+
+    scope := strings.Join([]string{date, signing.Region, signing.Service, "aws4_request"}, "/")
+    stringToSign := strings.Join([]string{sigV4Algorithm, amzDate, scope, hashHex([]byte(canonicalRequest))}, "\n")
+
+    key := hmacSHA256([]byte("AWS4"+signing.SecretKey), date)
+    for _, part := range []string{signing.Region, signing.Service, "aws4_request"} {
+        key = hmacSHA256(key, part)
+    }
+    signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+    headers.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+        sigV4Algorithm, signing.AccessKey, scope, signedHeaders, signature))
+    return nil
+}
+
+// canonicalQuery sorts the parameters by name and value and encodes them
+// the RFC 3986 way SigV4 expects.
+func canonicalQuery(query url.Values) string {
+    pairs := make([]string, 0)
+    for name, values := range query {
+        for _, value := range values {
+            pairs = append(pairs, sigV4Escape(name)+"="+sigV4Escape(value))
+        }
+    }
+    sort.Strings(pairs)
+    return strings.Join(pairs, "&")
+}
+
+func sigV4Escape(value string) string {
+    return strings.Replace(url.QueryEscape(value), "+", "%20", -1)
+}
+
+func hmacSHA256(key []byte, message string) []byte {
+    mac := hmac.New(sha256.New, key)
+    mac.Write([]byte(message))
+    return mac.Sum(nil)
+}
+
+func hashHex(bytes []byte) string {
+    sum := sha256.Sum256(bytes)
+    return hex.EncodeToString(sum[:])
+}
+
+func randomHex(size int) (string, error) {
+    bytes := make([]byte, size)
+    if _, err := rand.Read(bytes); err != nil {
+        return "", err
+    }
+    return hex.EncodeToString(bytes), nil
+}
+
+func orDefault(value string, fallback string) string {
+    if value == "" {
+        return fallback
+    }
+    return value
+}
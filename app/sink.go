@@ -0,0 +1,57 @@
+package app
+
+import (
+    "io/ioutil"
+)
+
+// Sink receives the results of a run as they come in and is closed once
+// the run is over.
+type Sink interface {
+    Record(result ExploitResult) error
+    Close() error
+}
+
+// DatabaseSink saves the potentials to the potentials table.
+type DatabaseSink struct{}
+
+func (sink *DatabaseSink) Record(result ExploitResult) error {
+    var last error
+    for _, potential := range result.Potentials {
+        if err := potential.Save(); err != nil {
+            last = err
+        }
+    }
+    return last
+}
+
+func (sink *DatabaseSink) Close() error {
+    return nil
+}
+
+// ReportSink collects the whole run and writes it in one of the report
+// formats when closed.
+type ReportSink struct {
+    Format string
+    Output string
+    report Report
+}
+
+func NewReportSink(format string, output string) *ReportSink {
+    return &ReportSink{
+        Format: format,
+        Output: output,
+    }
+}
+
+func (sink *ReportSink) Record(result ExploitResult) error {
+    sink.report.Add(result)
+    return nil
+}
+
+func (sink *ReportSink) Close() error {
+    report, err := sink.report.Render(sink.Format)
+    if err != nil {
+        return err
+    }
+    return ioutil.WriteFile(sink.Output, report, 0644)
+}
@@ -0,0 +1,130 @@
+package app
+
+import (
+    "time"
+    "strings"
+    "encoding/json"
+    "github.com/emikohmann/go-tester/db"
+)
+
+type PotentialFilter struct {
+    ID     int64
+    RunID  string
+    Tag    string
+    Status int
+    Method string
+    Limit  int
+}
+
+func (filter PotentialFilter) Where() (string, []interface{}) {
+    conditions := make([]string, 0)
+    args := make([]interface{}, 0)
+    if filter.ID > 0 {
+        conditions = append(conditions, "id = ?")
+        args = append(args, filter.ID)
+    }
+    if filter.RunID != "" {
+        conditions = append(conditions, "run_id = ?")
+        args = append(args, filter.RunID)
+    }
+    if filter.Tag != "" {
+        conditions = append(conditions, "tag = ?")
+        args = append(args, filter.Tag)
+    }
+    if filter.Status > 0 {
+        conditions = append(conditions, "response_status = ?")
+        args = append(args, filter.Status)
+    }
+    if filter.Method != "" {
+        conditions = append(conditions, "request_method = ?")
+        args = append(args, filter.Method)
+    }
+    if len(conditions) == 0 {
+        return "", args
+    }
+    return " where " + strings.Join(conditions, " and "), args
+}
+
+func LoadPotentials(filter PotentialFilter) ([]Potential, error) {
+    const (
+        potentialSelectQuery = "select id, run_id, tag, identity, severity, request_method, request_url, request_headers, request_payload, request_body, response_status, response_headers, response_payload, latency_ms, assertions, replay_check from potentials"
+        potentialOrder       = " order by id"
+        potentialLimit       = " limit ?"
+    )
+    where, args := filter.Where()
+    query := potentialSelectQuery + where + potentialOrder
+    if filter.Limit > 0 {
+        query += potentialLimit
+        args = append(args, filter.Limit)
+    }
+
+    rows, err := db.Client.Query(query, args...)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    potentials := make([]Potential, 0)
+    for rows.Next() {
+        var potential Potential
+        var requestHeaders, requestPayload, responseHeaders, responsePayload string
+        var requestBody []byte
+        var assertions, check string
+        var latency int64
+        if err := rows.Scan(
+            &potential.ID,
+            &potential.RunID,
+            &potential.Tag,
+            &potential.Identity,
+            &potential.Severity,
+            &potential.RequestMethod,
+            &potential.RequestURL,
+            &requestHeaders,
+            &requestPayload,
+            &requestBody,
+            &potential.ResponseStatus,
+            &responseHeaders,
+            &responsePayload,
+            &latency,
+            &assertions,
+            &check,
+        ); err != nil {
+            return nil, err
+        }
+        if err := json.Unmarshal([]byte(requestHeaders), &potential.RequestHeaders); err != nil {
+            return nil, err
+        }
+        if err := json.Unmarshal([]byte(requestPayload), &potential.RequestPayload); err != nil {
+            return nil, err
+        }
+        if err := json.Unmarshal([]byte(responseHeaders), &potential.ResponseHeaders); err != nil {
+            return nil, err
+        }
+        if err := json.Unmarshal([]byte(assertions), &potential.Failures); err != nil {
+            return nil, err
+        }
+        if err := json.Unmarshal([]byte(check), &potential.Check); err != nil {
+            return nil, err
+        }
+        if len(requestBody) > 0 {
+            potential.RequestBody = requestBody
+        }
+        potential.ResponsePayload = []byte(responsePayload)
+        potential.Latency = time.Duration(latency) * time.Millisecond
+        potentials = append(potentials, potential)
+    }
+    return potentials, rows.Err()
+}
+
+// LatestRunID returns the run that saved the last potential, which is not
+// the last run when that one saved nothing.
+func LatestRunID() (string, error) {
+    const (
+        latestRunQuery = "select run_id from potentials order by id desc limit 1"
+    )
+    var runID string
+    if err := db.Client.QueryRow(latestRunQuery).Scan(&runID); err != nil {
+        return "", err
+    }
+    return runID, nil
+}
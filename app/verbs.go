@@ -0,0 +1,180 @@
+package app
+
+import (
+    "fmt"
+    "strings"
+    "net/url"
+    "net/http"
+)
+
+const (
+    TagVerbTampering  = "verb-tampering"
+    TagMethodOverride = "method-override"
+    TagTraceEnabled   = "trace-enabled"
+)
+
+var (
+    defaultTamperMethods   = []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS", "TRACE", "CONNECT", "PROPFIND", "FOO", "get"}
+    defaultOverrideHeaders = []string{"X-HTTP-Method-Override", "X-HTTP-Method", "X-Method-Override"}
+    defaultOverrideParams  = []string{"_method"}
+    overrideCarriers       = []string{http.MethodPost, http.MethodGet}
+)
+
+// VerbTamperTest sends the target every method, arbitrary ones
+// included, flagging the case mangled and unknown verbs that get through
+// where the method they are handled as is refused. It tries to reach
+// the refused methods through the override headers and parameters
+// frameworks honor too.
+type VerbTamperTest struct {
+    Methods    []string `json:"methods,omitempty"`
+    Headers    []string `json:"headers,omitempty"`
+    Parameters []string `json:"parameters,omitempty"`
+}
+
+func (test *VerbTamperTest) Run(exploit *Exploit) ExploitResult {
+    const (
+        errGuardBypassed = "%s refused with %d, %s answered %d"
+        errOverridden    = "%s refused with %d, reached through %s with %s: %d"
+        errTraceEchoed   = "TRACE echoes the request back"
+        overrideHeader   = "header %s"
+        overrideParam    = "parameter %s"
+    )
+    result := ExploitResult{
+        Potentials: make(ExploitPotentials, 0),
+        Passed:     make(ExploitPotentials, 0),
+        Failed:     make([]FailedRequest, 0),
+    }
+    methods := test.Methods
+    if len(methods) == 0 {
+        methods = defaultTamperMethods
+    }
+    headers := test.Headers
+    if len(headers) == 0 {
+        headers = defaultOverrideHeaders
+    }
+    parameters := test.Parameters
+    if len(parameters) == 0 {
+        parameters = defaultOverrideParams
+    }
+
+    // the baseline: how the target answers each method as is
+    baseline := make(map[string]Potential)
+    for _, method := range methods {
+        potential, failure := exploit.Request(method).Send()
+        if failure != nil {
+            result.Failed = append(result.Failed, *failure)
+            continue
+        }
+        baseline[method] = potential
+    }
+
+    for _, method := range methods {
+        potential, ok := baseline[method]
+        if !ok {
+            continue
+        }
+        // a guard only checking the methods it knows lets the verbs that
+        // are handled just the same through
+        semantic := semanticMethod(method)
+        guard, guarding := baseline[semantic]
+        switch {
+        case guarding && semantic != method && guarded(guard.ResponseStatus) && reachable(potential.ResponseStatus):
+            potential.Tag, potential.Severity = TagVerbTampering, SeverityHigh
+            potential.Failures = append(potential.Failures, fmt.Sprintf(errGuardBypassed, guard.RequestMethod, guard.ResponseStatus, method, potential.ResponseStatus))
+            potential.Check = &Check{Kind: CheckVerb, Args: map[string]string{"guard": semantic}}
+        case method == "TRACE" && reachable(potential.ResponseStatus) && strings.HasPrefix(string(potential.ResponsePayload), "TRACE "):
+            potential.Tag, potential.Severity = TagTraceEnabled, SeverityLow
+            potential.Failures = append(potential.Failures, errTraceEchoed)
+            potential.Check = &Check{Kind: CheckTrace}
+        }
+        result.Flag(potential)
+    }
+
+    for _, method := range methods {
+        refused, ok := baseline[method]
+        if !ok || !blocked(refused.ResponseStatus) {
+            continue
+        }
+        for _, carrier := range overrideCarriers {
+            plain, ok := baseline[carrier]
+            if !ok || carrier == strings.ToUpper(method) {
+                continue
+            }
+            requests := make([]*Request, 0, len(headers)+len(parameters))
+            descriptions := make([]string, 0, len(headers)+len(parameters))
+            checks := make([]*Check, 0, len(headers)+len(parameters))
+            for _, header := range headers {
+                request := exploit.Request(carrier)
+                if request.Headers == nil {
+                    request.Headers = make(http.Header)
+                }
+                request.Headers.Set(header, method)
+                requests = append(requests, request)
+                descriptions = append(descriptions, fmt.Sprintf(overrideHeader, header))
+                checks = append(checks, &Check{Kind: CheckOverride, Args: map[string]string{"method": method, "header": header}})
+            }
+            for _, parameter := range parameters {
+                request := exploit.Request(carrier)
+                request.URL = withQuery(request.URL, parameter, method)
+                requests = append(requests, request)
+                descriptions = append(descriptions, fmt.Sprintf(overrideParam, parameter))
+                checks = append(checks, &Check{Kind: CheckOverride, Args: map[string]string{"method": method, "parameter": parameter}})
+            }
+            for i, request := range requests {
+                potential, failure := request.Send()
+                if failure != nil {
+                    result.Failed = append(result.Failed, *failure)
+                    continue
+                }
+                // the carrier answering as it always does means the
+                // override was ignored
+                if reachable(potential.ResponseStatus) && potential.Signature() != plain.Signature() {
+                    potential.Tag, potential.Severity = TagMethodOverride, SeverityHigh
+                    potential.Failures = append(potential.Failures, fmt.Sprintf(errOverridden, method, refused.ResponseStatus, carrier, descriptions[i], potential.ResponseStatus))
+                    potential.Check = checks[i]
+                }
+                result.Flag(potential)
+            }
+        }
+    }
+    return result
+}
+
+// semanticMethod is the standard method servers handle the verb as: the
+// same method for case mangled ones, and GET for HEAD and for the verbs
+// they don't know, which routers commonly fall back to.
+func semanticMethod(method string) string {
+    switch upper := strings.ToUpper(method); upper {
+    case http.MethodHead:
+        return http.MethodGet
+    case http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete,
+        http.MethodOptions, http.MethodTrace, http.MethodConnect:
+        return upper
+    }
+    return http.MethodGet
+}
+
+// guarded tells whether the status refuses the caller.
+func guarded(status int) bool {
+    return status == http.StatusUnauthorized || status == http.StatusForbidden
+}
+
+// blocked tells whether the status refuses the caller or the method.
+func blocked(status int) bool {
+    return guarded(status) || status == http.StatusMethodNotAllowed || status == http.StatusNotImplemented
+}
+
+func reachable(status int) bool {
+    return status/100 == 2
+}
+
+func withQuery(target string, name string, value string) string {
+    parsed, err := url.Parse(target)
+    if err != nil {
+        return target
+    }
+    query := parsed.Query()
+    query.Set(name, value)
+    parsed.RawQuery = query.Encode()
+    return parsed.String()
+}
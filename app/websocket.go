@@ -0,0 +1,333 @@
+package app
+
+import (
+    "fmt"
+    "sync"
+    "time"
+    "bytes"
+    "errors"
+    "strings"
+    "net/http"
+    "encoding/json"
+    "github.com/gorilla/websocket"
+)
+
+const (
+    // what websocket exchanges are recorded with as request method
+    webSocketMethod = "WEBSOCKET"
+
+    defaultWebSocketWait    = 1000
+    webSocketHandshakeLimit = 10 * time.Second
+)
+
+// WebSocketTest opens the endpoint and sends its Messages in sequence,
+// the config payloads by default, then each message mutated after the
+// ones before it. Strings go as they are in text frames, anything else
+// as JSON. Every message is recorded with the frames the server sent
+// back within Wait milliseconds, and its status is the close code when
+// the server closed the connection, 101 while it stays open. Refused
+// handshakes are recorded with their HTTP status.
+type WebSocketTest struct {
+    URL           string            `json:"url"`
+    Headers       map[string]string `json:"headers,omitempty"`
+    Subprotocols  []string          `json:"subprotocols,omitempty"`
+    Messages      []json.RawMessage `json:"messages,omitempty"`
+    SkipMutations bool              `json:"skip_mutations,omitempty"`
+    Wait          int               `json:"wait_ms,omitempty"`
+}
+
+// WebSocketCase is a sequence of messages sent over one connection, the
+// ones before Reported only setting up the state of the last.
+type WebSocketCase struct {
+    Exploit  *Exploit
+    Test     *WebSocketTest
+    Messages []WebSocketMessage
+    Reported int
+}
+
+// WebSocketMessage is a text frame, with the payload it was written from
+// if any. Index is the position of the payload in the config payloads,
+// -1 for messages that are not one of them.
+type WebSocketMessage struct {
+    Text    []byte
+    Payload Payload
+    Index   int
+}
+
+type webSocketFrame struct {
+    data  []byte
+    code  int
+    cause string
+}
+
+// BuildWebSocketCases generates the sequence of every endpoint and its
+// mutations.
+func (config *Config) BuildWebSocketCases() []*WebSocketCase {
+    cases := make([]*WebSocketCase, 0)
+    fuzzValues := config.FuzzValuesOrDefault()
+    for i := range config.WebSockets {
+        test := &config.WebSockets[i]
+        target := test.URL
+        if !strings.Contains(target, "://") {
+            target = config.BaseURL + target
+        }
+        target = WebSocketURL(target)
+        exploit := config.BuildExploit(Endpoint{Path: test.URL, Headers: test.Headers}, target)
+        messages := test.Sequence(exploit.Payloads)
+        cases = append(cases, &WebSocketCase{Exploit: exploit, Test: test, Messages: messages})
+        if test.SkipMutations {
+            continue
+        }
+        for position, message := range messages {
+            for _, variant := range MutateMessage(message, fuzzValues) {
+                sequence := append(append(make([]WebSocketMessage, 0, position+1), messages[:position]...), variant)
+                cases = append(cases, &WebSocketCase{Exploit: exploit, Test: test, Messages: sequence, Reported: position})
+            }
+        }
+    }
+    return cases
+}
+
+// WebSocketURL turns http urls into their websocket equivalent.
+func WebSocketURL(target string) string {
+    switch {
+    case strings.HasPrefix(target, "http://"):
+        return "ws://" + strings.TrimPrefix(target, "http://")
+    case strings.HasPrefix(target, "https://"):
+        return "wss://" + strings.TrimPrefix(target, "https://")
+    }
+    return target
+}
+
+// Sequence writes the messages of the test, or the payloads without any.
+func (test *WebSocketTest) Sequence(payloads []Payload) []WebSocketMessage {
+    messages := make([]WebSocketMessage, 0)
+    if len(test.Messages) == 0 {
+        for i, payload := range payloads {
+            text, err := json.Marshal(payload)
+            if err != nil {
+                continue
+            }
+            messages = append(messages, WebSocketMessage{Text: text, Payload: payload, Index: i})
+        }
+        return messages
+    }
+    for _, raw := range test.Messages {
+        message := WebSocketMessage{Text: bytes.TrimSpace(raw), Index: -1}
+        var text string
+        var payload Payload
+        if json.Unmarshal(raw, &text) == nil {
+            message.Text = []byte(text)
+        } else if json.Unmarshal(raw, &payload) == nil {
+            message.Payload = payload
+        }
+        messages = append(messages, message)
+    }
+    return messages
+}
+
+// MutateMessage derives the variants of a message: those of its payload,
+// and malformed frames, truncated, empty and oversized.
+func MutateMessage(message WebSocketMessage, fuzzValues []string) []WebSocketMessage {
+    variants := make([]WebSocketMessage, 0)
+    if message.Payload != nil {
+        for _, mutation := range Mutate(message.Payload, fuzzValues) {
+            text, err := json.Marshal(mutation.Payload)
+            if err != nil {
+                continue
+            }
+            variants = append(variants, WebSocketMessage{Text: text, Payload: mutation.Payload, Index: -1})
+        }
+    }
+    if len(message.Text) > 1 {
+        variants = append(variants, WebSocketMessage{Text: message.Text[:len(message.Text)/2], Index: -1})
+    }
+    return append(variants,
+        WebSocketMessage{Text: []byte{}, Index: -1},
+        WebSocketMessage{Text: bytes.Repeat([]byte("A"), oversizedLength), Index: -1},
+    )
+}
+
+func (socketCase *WebSocketCase) AsyncExecute(group *sync.WaitGroup, limiter chan bool, out chan ExploitResult) {
+    defer group.Done()
+    out <- socketCase.Run()
+    <-limiter
+}
+
+// Run opens the connection, once more with fresh credentials when the
+// auth can renew them and the handshake is refused with 401, then sends
+// the messages until the server closes it.
+func (socketCase *WebSocketCase) Run() ExploitResult {
+    const (
+        errClosed = "connection closed before the message was sent"
+    )
+    exploit := socketCase.Exploit
+    result := ExploitResult{
+        Potentials: make(ExploitPotentials, 0),
+        Passed:     make(ExploitPotentials, 0),
+        Failed:     make([]FailedRequest, 0),
+        Asserted:   len(exploit.Expectations) > 0,
+    }
+
+    conn, handshake, sent, err := socketCase.dial()
+    if err == nil && conn == nil && handshake.ResponseStatus == http.StatusUnauthorized && exploit.Auth.Refresh(sent) {
+        conn, handshake, _, err = socketCase.dial()
+    }
+    if err != nil {
+        result.Failed = append(result.Failed, FailedRequest{Potential: handshake, Err: err.Error()})
+        return result
+    }
+    if conn == nil {
+        exploit.Classify(handshake, -1, &result)
+        return result
+    }
+    defer conn.Close()
+
+    // the reader stops with the connection, or when nothing waits for
+    // its frames anymore
+    frames, stop := make(chan webSocketFrame), make(chan bool)
+    defer close(stop)
+    go func() {
+        defer close(frames)
+        for {
+            frame := webSocketFrame{}
+            _, data, err := conn.ReadMessage()
+            if err != nil {
+                frame.code, frame.cause = websocket.CloseAbnormalClosure, err.Error()
+                if closeErr, ok := err.(*websocket.CloseError); ok {
+                    frame.code, frame.cause = closeErr.Code, closeErr.Text
+                }
+            } else {
+                frame.data = data
+            }
+            select {
+            case frames <- frame:
+            case <-stop:
+                return
+            }
+            if err != nil {
+                return
+            }
+        }
+    }()
+
+    wait := time.Duration(orDefaultInt(socketCase.Test.Wait, defaultWebSocketWait)) * time.Millisecond
+    closed := false
+    for i, message := range socketCase.Messages {
+        request := &Request{
+            Method:  webSocketMethod,
+            URL:     handshake.RequestURL,
+            Headers: handshake.RequestHeaders,
+            Payload: message.Payload,
+            Body:    message.Text,
+
+            Interactions: exploit.Interactions,
+        }
+        request, token := request.Interactions.Inject(request)
+        potential := Potential{
+            RequestMethod:   webSocketMethod,
+            RequestURL:      request.URL,
+            RequestHeaders:  request.Headers,
+            RequestPayload:  request.Payload,
+            RequestBody:     request.Body,
+            ResponseStatus:  handshake.ResponseStatus,
+            ResponseHeaders: handshake.ResponseHeaders,
+        }
+        if closed {
+            if i >= socketCase.Reported {
+                result.Failed = append(result.Failed, FailedRequest{Potential: potential, Err: errClosed})
+            }
+            break
+        }
+        start := time.Now()
+        if err := conn.WriteMessage(websocket.TextMessage, request.Body); err != nil {
+            result.Failed = append(result.Failed, FailedRequest{Potential: potential, Err: err.Error()})
+            break
+        }
+        received := make([][]byte, 0)
+        deadline := time.NewTimer(wait)
+    collect:
+        for {
+            select {
+            case frame, open := <-frames:
+                if !open {
+                    closed = true
+                    break collect
+                }
+                if potential.Latency == 0 {
+                    potential.Latency = time.Since(start)
+                }
+                if frame.code != 0 {
+                    potential.ResponseStatus, closed = frame.code, true
+                    if frame.cause != "" {
+                        received = append(received, []byte(frame.cause))
+                    }
+                    break collect
+                }
+                received = append(received, frame.data)
+            case <-deadline.C:
+                break collect
+            }
+        }
+        deadline.Stop()
+        if potential.Latency == 0 {
+            potential.Latency = time.Since(start)
+        }
+        potential.ResponsePayload = bytes.Join(received, []byte("\n"))
+        request.Interactions.Track(token, potential)
+        if i >= socketCase.Reported {
+            exploit.Classify(potential, message.Index, &result)
+        }
+    }
+
+    if !closed {
+        conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+    }
+    return result
+}
+
+// dial does the handshake, with no connection when the server refused
+// the upgrade, as recorded in the potential. It returns the headers
+// sent too, which a refused handshake renews credentials from.
+func (socketCase *WebSocketCase) dial() (*websocket.Conn, Potential, http.Header, error) {
+    const (
+        errAuthenticating = "error authenticating handshake: %v"
+        errNoHandshake    = "handshake got no response"
+    )
+    exploit := socketCase.Exploit
+    headers := CloneHeaders(exploit.Headers)
+    if headers == nil {
+        headers = make(http.Header)
+    }
+    handshake := Potential{RequestMethod: webSocketMethod}
+    handshake.RequestHeaders, handshake.RequestURL = Redact(headers, exploit.URL, exploit.Auth, exploit.Signing)
+    target, err := exploit.Auth.Apply(headers, exploit.URL)
+    if err != nil {
+        return nil, handshake, headers, fmt.Errorf(errAuthenticating, err)
+    }
+    handshake.RequestHeaders, handshake.RequestURL = Redact(headers, target, exploit.Auth, exploit.Signing)
+
+    dialer := &websocket.Dialer{
+        Proxy:            http.ProxyFromEnvironment,
+        HandshakeTimeout: webSocketHandshakeLimit,
+        Subprotocols:     socketCase.Test.Subprotocols,
+    }
+    start := time.Now()
+    conn, response, err := dialer.Dial(target, headers)
+    handshake.Latency = time.Since(start)
+    if response == nil {
+        if err == nil {
+            err = errors.New(errNoHandshake)
+        }
+        return nil, handshake, headers, err
+    }
+    handshake.ResponseStatus = response.StatusCode
+    handshake.ResponseHeaders = response.Header
+    if err != nil {
+        body := new(bytes.Buffer)
+        body.ReadFrom(response.Body)
+        handshake.ResponsePayload = body.Bytes()
+        return nil, handshake, headers, nil
+    }
+    return conn, handshake, headers, nil
+}
@@ -0,0 +1,50 @@
+-- Brings a potentials table created by an earlier setup.sql up to date,
+-- setup.sql already having every column. Run the statements from the
+-- first column the table lacks.
+
+-- request headers, from the OpenAPI import
+ALTER TABLE `potentials`
+  ADD COLUMN `request_headers` VARCHAR(5000) NOT NULL DEFAULT 'null' AFTER `request_url`;
+
+-- raw request bodies, from the Postman and HAR import
+ALTER TABLE `potentials`
+  ADD COLUMN `request_body` MEDIUMTEXT NOT NULL AFTER `request_payload`;
+
+-- run ids and finding tags, from the replay command
+ALTER TABLE `potentials`
+  ADD COLUMN `run_id` VARCHAR(50) NOT NULL DEFAULT '' AFTER `date`,
+  ADD COLUMN `tag` VARCHAR(50) NOT NULL DEFAULT '' AFTER `run_id`,
+  ADD KEY `search_run` (`run_id`),
+  ADD KEY `search_tag` (`tag`);
+
+-- severities, from the diff command
+ALTER TABLE `potentials`
+  ADD COLUMN `severity` VARCHAR(20) NOT NULL DEFAULT '' AFTER `tag`;
+
+-- latencies, from the HTML report
+ALTER TABLE `potentials`
+  ADD COLUMN `latency_ms` INTEGER(10) NOT NULL DEFAULT 0 AFTER `response_payload`;
+
+-- broken expectations, from the contract testing mode
+ALTER TABLE `potentials`
+  ADD COLUMN `assertions` VARCHAR(5000) NOT NULL DEFAULT 'null' AFTER `latency_ms`;
+
+-- identities, from the multi-identity testing
+ALTER TABLE `potentials`
+  ADD COLUMN `identity` VARCHAR(50) NOT NULL DEFAULT '' AFTER `tag`;
+
+-- oversized payloads, from the mass assignment and input validation cases
+ALTER TABLE `potentials`
+  MODIFY COLUMN `request_payload` MEDIUMTEXT NOT NULL;
+
+-- binary request bodies, stored as sent
+ALTER TABLE `potentials`
+  MODIFY COLUMN `request_body` MEDIUMBLOB NOT NULL;
+
+-- long assertions, from the out-of-band interaction dumps
+ALTER TABLE `potentials`
+  MODIFY COLUMN `assertions` MEDIUMTEXT NOT NULL;
+
+-- checks, from the replay command judging findings as they were found
+ALTER TABLE `potentials`
+  ADD COLUMN `replay_check` VARCHAR(2000) NOT NULL DEFAULT 'null' AFTER `assertions`;
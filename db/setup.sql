@@ -1,15 +1,26 @@
 CREATE TABLE `potentials` (
   `id`               BIGINT(20)    NOT NULL AUTO_INCREMENT,
   `date`             DATETIME      NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `run_id`           VARCHAR(50)   NOT NULL,
+  `tag`              VARCHAR(50)   NOT NULL DEFAULT '',
+  `identity`         VARCHAR(50)   NOT NULL DEFAULT '',
+  `severity`         VARCHAR(20)   NOT NULL,
 
   `request_method`   VARCHAR(50)   NOT NULL,
   `request_url`      VARCHAR(2000) NOT NULL,
-  `request_payload`  VARCHAR(2000) NOT NULL,
+  `request_headers`  VARCHAR(5000) NOT NULL,
+  `request_payload`  MEDIUMTEXT    NOT NULL,
+  `request_body`     MEDIUMBLOB    NOT NULL,
   `response_status`  INTEGER(10)   NOT NULL,
   `response_headers` VARCHAR(5000) NOT NULL,
   `response_payload` MEDIUMTEXT    NOT NULL,
+  `latency_ms`       INTEGER(10)   NOT NULL DEFAULT 0,
+  `assertions`       MEDIUMTEXT    NOT NULL,
+  `replay_check`     VARCHAR(2000) NOT NULL DEFAULT 'null',
 
   PRIMARY KEY (`id`, `date`),
+  KEY `search_run` (`run_id`),
+  KEY `search_tag` (`tag`),
   KEY `search_request` (`request_method`),
   KEY `search_response` (`response_status`)
 )
@@ -1,13 +1,101 @@
 package main
 
 import (
+    "os"
+    "fmt"
+    "flag"
     "github.com/emikohmann/go-tester/app"
 )
 
 const (
     defaultConfig = "./configs/config.json"
+
+    cmdRun    = "run"
+    cmdImport = "import"
+    cmdExport = "export"
+    cmdReplay = "replay"
+    cmdDiff   = "diff"
+
+    usage = `usage:
+  go-tester run [-config file] [-junit file] [-sarif file] [-html file]
+  go-tester import <openapi|postman|har|curl|http> <input> [-out file]
+  go-tester export [filters] [-format curl|http|go|junit|sarif|html] [-out file]
+  go-tester replay [filters] [-target base-url] [-config file]
+  go-tester diff -baseline run [-run run] [-fail-on severity=count,...]
+
+filters: [-id n] [-run id] [-tag tag] [-status code] [-method verb] [-limit n]`
 )
 
 func main() {
-    app.Start(defaultConfig)
+    // rest parses the global flags on init, so commands come first and
+    // carry their own flag sets.
+    command, args := cmdRun, []string{}
+    if len(os.Args) > 1 {
+        command, args = os.Args[1], os.Args[2:]
+    }
+
+    flags := flag.NewFlagSet(command, flag.ExitOnError)
+    flags.Usage = func() {
+        fmt.Println(usage)
+    }
+
+    switch command {
+    case cmdRun:
+        config := flags.String("config", defaultConfig, "config file to execute")
+        junit := flags.String("junit", "", "JUnit XML report to write")
+        sarif := flags.String("sarif", "", "SARIF report to write")
+        html := flags.String("html", "", "HTML report to write")
+        flags.Parse(args)
+        app.Start(*config, map[string]string{
+            app.ExportJUnit: *junit,
+            app.ExportSARIF: *sarif,
+            app.ExportHTML:  *html,
+        })
+    case cmdImport:
+        output := flags.String("out", defaultConfig, "config file to write")
+        if len(args) < 2 {
+            flags.Usage()
+            os.Exit(2)
+        }
+        flags.Parse(args[2:])
+        app.Import(args[0], args[1], *output)
+    case cmdExport:
+        filter := filterFlags(flags)
+        format := flags.String("format", app.ExportCurl, "curl, http, go, junit, sarif or html")
+        output := flags.String("out", "", "file to write, stdout by default")
+        flags.Parse(args)
+        app.ExportPotentials(*filter, *format, *output)
+    case cmdReplay:
+        filter := filterFlags(flags)
+        target := flags.String("target", "", "base url replacing the recorded one")
+        config := flags.String("config", defaultConfig, "config file whose credentials and filters the replay uses")
+        flags.Parse(args)
+        app.Replay(*filter, *target, *config)
+    case cmdDiff:
+        baseline := flags.String("baseline", "", "run id to compare against")
+        current := flags.String("run", "", "run id to check, the latest by default")
+        thresholds := flags.String("fail-on", "high=0", "new or changed potentials allowed per severity or above")
+        flags.Parse(args)
+        if *baseline == "" {
+            flags.Usage()
+            os.Exit(2)
+        }
+        if !app.CompareRuns(*baseline, *current, *thresholds) {
+            os.Exit(1)
+        }
+    default:
+        flags.Usage()
+        os.Exit(2)
+    }
+}
+
+func filterFlags(flags *flag.FlagSet) *app.PotentialFilter {
+    filter := &app.PotentialFilter{}
+    flags.Int64Var(&filter.ID, "id", 0, "potential id")
+    flags.StringVar(&filter.RunID, "run", "", "run id")
+    flags.StringVar(&filter.Tag, "tag", "", "finding tag")
+    flags.IntVar(&filter.Status, "status", 0, "response status")
+    flags.StringVar(&filter.Method, "method", "", "request method")
+    flags.IntVar(&filter.Limit, "limit", 0, "maximum potentials to load")
+    return filter
 }